@@ -44,6 +44,8 @@ type Node struct {
 	Data      string
 	Namespace string
 	Attr      []Attribute
+	// modified: 元素的开始标签在输入中的字节偏移
+	Offset int
 }
 
 // InsertBefore inserts newChild as a child of n, immediately before oldChild
@@ -139,6 +141,7 @@ func (n *Node) clone() *Node {
 		DataAtom: n.DataAtom,
 		Data:     n.Data,
 		Attr:     make([]Attribute, len(n.Attr)),
+		Offset:   n.Offset,
 	}
 	copy(m.Attr, n.Attr)
 	return m
@@ -303,8 +303,9 @@ func (p *parser) addText(text string) {
 
 	if p.shouldFosterParent() {
 		p.fosterParent(&Node{
-			Type: TextNode,
-			Data: text,
+			Type:   TextNode,
+			Data:   text,
+			Offset: p.tok.Offset,
 		})
 		return
 	}
@@ -315,8 +316,9 @@ func (p *parser) addText(text string) {
 		return
 	}
 	p.addChild(&Node{
-		Type: TextNode,
-		Data: text,
+		Type:   TextNode,
+		Data:   text,
+		Offset: p.tok.Offset,
 	})
 }
 
@@ -327,6 +329,7 @@ func (p *parser) addElement() {
 		DataAtom: p.tok.DataAtom,
 		Data:     p.tok.Data,
 		Attr:     p.tok.Attr,
+		Offset:   p.tok.Offset,
 	})
 }
 
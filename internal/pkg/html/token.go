@@ -77,6 +77,8 @@ type Token struct {
 	DataAtom atom.Atom
 	Data     string
 	Attr     []Attribute
+	// modified: token在输入中的字节偏移, 用于在编译错误中显示行号
+	Offset int
 }
 
 // tagString returns a string representation of a tag Token's Data and Attr.
@@ -145,6 +147,8 @@ type Tokenizer struct {
 	// buf[raw.end:] is buffered input that will yield future tokens.
 	raw span
 	buf []byte
+	// modified: buf之前已经丢弃的字节数, off+raw.start是当前token在输入中的偏移
+	off int
 	// maxBuf limits the data buffered in buf. A value of 0 means unlimited.
 	maxBuf int
 	// buf[data.start:data.end] holds the raw bytes of the current token's data:
@@ -265,6 +269,7 @@ func (z *Tokenizer) readByte() byte {
 				z.attr[i][1].end -= x
 			}
 		}
+		z.off += z.raw.start
 		z.raw.start, z.raw.end, z.buf = 0, d, buf1[:d]
 		// Now that we have copied the live bytes to the start of the buffer,
 		// we read from z.r into the remainder.
@@ -1170,7 +1175,7 @@ func (z *Tokenizer) TagAttr() (key, val []byte, moreAttr bool) {
 // Token returns the current Token. The result's Data and Attr values remain
 // valid after subsequent Next calls.
 func (z *Tokenizer) Token() Token {
-	t := Token{Type: z.tt}
+	t := Token{Type: z.tt, Offset: z.off + z.raw.start}
 	switch z.tt {
 	case TextToken, CommentToken, DoctypeToken:
 		t.Data = string(z.Text())
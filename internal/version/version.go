@@ -1,7 +1,7 @@
 package version
 
 // 当version改变，vue编译缓存就会失效。
-const Version = "0.0.25"
+const Version = "0.0.27"
 
 // 0.0.9
 // fix <!doctype html>
@@ -52,3 +52,9 @@ const Version = "0.0.25"
 
 // 0.0.25
 // exec directives on root tag of custom component
+
+// 0.0.26
+// shared runtime package: pkg/vuessr/runtime
+
+// 0.0.27
+// generate code through an IR, report invalid generated code as errors
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/urfave/cli/v2"
 	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
 	"github.com/zbysir/go-vue-ssr/internal/pkg/signal"
@@ -19,7 +20,7 @@ func main() {
 	c.Flags = []cli.Flag{
 		&cli.StringFlag{
 			Name:  "src",
-			Usage: "The .vue files dir",
+			Usage: "The .vue files dir, compile the packages in config file if empty",
 		},
 		&cli.StringFlag{
 			Name:  "to",
@@ -34,26 +35,47 @@ func main() {
 			Name:  "watch",
 			Usage: "watch file and rebuild",
 		},
+		&cli.StringFlag{
+			Name:  "exec",
+			Usage: "Command to run after each successful build in watch mode, e.g. restart the app",
+		},
+		&cli.IntFlag{
+			Name:  "j",
+			Usage: "Number of components compiled in parallel, defaults to the number of CPUs",
+		},
+		&cli.BoolFlag{
+			Name:  "runtime",
+			Usage: "Import the shared runtime package instead of copying it into each generated package",
+		},
+		&cli.StringFlag{
+			Name:  "config",
+			Value: vuessr.ConfigFile,
+			Usage: "Project config file, ignored if not exist",
+		},
 	}
 
 	c.Action = func(c *cli.Context) (err error) {
-		src := c.String("src")
-		if src == "" {
-			panic("invalid src")
+		config, err := loadConfig(c)
+		if err != nil {
+			return
 		}
-		to := c.String("to")
-		pkg := c.String("pkg")
 
 		if c.Bool("watch") {
 			ctx, cancel := signal.NewTermContext()
 			defer cancel()
 
-			err = vuessr.GenAllFileWithWatch(ctx, src, to, pkg)
+			err = vuessr.GenPackagesWithWatch(ctx, config, &vuessr.WatchOptions{
+				Exec:       c.String("exec"),
+				ConfigFile: c.String("config"),
+				Reload: func() (*vuessr.Config, error) {
+					return loadConfig(c)
+				},
+			})
 			if err != nil {
 				return
 			}
 		} else {
-			err = vuessr.GenAllFile(src, to, pkg)
+			err = vuessr.GenPackages(config)
 			if err != nil {
 				return
 			}
@@ -66,5 +88,28 @@ func main() {
 	err := c.Run(os.Args)
 	if err != nil {
 		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
+
+// 读取配置文件, 再应用命令行参数
+func loadConfig(c *cli.Context) (config *vuessr.Config, err error) {
+	config, err = vuessr.LoadConfig(c.String("config"))
+	if err != nil {
+		return
+	}
+	// 指定了-src时只编译这一个包, 否则编译配置文件中的packages
+	if src := c.String("src"); src != "" {
+		config.Packages = []vuessr.Package{{Src: src, To: c.String("to"), Pkg: c.String("pkg")}}
+	}
+	if len(config.Packages) == 0 {
+		return nil, fmt.Errorf("invalid src: set -src or packages in %s", c.String("config"))
+	}
+	if j := c.Int("j"); j > 0 {
+		config.Jobs = j
+	}
+	if c.Bool("runtime") {
+		config.Runtime = true
 	}
+	return
 }
@@ -5,13 +5,22 @@ import (
 	"github.com/robertkrimen/otto/ast"
 	"github.com/robertkrimen/otto/parser"
 	"github.com/robertkrimen/otto/token"
+	"strconv"
 	"strings"
 )
 
 // 生成go代码
 // dataKey: 默认为options.data
 func Js2Go(code string, scopeKey string) (goCode string, err error) {
+	goCode, _, err = Js2GoTyped(code, &Context{ScopeKey: scopeKey})
+	return
+}
+
+// 生成有类型的go代码, typ是go类型, 为空表示interface{}.
+// ctx.Vars中的变量会直接使用go代码而不是从scope中读取, 类型错误会记录在ctx.Errors中, 此时依然会生成(无类型的)代码.
+func Js2GoTyped(code string, ctx *Context) (goCode string, typ string, err error) {
 	// 用括号包裹的原因是让"{x: 1}"这样的语法解析成对象, 而不是label
+	src := code
 	code = fmt.Sprintf("(%s)", code)
 
 	p, err := parser.ParseFile(nil, "", code, 0)
@@ -20,74 +29,93 @@ func Js2Go(code string, scopeKey string) (goCode string, err error) {
 		return
 	}
 
-	goCode = genGoCodeByNode(p.Body[0], scopeKey)
+	ctx.src = src
+	goCode, typ = genGoCodeByNode(p.Body[0], ctx)
 	return
 }
 
-func genGoCodeByNode(node ast.Node, scopeKey string) (goCode string) {
+func genGoCodeByNode(node ast.Node, ctx *Context) (goCode string, typ string) {
+	scopeKey := ctx.ScopeKey
 	switch t := node.(type) {
 
 	case *ast.ExpressionStatement:
-		return genGoCodeByNode(t.Expression, scopeKey)
+		return genGoCodeByNode(t.Expression, ctx)
 	case *ast.Identifier:
-		return fmt.Sprintf(`%s.Get("%s")`, scopeKey, t.Name)
+		if v, ok := ctx.Vars[t.Name]; ok {
+			return v.Code, v.Type
+		}
+		return fmt.Sprintf(`%s.Get(%q)`, scopeKey, t.Name), ""
 	case *ast.DotExpression:
-		root, keys := lookExpress(t, scopeKey)
-		return fmt.Sprintf(`%s.Get(%s)`, root, strings.Join(keys, ", "))
+		// 字符串的length
+		if i, ok := t.Left.(*ast.Identifier); ok && t.Identifier.Name == "length" {
+			if v, ok := ctx.Vars[i.Name]; ok && v.Type == "string" {
+				return fmt.Sprintf("len(%s)", v.Code), "int"
+			}
+		}
+		root, keys := lookExpress(t, ctx)
+		return fmt.Sprintf(`%s.Get(%s)`, root, strings.Join(keys, ", ")), ""
 	case *ast.BracketExpression:
 		// a[b]
-		root, keys := lookExpress(t, scopeKey)
-		return fmt.Sprintf(`%s.Get(%s)`, root, strings.Join(keys, ", "))
+		root, keys := lookExpress(t, ctx)
+		return fmt.Sprintf(`%s.Get(%s)`, root, strings.Join(keys, ", ")), ""
 	case *ast.StringLiteral:
-		return fmt.Sprintf(`"%s"`, t.Value)
+		return strconv.Quote(t.Value), "string"
 	case *ast.NumberLiteral:
-		return fmt.Sprintf("%v", t.Value)
+		code := fmt.Sprintf("%v", t.Value)
+		return code, numberLiteralType(code)
 	case *ast.BooleanLiteral:
-		return fmt.Sprintf("%v", t.Value)
+		return fmt.Sprintf("%v", t.Value), "bool"
 	case *ast.NullLiteral:
-		return fmt.Sprintf("%v", "nil")
+		return fmt.Sprintf("%v", "nil"), ""
 	case *ast.BinaryExpression:
-		left := genGoCodeByNode(t.Left, scopeKey)
-		right := genGoCodeByNode(t.Right, scopeKey)
+		left, lt := genGoCodeByNode(t.Left, ctx)
+		right, rt := genGoCodeByNode(t.Right, ctx)
+		if code, typ, ok := genTypedBinary(ctx, t.Operator, left, lt, right, rt); ok {
+			return code, typ
+		}
 		o := t.Operator
 		switch o {
 		case token.STRICT_EQUAL, token.EQUAL:
-			return fmt.Sprintf(`interfaceToStr(%s) == interfaceToStr(%s)`, left, right)
+			return fmt.Sprintf(`interfaceToStr(%s) == interfaceToStr(%s)`, left, right), "bool"
 		case token.NOT_EQUAL, token.STRICT_NOT_EQUAL:
-			return fmt.Sprintf(`interfaceToStr(%s) != interfaceToStr(%s)`, left, right)
+			return fmt.Sprintf(`interfaceToStr(%s) != interfaceToStr(%s)`, left, right), "bool"
 		case token.PLUS:
-			return fmt.Sprintf(`interfaceAdd(%s, %s)`, left, right)
+			return fmt.Sprintf(`interfaceAdd(%s, %s)`, left, right), ""
 		case token.MINUS:
-			return fmt.Sprintf(`interfaceToFloat(%s) - interfaceToFloat(%s)`, left, right)
+			return fmt.Sprintf(`interfaceToFloat(%s) - interfaceToFloat(%s)`, left, right), ""
 		case token.MULTIPLY:
-			return fmt.Sprintf(`interfaceToFloat(%s) * interfaceToFloat(%s)`, left, right)
+			return fmt.Sprintf(`interfaceToFloat(%s) * interfaceToFloat(%s)`, left, right), ""
 		case token.SLASH:
-			return fmt.Sprintf(`interfaceToFloat(%s) / interfaceToFloat(%s)`, left, right)
+			return fmt.Sprintf(`interfaceToFloat(%s) / interfaceToFloat(%s)`, left, right), ""
 		case token.LOGICAL_AND, token.LOGICAL_OR:
-			return fmt.Sprintf(`interfaceToBool(%s) %s interfaceToBool(%s)`, left, t.Operator, right)
+			return fmt.Sprintf(`%s %s %s`, ToBoolCode(left, lt), t.Operator, ToBoolCode(right, rt)), "bool"
 		case token.LESS:
-			return fmt.Sprintf(`interfaceLess(%s, %s)`, left, right)
+			return fmt.Sprintf(`interfaceLess(%s, %s)`, left, right), ""
 		case token.GREATER:
-			return fmt.Sprintf(`interfaceGreater(%s, %s)`, left, right)
+			return fmt.Sprintf(`interfaceGreater(%s, %s)`, left, right), ""
 
 		default:
 			panic(fmt.Sprintf("bad Operator for BinaryExpression: %s", o))
 		}
 
 	case *ast.UnaryExpression:
-		arg := genGoCodeByNode(t.Operand, scopeKey)
+		arg, argType := genGoCodeByNode(t.Operand, ctx)
 		switch t.Operator {
 		case token.NOT:
-			return fmt.Sprintf(`%sinterfaceToBool(%s)`, t.Operator, arg)
+			return fmt.Sprintf(`%s%s`, t.Operator, ToBoolCode(arg, argType)), "bool"
 		case token.MINUS:
 			// -1
-			return fmt.Sprintf(`%s%s`, t.Operator, arg)
+			if argType == "string" || argType == "bool" {
+				ctx.errorf("operator - not defined on %s", argType)
+				return fmt.Sprintf(`-interfaceToFloat(%s)`, arg), "float64"
+			}
+			return fmt.Sprintf(`%s%s`, t.Operator, arg), argType
 		default:
 			panic(fmt.Sprintf("not handle UnaryExpression: %s", t.Operator))
 		}
 	case *ast.ObjectLiteral:
 		if len(t.Value) == 0 {
-			return "nil"
+			return "nil", ""
 		}
 
 		// 对象, 翻译成map[string]interface{}
@@ -98,37 +126,41 @@ func genGoCodeByNode(node ast.Node, scopeKey string) (goCode string) {
 
 			switch v.Kind {
 			case "value":
-				k = fmt.Sprintf(`"%s"`, v.Key)
+				k = strconv.Quote(v.Key)
 			default:
 				panic(fmt.Sprintf("bad Value kind of ObjectLiteral: %v", v.Kind))
 			}
 
-			valueCode := genGoCodeByNode(v.Value, scopeKey)
+			valueCode, _ := genGoCodeByNode(v.Value, ctx)
 			mapCode += fmt.Sprintf(`%s: %s,`, k, valueCode)
 		}
 		mapCode += "}"
-		return mapCode
+		return mapCode, ""
 	case *ast.CallExpression:
-		funcName := genGoCodeByNode(t.Callee, scopeKey)
+		funcName, _ := genGoCodeByNode(t.Callee, ctx)
 
 		args := make([]string, len(t.ArgumentList))
 		for i, v := range t.ArgumentList {
-			args[i] = genGoCodeByNode(v, scopeKey)
+			args[i], _ = genGoCodeByNode(v, ctx)
 		}
-		return fmt.Sprintf(`interfaceToFunc(%s)(r, options, %s)`, funcName, strings.Join(args, ","))
+		return fmt.Sprintf(`interfaceToFunc(%s)(r, options, %s)`, funcName, strings.Join(args, ",")), ""
 	case *ast.ArrayLiteral:
 		args := make([]string, len(t.Value))
 		for i, v := range t.Value {
-			args[i] = genGoCodeByNode(v, scopeKey)
+			args[i], _ = genGoCodeByNode(v, ctx)
 		}
-		return fmt.Sprintf(`[]interface{}{%s}`, strings.Join(args, ","))
+		return fmt.Sprintf(`[]interface{}{%s}`, strings.Join(args, ",")), ""
 	case *ast.ConditionalExpression:
 		// 三元运算
-		consequent := genGoCodeByNode(t.Consequent, scopeKey)
-		alternate := genGoCodeByNode(t.Alternate, scopeKey)
-		test := genGoCodeByNode(t.Test, scopeKey)
+		consequent, ct := genGoCodeByNode(t.Consequent, ctx)
+		alternate, at := genGoCodeByNode(t.Alternate, ctx)
+		test, tt := genGoCodeByNode(t.Test, ctx)
 
-		return fmt.Sprintf(`func() interface{} {if interfaceToBool(%s){return %s};return %s}()`, test, consequent, alternate)
+		// 两个分支的类型一样时结果也有类型
+		if ct == at && ct != "" && !isUntyped(ct) {
+			return fmt.Sprintf(`func() %s {if %s{return %s};return %s}()`, ct, ToBoolCode(test, tt), consequent, alternate), ct
+		}
+		return fmt.Sprintf(`func() interface{} {if %s{return %s};return %s}()`, ToBoolCode(test, tt), consequent, alternate), ""
 
 	default:
 		panic(fmt.Sprintf("bad type %T for genGoCodeByNode", t))
@@ -142,37 +174,38 @@ func genGoCodeByNode(node ast.Node, scopeKey string) (goCode string) {
 // 将a.b.c解析成 root 和keys
 // 如a.b.c, root: this, keys: [a ,b ,c]
 // 如"a".length, root: "a", keys: [length]
-func lookExpress(e ast.Expression, scopeKey string) (root string, keys []string) {
+func lookExpress(e ast.Expression, ctx *Context) (root string, keys []string) {
 	switch r := e.(type) {
 	case *ast.DotExpression:
 		// a.b 中的b
-		currKey := fmt.Sprintf(`"%s"`, r.Identifier.Name)
-		root, keys = lookExpress(r.Left, scopeKey)
+		currKey := strconv.Quote(r.Identifier.Name)
+		root, keys = lookExpress(r.Left, ctx)
 		keys = append(keys, currKey)
 	case *ast.Identifier:
 		// a.b 中的a
 		// 使用dataKey读取变量
-		root = scopeKey
-		keys = []string{fmt.Sprintf(`"%s"`, r.Name)}
+		root = ctx.ScopeKey
+		keys = []string{strconv.Quote(r.Name)}
 	case *ast.ObjectLiteral:
-		root = genGoCodeByNode(r, scopeKey)
+		root, _ = genGoCodeByNode(r, ctx)
 	case *ast.BinaryExpression:
-		root = genGoCodeByNode(r, scopeKey)
+		root, _ = genGoCodeByNode(r, ctx)
 	case *ast.BracketExpression:
 		var currKey string
 		switch m := r.Member.(type) {
 		case *ast.StringLiteral:
 			// a['b']
 			// 也可以走default语句, 但这是fastPath, 可以少调用interfaceToStr函数
-			currKey = fmt.Sprintf(`"%s"`, m.Value)
+			currKey = strconv.Quote(m.Value)
 		default:
 			// a[b]
 			// a[a+1]
 			// ... 各种表达式
-			currKey = fmt.Sprintf(`interfaceToStr(%s)`, genGoCodeByNode(r.Member, scopeKey))
+			member, _ := genGoCodeByNode(r.Member, ctx)
+			currKey = fmt.Sprintf(`interfaceToStr(%s)`, member)
 		}
 
-		root, keys = lookExpress(r.Left, scopeKey)
+		root, keys = lookExpress(r.Left, ctx)
 		keys = append(keys, currKey)
 	default:
 		panic(fmt.Sprintf("bad type for lookExpress: %T, %s", r, r))
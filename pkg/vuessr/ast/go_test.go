@@ -96,3 +96,45 @@ func TestAll(t *testing.T) {
 	t.Logf("%+v", gocode)
 
 }
+
+func TestJs2GoTyped(t *testing.T) {
+	vars := map[string]TypedVar{
+		"title": {Code: "xp_title", Type: "string"},
+		"size":  {Code: "xp_size", Type: "float64"},
+		"count": {Code: "xp_count", Type: "int"},
+		"on":    {Code: "xp_on", Type: "bool"},
+	}
+	cases := []struct {
+		js, code, typ string
+		errors        int
+	}{
+		{`title`, `xp_title`, "string", 0},
+		{`title + '!'`, `xp_title + "!"`, "string", 0},
+		{`size * 2`, `xp_size * 2`, "float64", 0},
+		{`count / 2`, `float64(xp_count) / float64(2)`, "float64", 0},
+		{`on && count > 1`, `xp_on && xp_count > 1`, "bool", 0},
+		{`!title`, `!interfaceToBool(xp_title)`, "bool", 0},
+		{`title.length`, `len(xp_title)`, "int", 0},
+		{`a + count`, `interfaceAdd(scope.Get("a"), xp_count)`, "", 0},
+		{`on ? title : 'x'`, `func() string {if xp_on{return xp_title};return "x"}()`, "string", 0},
+		{`title - 1`, `interfaceToFloat(xp_title) - interfaceToFloat(1)`, "", 1},
+		{`size == 'a'`, `interfaceToStr(xp_size) == interfaceToStr("a")`, "bool", 1},
+		{`size == count`, `interfaceToStr(xp_size) == interfaceToStr(xp_count)`, "bool", 0},
+		// 整数与小数字面量运算时转为float64
+		{`count * 0.5`, `float64(xp_count) * 0.5`, "float64", 0},
+		{`count + 1.5`, `float64(xp_count) + 1.5`, "float64", 0},
+		{`count > 0.5`, `float64(xp_count) > 0.5`, "bool", 0},
+		{`size * 0.5`, `xp_size * 0.5`, "float64", 0},
+		{`count * 2`, `xp_count * 2`, "int", 0},
+	}
+	for _, c := range cases {
+		ctx := &Context{ScopeKey: "scope", Vars: vars}
+		code, typ, err := Js2GoTyped(c.js, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != c.code || typ != c.typ || len(ctx.Errors) != c.errors {
+			t.Fatalf("%s: want %s (%s), but %s (%s), errors: %v", c.js, c.code, c.typ, code, typ, ctx.Errors)
+		}
+	}
+}
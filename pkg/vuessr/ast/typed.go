@@ -0,0 +1,183 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/robertkrimen/otto/token"
+	"strings"
+)
+
+// Js2GoTyped的上下文
+type Context struct {
+	ScopeKey string
+	// 有类型的变量, 如组件声明了类型的props, key是js中的变量名.
+	// 不在其中的变量都会从scope中读取, 类型为interface{}
+	Vars map[string]TypedVar
+	// 类型错误, 如 title - 1 (title是string)
+	Errors []string
+
+	// 正在翻译的js代码, 用于错误信息
+	src string
+}
+
+type TypedVar struct {
+	Code string // go代码, 如xp_title
+	Type string // go类型, 如string / bool / int / float64
+}
+
+func (c *Context) errorf(format string, args ...interface{}) {
+	c.Errors = append(c.Errors, fmt.Sprintf(format, args...)+": "+c.src)
+}
+
+// 数字字面量的类型, 和go中的无类型常量一样, 可以和任意数字类型运算
+const untypedNumber = "number"
+
+// 小数字面量(如0.5)的类型, 不能直接和整数类型运算, 整数会先转为float64
+const untypedFloat = "float"
+
+func isUntyped(typ string) bool {
+	return typ == untypedNumber || typ == untypedFloat
+}
+
+func isInteger(typ string) bool {
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return true
+	}
+	return false
+}
+
+// 数字字面量的类型
+func numberLiteralType(code string) string {
+	if strings.ContainsAny(code, ".eE") {
+		return untypedFloat
+	}
+	return untypedNumber
+}
+
+func IsNumeric(typ string) bool {
+	switch typ {
+	case untypedNumber, untypedFloat, "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return true
+	}
+	return false
+}
+
+// 两个数字类型运算后的类型, 不能直接运算(如int与float64)时返回false
+func numericType(lt, rt string) (string, bool) {
+	if !IsNumeric(lt) || !IsNumeric(rt) {
+		return "", false
+	}
+	switch {
+	case lt == rt:
+		return lt, true
+	case lt == untypedNumber:
+		return rt, true
+	case rt == untypedNumber:
+		return lt, true
+	case lt == untypedFloat && !isInteger(rt):
+		return rt, true
+	case rt == untypedFloat && !isInteger(lt):
+		return lt, true
+	}
+	return "", false
+}
+
+// 两个类型是否一定不能比较, 如string与int, 其中有无类型(interface{})时返回false
+func mismatch(lt, rt string) bool {
+	if lt == "" || rt == "" || lt == rt {
+		return false
+	}
+	if IsNumeric(lt) && IsNumeric(rt) {
+		return false
+	}
+	return true
+}
+
+// 两边都有类型时生成直接运算的代码, 如 a + b, 否则返回false使用interface{}的运算
+func genTypedBinary(ctx *Context, o token.Token, left, lt, right, rt string) (code string, typ string, ok bool) {
+	// 整数与小数字面量运算, 如 size * 0.5, 整数先转为float64
+	if lt == untypedFloat && isInteger(rt) {
+		right, rt = fmt.Sprintf("float64(%s)", right), "float64"
+	} else if rt == untypedFloat && isInteger(lt) {
+		left, lt = fmt.Sprintf("float64(%s)", left), "float64"
+	}
+
+	switch o {
+	case token.STRICT_EQUAL, token.EQUAL, token.NOT_EQUAL, token.STRICT_NOT_EQUAL:
+		op := "=="
+		if o == token.NOT_EQUAL || o == token.STRICT_NOT_EQUAL {
+			op = "!="
+		}
+		if mismatch(lt, rt) {
+			ctx.errorf("cannot compare %s with %s", lt, rt)
+			return
+		}
+		if _, num := numericType(lt, rt); num || (lt == rt && (lt == "string" || lt == "bool")) {
+			return fmt.Sprintf("%s %s %s", left, op, right), "bool", true
+		}
+	case token.PLUS:
+		if lt == "string" && rt == "string" {
+			return fmt.Sprintf("%s + %s", left, right), "string", true
+		}
+		if t, num := numericType(lt, rt); num && !isUntyped(t) {
+			return fmt.Sprintf("%s + %s", left, right), t, true
+		}
+	case token.MINUS, token.MULTIPLY, token.SLASH:
+		if lt == "string" || lt == "bool" || rt == "string" || rt == "bool" {
+			ctx.errorf("operator %s not defined on %s and %s", o, typeName(lt), typeName(rt))
+			return
+		}
+		t, num := numericType(lt, rt)
+		if !num || isUntyped(t) {
+			return
+		}
+		// js中的除法结果总是浮点数
+		if o == token.SLASH && t != "float64" {
+			return fmt.Sprintf("float64(%s) / float64(%s)", left, right), "float64", true
+		}
+		return fmt.Sprintf("%s %s %s", left, o, right), t, true
+	case token.LESS, token.GREATER:
+		if mismatch(lt, rt) {
+			ctx.errorf("cannot compare %s with %s", lt, rt)
+			return
+		}
+		if _, num := numericType(lt, rt); num || (lt == "string" && rt == "string") {
+			return fmt.Sprintf("%s %s %s", left, o, right), "bool", true
+		}
+	}
+	return
+}
+
+func typeName(typ string) string {
+	if typ == "" {
+		return "interface{}"
+	}
+	return typ
+}
+
+// 转为bool的代码
+func ToBoolCode(code string, typ string) string {
+	if typ == "bool" {
+		return code
+	}
+	return fmt.Sprintf("interfaceToBool(%s)", code)
+}
+
+// 转为字符串的代码, escaped表示需要转义html
+func ToStrCode(code string, typ string, escaped bool) string {
+	switch typ {
+	case "string":
+		if escaped {
+			return fmt.Sprintf("escape(%s)", code)
+		}
+		return code
+	case "int":
+		return fmt.Sprintf("intToStr(%s)", code)
+	case "float64":
+		return fmt.Sprintf("floatToStr(%s)", code)
+	}
+	if escaped {
+		return fmt.Sprintf("interfaceToStr(%s, true)", code)
+	}
+	return fmt.Sprintf("interfaceToStr(%s)", code)
+}
@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+)
+
+// js字面量的解析结果, 用于读取<script>中声明的组件选项, 如
+// {props: ['title'], inheritAttrs: false}
+type JsValue struct {
+	// object / array / string / number / bool / null / identifier / expression
+	// 不是字面量的表达式(如函数调用)都是expression
+	Kind   string
+	Keys   []string            // 对象的key, 保证声明顺序
+	Object map[string]*JsValue // 对象
+	Array  []*JsValue          // 数组
+	Value  interface{}         // string / float64 / bool
+	Name   string              // 标识符的名字, 如type: String中的String
+	Source string              // 原始js代码, 可以使用Js2Go翻译
+}
+
+// 获取对象中的值, 不存在或者不是对象时返回nil
+func (v *JsValue) Get(key string) *JsValue {
+	if v == nil || v.Object == nil {
+		return nil
+	}
+	return v.Object[key]
+}
+
+func ParseJsValue(code string) (v *JsValue, err error) {
+	// 和Js2Go一样, 用括号包裹让{}解析成对象
+	code = fmt.Sprintf("(%s)", code)
+
+	p, err := parser.ParseFile(nil, "", code, 0)
+	if err != nil {
+		err = fmt.Errorf("GetAst err: %w, code:%s", err, code)
+		return
+	}
+	if len(p.Body) != 1 {
+		err = fmt.Errorf("want one expression, code:%s", code)
+		return
+	}
+	s, ok := p.Body[0].(*ast.ExpressionStatement)
+	if !ok {
+		err = fmt.Errorf("want expression, code:%s", code)
+		return
+	}
+
+	v = genJsValue(s.Expression, code)
+	return
+}
+
+func genJsValue(node ast.Expression, code string) *JsValue {
+	// Idx从1开始
+	v := &JsValue{
+		Kind:   "expression",
+		Source: code[node.Idx0()-1 : node.Idx1()-1],
+	}
+
+	switch t := node.(type) {
+	case *ast.ObjectLiteral:
+		v.Kind = "object"
+		v.Object = map[string]*JsValue{}
+		for _, p := range t.Value {
+			if p.Kind != "value" {
+				v.Kind = "expression"
+				v.Object = nil
+				v.Keys = nil
+				break
+			}
+			v.Keys = append(v.Keys, p.Key)
+			v.Object[p.Key] = genJsValue(p.Value, code)
+		}
+	case *ast.ArrayLiteral:
+		v.Kind = "array"
+		for _, e := range t.Value {
+			v.Array = append(v.Array, genJsValue(e, code))
+		}
+	case *ast.StringLiteral:
+		v.Kind = "string"
+		v.Value = t.Value
+	case *ast.NumberLiteral:
+		v.Kind = "number"
+		switch n := t.Value.(type) {
+		case int64:
+			v.Value = float64(n)
+		default:
+			v.Value = n
+		}
+	case *ast.BooleanLiteral:
+		v.Kind = "bool"
+		v.Value = t.Value
+	case *ast.NullLiteral:
+		v.Kind = "null"
+	case *ast.Identifier:
+		v.Kind = "identifier"
+		v.Name = t.Name
+	}
+
+	return v
+}
@@ -2,33 +2,49 @@ package vuessr
 
 import (
 	"fmt"
-	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
-	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
+	"strconv"
 	"strings"
 )
 
-func genPropsClassCode(classJs string) string {
+func (c *Compiler) genPropsClassCode(classJs string) string {
 	if classJs == "" {
 		return "nil"
 	}
 
-	code, err := ast.Js2Go(classJs, ScopeKey)
-	if err != nil {
-		panic(err)
-	}
+	code := c.jsToGo(classJs)
 
 	return code
 }
 
-func genProps(props Props) string {
+func (c *Compiler) genProps(props Props) string {
 	if len(props) == 0 {
 		return "Props{}"
 	}
 
+	// 有v-bind="obj"时需要按声明顺序依次Set, 后面的值覆盖前面的
+	if props.HasSpread() {
+		code := "func() Props {\np := Props{}\n"
+		for _, p := range props {
+			valueCode := p.Code
+			if valueCode == "" {
+				valueCode = c.jsToGo(p.Val)
+			}
+			if p.Spread {
+				code += fmt.Sprintf("p.Spread(%s)\n", valueCode)
+			} else if p.Dynamic {
+				code += fmt.Sprintf("p.Set(%s, %s)\n", c.genArgCode(p.Key, true), valueCode)
+			} else {
+				code += fmt.Sprintf("p.Set(%q, %s)\n", p.Key, valueCode)
+			}
+		}
+		code += "return p\n}()"
+		return code
+	}
+
 	// orderKeyCode
 	orderKeyCode := `[]string{`
 	for _, p := range props {
-		orderKeyCode += fmt.Sprintf(`"%s",`, p.Key)
+		orderKeyCode += fmt.Sprintf(`%q,`, p.Key)
 	}
 	orderKeyCode += "}"
 
@@ -37,38 +53,33 @@ func genProps(props Props) string {
 	for _, p := range props {
 		k := p.Key
 		v := p.Val
-		valueCode, err := ast.Js2Go(v, ScopeKey)
-		if err != nil {
-			log.Panicf("%v, %s", err, v)
+		valueCode := p.Code
+		if valueCode == "" {
+			valueCode = c.jsToGo(v)
 		}
-		dataCode += fmt.Sprintf(`"%s": %s,`, k, valueCode)
+		dataCode += fmt.Sprintf(`%q: %s,`, k, valueCode)
 	}
 	dataCode += "}"
 
-	return fmt.Sprintf(`Props{orderKey: %s, data: %s}`, orderKeyCode, dataCode)
+	return fmt.Sprintf(`orderedProps(%s, %s)`, orderKeyCode, dataCode)
 }
 
-func genPropsStyleCode(styleJs string) string {
+func (c *Compiler) genPropsStyleCode(styleJs string) string {
 	if styleJs == "" {
 		return "nil"
 	}
 
-	code, err := ast.Js2Go(styleJs, ScopeKey)
-	if err != nil {
-		panic(err)
-	}
+	code := c.jsToGo(styleJs)
 
 	return code
 }
 
-// 生成!动态节点的!attr, 包括class style和其他
-func genAllAttrCode(e *VueElement) string {
-	var a = ""
-
-	// go代码
-	var classCode = ""
-	var styleCode = ""
-	var attrCode = ""
+// 生成!静态节点的!attr, 包括class style和其他
+func (c *Compiler) genAllAttrCode(e *VueElement) (a strExpr) {
+	// 静态的attr是文本, 动态的是go代码
+	var classCode strExpr
+	var styleCode strExpr
+	var attrCode strExpr
 
 	// 查找props中的class 与 style, 将处理为动态class
 	classProps, _ := e.Props.Get("class")
@@ -84,19 +95,13 @@ func genAllAttrCode(e *VueElement) string {
 		// 动态class GoCode
 		classPropsCode := "nil"
 		if classProps != "" {
-			var err error
-			classPropsCode, err = ast.Js2Go(classProps, ScopeKey)
-			if err != nil {
-				panic(err)
-			}
+			classPropsCode = c.jsToGo(classProps)
 		}
 
 		if classPropsCode != "nil" {
-			classCode = fmt.Sprintf(`mixinClass(nil, %s, %s)`, staticClassCode, classPropsCode)
-		} else if staticClassCode == "nil" {
-			classCode = ``
-		} else {
-			classCode = safeStringCode(fmt.Sprintf(` class="%s"`, strings.Join(e.Class, " ")))
+			classCode = codeStr(fmt.Sprintf(`mixinClass(nil, %s, %s)`, staticClassCode, classPropsCode))
+		} else if staticClassCode != "nil" {
+			classCode = textStr(fmt.Sprintf(` class="%s"`, strings.Join(e.Class, " ")))
 		}
 	}
 	// style
@@ -105,74 +110,55 @@ func genAllAttrCode(e *VueElement) string {
 
 		stylePropsCode := "nil"
 		if styleProps != "" {
-			var err error
-			stylePropsCode, err = ast.Js2Go(styleProps, ScopeKey)
-			if err != nil {
-				panic(err)
-			}
+			stylePropsCode = c.jsToGo(styleProps)
 		}
 		if stylePropsCode != "nil" {
 			// todo 可以预先判断static与Props是否有key冲突, 如果key不冲突, 则可以直接把static生成为go代码
-			styleCode = fmt.Sprintf(`mixinStyle(nil, %s, %s)`, staticStyleCode, stylePropsCode)
-		} else if staticStyleCode == "nil" {
-			styleCode = ``
-		} else {
-			styleCode = safeStringCode(fmt.Sprintf(` style="%s"`, genStyle(e.Style, e.StyleKeys)))
+			styleCode = codeStr(fmt.Sprintf(`mixinStyle(nil, %s, %s)`, staticStyleCode, stylePropsCode))
+		} else if staticStyleCode != "nil" {
+			styleCode = textStr(fmt.Sprintf(` style="%s"`, genStyle(e.Style, e.StyleKeys)))
 		}
 	}
 	// attr
 	{
 		// 静态attr GoCode
-		staticAttrCode := genAttrsCode(e.Attrs)
+		staticAttrCode := c.genAttrsCode(e.Attrs)
 		// 动态attr GoCode
 		attrProps := e.Props.Omit("class", "style")
 
 		// todo 可以预先判断static与Props是否有key冲突, 如果key不冲突, 则可以直接把static生成为go代码
 		if len(attrProps) != 0 {
-			attrPropsCode := genProps(attrProps)
-			attrCode = fmt.Sprintf(`mixinAttr(nil, %s, %s)`, staticAttrCode, attrPropsCode)
-		} else if staticAttrCode == "nil" {
-			attrCode = ``
-		} else {
+			attrPropsCode := c.genProps(attrProps)
+			attrCode = codeStr(fmt.Sprintf(`mixinAttr(nil, %s, %s)`, staticAttrCode, attrPropsCode))
+		} else if staticAttrCode != "nil" {
 			// 静态attrs 字符串
-			attrCode = safeStringCode(fmt.Sprintf(` %s`, genAttr(e.Attrs)))
+			attrCode = textStr(fmt.Sprintf(` %s`, genAttr(e.Attrs)))
 		}
 	}
 
-	if classCode != `` {
-		a = classCode
-	}
+	a = classCode.concat(styleCode, attrCode)
 
-	// 样式
-	if styleCode != `` {
-		if a != "" {
-			a += `+`
-		}
-		a += styleCode
-	}
-
-	// attr
-	if attrCode != `` {
-		if a != "" {
-			a += `+`
-		}
-		a += attrCode
-	}
-
-	if a == "" {
-		a = `""`
+	// v-on, 生成eventId属性
+	if len(e.VOn) != 0 {
+		a = a.concat(codeStr(fmt.Sprintf(`vonAttr(r, %s)`, c.genVonDirectivesCode(e.VOn))))
 	}
 
 	return a
 }
 
-func genAttrsCode(a []Attribute) string {
-	if len(a) == 0 {
+// 生成[]Attribute代码, bind是v-bind:key.attr, 值会在运行时计算并转义
+func (c *Compiler) genAttrsCode(a []Attribute, bind ...Prop) string {
+	if len(a) == 0 && len(bind) == 0 {
 		return "nil"
 	}
 	st := "[]Attribute{\n"
 	for _, v := range a {
-		st += fmt.Sprintf(`{Key: %s, Val: %s},`, safeStringCode(v.Key), safeStringCode(v.Val))
+		st += fmt.Sprintf(`{Key: %s, Val: %s},`, strconv.Quote(v.Key), strconv.Quote(v.Val))
+	}
+	for _, v := range bind {
+		valueCode := c.jsToGo(v.Val)
+		keyCode := c.genArgCode(v.Key, v.Dynamic)
+		st += fmt.Sprintf(`{Key: %s, Val: interfaceToStr(%s, true)},`, keyCode, valueCode)
 	}
 	st += "\n}"
 	return st
@@ -200,7 +186,8 @@ func genAttr(attr []Attribute) string {
 			c.WriteString(" ")
 		}
 		if v != "" {
-			c.WriteString(fmt.Sprintf(`%s="%s"`, k, v))
+			// 解析模板时属性值中的&#34;已经被还原为", 需要重新转义
+			c.WriteString(fmt.Sprintf(`%s="%s"`, k, strings.ReplaceAll(v, `"`, "&#34;")))
 		} else {
 			c.WriteString(fmt.Sprintf(`%s`, k))
 		}
@@ -0,0 +1,217 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"regexp"
+	"strings"
+)
+
+// 运行时自带的全局变量, 见newRenderCreator与componentScope
+var builtinGlobals = map[string]bool{
+	"inject":    true,
+	"$attrs":    true,
+	"undefined": true,
+}
+
+// 运行时自带的指令, 见newRenderCreator
+var builtinDirectives = map[string]bool{
+	"v-show":        true,
+	"v-client-data": true,
+}
+
+// html规范中保留的包含-的tag(svg), 不是自定义元素
+var reservedDashTags = map[string]bool{
+	"annotation-xml":   true,
+	"color-profile":    true,
+	"font-face":        true,
+	"font-face-src":    true,
+	"font-face-uri":    true,
+	"font-face-format": true,
+	"font-face-name":   true,
+	"missing-glyph":    true,
+}
+
+// 翻译后的代码中读取的变量: scope.Get("title", "length")中的title
+var scopeGetReg = regexp.MustCompile(regexp.QuoteMeta(ScopeKey+`.Get("`) + `([^"]+)"`)
+
+// 一个组件的静态检查
+type checker struct {
+	c *Compiler
+	// 是否检查变量
+	idents bool
+	// 组件中可以使用的变量: props与<style module>
+	known map[string]bool
+	// 节点声明的变量
+	locals map[string]int
+	// 表达式中读取的变量(不包括节点声明的变量), 如$attrs
+	used map[string]bool
+	// 已经报告过的问题, 同一个问题只报告一次
+	reported map[string]bool
+}
+
+// 模板的静态检查, 发现的问题作为警告记录在Diagnostics中, 而不是在运行时变为nil:
+//   - 表达式中使用了未定义的变量: 不是声明的props, v-for/v-slot/v-let声明的变量, 或者配置的全局变量.
+//     没有声明props的组件可以使用上层传递的任意变量, 不检查.
+//   - 包含-的tag不是注册的组件
+//   - 没有注册的自定义指令
+//
+// 返回模板的表达式中读取的变量, 用于判断组件是否使用了$attrs.
+func (c *Compiler) check(e *VueElement, o *ComponentOptions) (used map[string]bool) {
+	ch := &checker{
+		c:        c,
+		known:    map[string]bool{},
+		locals:   map[string]int{},
+		used:     map[string]bool{},
+		reported: map[string]bool{},
+	}
+	if o != nil && o.Props != nil {
+		ch.idents = true
+		for _, p := range o.Props {
+			ch.known[p.Name] = true
+		}
+	}
+	for name := range c.cssModules {
+		ch.known[name] = true
+	}
+	ch.walk(e)
+	return ch.used
+}
+
+func (ch *checker) warningf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if ch.reported[msg] {
+		return
+	}
+	ch.reported[msg] = true
+	ch.c.warningf("%s", msg)
+}
+
+func (ch *checker) walk(e *VueElement) {
+	if e == nil || e.VPre != "" {
+		return
+	}
+	ch.c.line = e.Line
+
+	names := declaredNames(e)
+	for _, n := range names {
+		ch.locals[n]++
+	}
+	defer func() {
+		for _, n := range names {
+			ch.locals[n]--
+		}
+	}()
+
+	switch e.NodeType {
+	case parser.TextNode:
+		for _, m := range ch.c.interpolationReg().FindAllStringSubmatch(e.Text, -1) {
+			ch.expr(m[1])
+		}
+	case parser.ElementNode:
+		ch.tag(e.TagName)
+		for _, d := range e.Directives {
+			if !builtinDirectives[d.Name] && !ch.c.Directives[d.Name] && ch.c.Plugins[d.Name] == nil {
+				ch.warningf("unknown directive '%s'", d.Name)
+			}
+			if d.DynamicArg {
+				ch.expr(d.Arg)
+			}
+			if d.Value != "" {
+				ch.expr(d.Value)
+			}
+		}
+		for _, ps := range []Props{e.Props, e.Provide} {
+			for _, p := range ps {
+				if p.Code != "" {
+					continue
+				}
+				if p.Dynamic {
+					ch.expr(p.Key)
+				}
+				ch.expr(p.Val)
+			}
+		}
+		for _, v := range e.VOn {
+			if v.DynamicEvent {
+				ch.expr(v.Event)
+			}
+			if v.Args != "" {
+				ch.expr("[" + v.Args + "]")
+			}
+		}
+		if e.VIf != nil {
+			ch.expr(e.VIf.Condition)
+			for _, v := range e.VIf.ElseIf {
+				if v.Types == "elseif" {
+					ch.expr(v.Condition)
+				}
+			}
+		}
+		if e.VFor != nil {
+			ch.expr(e.VFor.ArrayKey)
+		}
+		for _, l := range e.VLet {
+			ch.expr(l.Value)
+			ch.fields(l.Fields)
+		}
+		if e.VSlot != nil {
+			if e.VSlot.Dynamic {
+				ch.expr(e.VSlot.SlotName)
+			}
+			ch.fields(e.VSlot.Fields)
+		}
+		if e.VModel != nil {
+			ch.expr(e.VModel.Value)
+		}
+		ch.expr(e.VHtml)
+		ch.expr(e.VText)
+	}
+
+	for _, child := range e.Children {
+		ch.walk(child)
+	}
+}
+
+func (ch *checker) fields(fs []DestructureField) {
+	for _, f := range fs {
+		ch.expr(f.Default)
+	}
+}
+
+// 包含-的tag可能是拼写错误或者没有注册的组件
+func (ch *checker) tag(name string) {
+	if !strings.Contains(name, "-") || reservedDashTags[name] {
+		return
+	}
+	if _, ok := ch.c.Components[name]; ok {
+		return
+	}
+	if _, ok := builtinComponents[name]; ok {
+		return
+	}
+	ch.warningf("unknown tag <%s>, it's not a registered component", name)
+}
+
+func (ch *checker) expr(js string) {
+	if strings.TrimSpace(js) == "" {
+		return
+	}
+	// 语法错误会在生成代码时报告
+	code, err := ast.Js2Go(js, ScopeKey)
+	if err != nil {
+		return
+	}
+	for _, m := range scopeGetReg.FindAllStringSubmatch(code, -1) {
+		name := m[1]
+		if ch.locals[name] > 0 {
+			continue
+		}
+		ch.used[name] = true
+		if !ch.idents || ch.known[name] || ch.c.Globals[name] || builtinGlobals[name] {
+			continue
+		}
+		ch.warningf("undefined variable '%s': %s", name, js)
+	}
+}
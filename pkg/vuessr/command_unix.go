@@ -0,0 +1,19 @@
+// +build !windows
+
+package vuessr
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// 使用新的进程组执行命令, 结束时可以结束命令启动的所有子进程(如go run启动的程序)
+func shellCommand(line string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", line)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+func terminate(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
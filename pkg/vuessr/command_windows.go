@@ -0,0 +1,15 @@
+package vuessr
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func shellCommand(line string) *exec.Cmd {
+	return exec.Command("cmd", "/C", line)
+}
+
+// 结束命令与它启动的所有子进程
+func terminate(cmd *exec.Cmd) {
+	exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -5,36 +5,123 @@ import (
 	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
 	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
 	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+// 编译器, Components/Options/Globals/Directives等选项在编译开始之后只读,
+// 其他是正在编译的组件的状态, 并行编译时每个组件使用fork出的编译器.
 type Compiler struct {
 	// 组件的名字, 包含了驼峰/蛇形
 	// 如果在编译期间遇到的tag在components中, 就会使用组件方法.
 	// key是tag名字, value是驼峰
 	Components map[string]string
+	// 组件在<script>中声明的选项, key是驼峰的组件名, 用于检查上层传递的props
+	Options map[string]*ComponentOptions
+	// 编译时发现的问题
+	Diagnostics Diagnostics
+	// 在运行时注册的全局变量/方法与自定义指令, 用于静态检查, 见Config
+	Globals    map[string]bool
+	Directives map[string]bool
+	// 编译时处理的指令, key是带v-前缀的指令名, 见DirectivePlugin
+	Plugins map[string]*DirectivePlugin
+	// 解析模板的选项: 空白与注释的处理方式
+	Parser parser.GoHtml
+	// 插值的分隔符, 为空时使用{{ }}
+	Delimiters [2]string
+	// 插值的正则与编译它时的分隔符, Delimiters改变时重新编译, 见interpolationReg
+	interpolation     *regexp.Regexp
+	interpolationWith [2]string
+	// 组件文件的路径 => 组件名, 用于解析组件局部注册的组件
+	files map[string]string
+	// 导入的其他包中的组件名
+	external map[string]bool
+	// 生成的代码使用共享运行时
+	runtime bool
+	// 没有声明props的组件也把所有props渲染为attr, 见Config.InheritAllAttrs
+	inheritAllAttrs bool
+
+	// 正在编译的组件名字与v-once的计数, 用于生成v-once缓存的key
+	component string
+	file      string
+	onceId    int
+	// 正在编译的节点的行号, 用于Diagnostic
+	line int
+	// 正在编译的v-for/v-slot节点的层数, 其中的节点每次渲染会执行多次, 不能使用v-once
+	loops int
+	// <style scoped>组件的scopeId, 会作为attr添加到组件中的所有节点上
+	scopeId string
+	// <style module>中的class, 见SFC.CssModules
+	cssModules map[string]map[string]string
+	// 声明了类型的props, 在组件开始时转为有类型的go变量, 表达式中会直接使用变量而不是scope.Get
+	vars map[string]ast.TypedVar
+	// 被v-for/v-let/v-slot声明的同名变量覆盖的名字, 此时需要从scope中读取
+	shadowed map[string]int
+	// 模板中使用的tag, 用于记录增量编译的依赖
+	tags []string
 }
 
 type Prop struct {
 	Key, Val string
+	// v-bind="obj", 展开对象中所有的key, 此时Key为空
+	Spread bool
+	// v-bind:[key], Key是js表达式
+	Dynamic bool
+	// v-bind:key.attr, 在组件上强制作为attr传递, 而不是props
+	Attr bool
+	// 编译器生成的go代码(如v-model), 不为空时会忽略Val
+	Code string
 }
 
 type Props []Prop
 
 func (p Props) Get(key string) (val string, exist bool) {
 	for _, v := range p {
-		if v.Key == key {
+		if v.Key == key && !v.Dynamic {
 			return v.Val, true
 		}
 	}
 	return
 }
 
+// 获取传递的prop, 不包括v-bind:key.attr
+func (p Props) prop(key string) (Prop, bool) {
+	for _, v := range p {
+		if v.Key == key && !v.Dynamic && !v.Spread && !v.Attr {
+			return v, true
+		}
+	}
+	return Prop{}, false
+}
+
+// 是否有v-bind="obj"或者v-bind:[key], 它们在编译时无法知道会有哪些key
+func (p Props) HasSpread() bool {
+	for _, v := range p {
+		if v.Spread || v.Dynamic {
+			return true
+		}
+	}
+	return false
+}
+
+// 分离出v-bind:key.attr
+func (p Props) splitAttr() (attr Props, props Props) {
+	for _, v := range p {
+		if v.Attr {
+			attr = append(attr, v)
+		} else {
+			props = append(props, v)
+		}
+	}
+	return
+}
+
 func (p *Props) Del(key string) {
 	for index, k := range *p {
-		if k.Key == key {
+		if k.Key == key && !k.Dynamic {
 			*p = append((*p)[:index], (*p)[index+1:]...)
 			break
 		}
@@ -51,14 +138,21 @@ type OptionsGen struct {
 	DefaultSlotCode string            // 子节点code, 用于默认的插槽
 	NamedSlotCode   map[string]string // 具名插槽
 	Directives      []Directive       // 指令代码
+	VOn             []VOnDirective    // v-on
+	Provide         Props             // v-provide
+	// 翻译表达式的Compiler, 表达式的错误会记录在它的Diagnostics中
+	c *Compiler
 }
 
 func sliceStringToGoCode(m []string) string {
 	if len(m) == 0 {
 		return "nil"
 	}
-	c := strings.Join(m, `","`)
-	c = fmt.Sprintf(`[]string{"%s"}`, c)
+	c := "[]string{"
+	for _, v := range m {
+		c += fmt.Sprintf(`%q,`, v)
+	}
+	c += "}"
 	return c
 }
 
@@ -71,7 +165,7 @@ func mapStringToGoCode(m map[string]string) string {
 
 	for _, k := range getSortedKey(m) {
 		v := m[k]
-		c += fmt.Sprintf(`"%s": "%s",`, k, v)
+		c += fmt.Sprintf(`%q: %q,`, k, v)
 	}
 	c += "}"
 
@@ -103,7 +197,7 @@ func mapGoCodeToCode(m map[string]string, valueType string, newLine bool) string
 
 	for _, k := range getSortedKey(m) {
 		v := m[k]
-		c += fmt.Sprintf(`"%s": %s,`, k, v)
+		c += fmt.Sprintf(`%q: %s,`, k, v)
 		if newLine {
 			c += "\n"
 		}
@@ -117,7 +211,7 @@ func sliceToGoCode(m []string) string {
 	c := "[]string"
 	c += "{"
 	for _, v := range m {
-		c += fmt.Sprintf(`"%s", `, v)
+		c += fmt.Sprintf(`%q, `, v)
 	}
 	c += "}"
 
@@ -125,7 +219,7 @@ func sliceToGoCode(m []string) string {
 }
 
 // 根据js代码生成go代码(基于js AST)
-func mapJsCodeToCode(m map[string]string) string {
+func (c *Compiler) mapJsCodeToCode(m map[string]string) string {
 	if len(m) == 0 {
 		return "nil"
 	}
@@ -133,11 +227,8 @@ func mapJsCodeToCode(m map[string]string) string {
 	props += "{"
 	for _, k := range getSortedKey(m) {
 		v := m[k]
-		valueCode, err := ast.Js2Go(v, ScopeKey)
-		if err != nil {
-			log.Panicf("%v, %s", err, v)
-		}
-		props += fmt.Sprintf(`"%s": %s,`, k, valueCode)
+		valueCode := c.jsToGo(v)
+		props += fmt.Sprintf(`%q: %s,`, k, valueCode)
 	}
 	props += "}"
 
@@ -148,30 +239,34 @@ func mapJsCodeToCode(m map[string]string) string {
 func (o *OptionsGen) ToGoCode() string {
 	c := "&Options{\n"
 
+	// v-bind:key.attr会作为attr传递
+	attrProps, props := o.Props.splitAttr()
+	o.Props = props
+
 	if len(o.Props) != 0 {
 		// class
 		classJs, ok := o.Props.Get("class")
 		if ok {
 			o.Props.Del("class")
-			cCode := genPropsClassCode(classJs)
+			cCode := o.c.genPropsClassCode(classJs)
 			c += fmt.Sprintf("PropsClass: %s, \n", cCode)
 		}
 		styleJs, ok := o.Props.Get("style")
 		// style
 		if ok {
 			o.Props.Del("style")
-			cStyle := genPropsStyleCode(styleJs)
+			cStyle := o.c.genPropsStyleCode(styleJs)
 			c += fmt.Sprintf("PropsStyle: %s, \n", cStyle)
 		}
 
 		// 除了class/style的props
 		if len(o.Props) != 0 {
-			c += fmt.Sprintf("Props: %s, \n", genProps(o.Props))
+			c += fmt.Sprintf("Props: %s, \n", o.c.genProps(o.Props))
 		}
 	}
 
-	if len(o.Attrs) != 0 {
-		c += fmt.Sprintf("Attrs: %s,\n", genAttrsCode(o.Attrs))
+	if len(o.Attrs) != 0 || len(attrProps) != 0 {
+		c += fmt.Sprintf("Attrs: %s,\n", o.c.genAttrsCode(o.Attrs, attrProps...))
 	}
 	if len(o.Class) != 0 {
 		c += fmt.Sprintf("Class: %s,\n", sliceToGoCode(o.Class))
@@ -193,7 +288,7 @@ func (o *OptionsGen) ToGoCode() string {
 	for k, v := range o.NamedSlotCode {
 		slot[k] = v
 	}
-	c += fmt.Sprintf("Slots: %s,\n", mapGoCodeToCode(slot, "NamedSlotFunc", false))
+	c += fmt.Sprintf("Slots: %s,\n", genSlotsCode(slot))
 
 	// p 父级option
 	c += fmt.Sprintf("P: options,\n")
@@ -203,21 +298,23 @@ func (o *OptionsGen) ToGoCode() string {
 		// 数组
 		dir := "[]directive{\n"
 		for _, v := range o.Directives {
-			valueCode := "nil"
-			if v.Value != "" {
-				var err error
-				valueCode, err = ast.Js2Go(v.Value, ScopeKey)
-				if err != nil {
-					panic(err)
-				}
-			}
-			dir += fmt.Sprintf("{Name: \"%s\", Value: %s, Arg: \"%s\"},\n", v.Name, valueCode, v.Arg)
+			dir += o.c.genDirectiveCode(v) + ",\n"
 		}
 		dir += "}"
 
 		c += fmt.Sprintf("Directives: %s,\n", dir)
 	}
 
+	// v-on
+	if len(o.VOn) != 0 {
+		c += fmt.Sprintf("VonDirectives: %s,\n", o.c.genVonDirectivesCode(o.VOn))
+	}
+
+	// provide
+	if len(o.Provide) != 0 {
+		c += fmt.Sprintf("Provide: %s,\n", o.c.genProvideCode(o.Provide))
+	}
+
 	// Scope
 	c += fmt.Sprintf("Scope: %s,\n", ScopeKey)
 
@@ -237,30 +334,34 @@ func (o *OptionsGen) ToGoCode() string {
 func (o *OptionsGen) ToGoCodeForRoot() string {
 	c := "&Options{\n"
 
+	// v-bind:key.attr会作为attr传递
+	attrProps, props := o.Props.splitAttr()
+	o.Props = props
+
 	if len(o.Props) != 0 {
 		// class
 		classJs, ok := o.Props.Get("class")
 		if ok {
 			o.Props.Del("class")
-			cCode := genPropsClassCode(classJs)
+			cCode := o.c.genPropsClassCode(classJs)
 			c += fmt.Sprintf("PropsClass: %s, \n", cCode)
 		}
 		styleJs, ok := o.Props.Get("style")
 		// style
 		if ok {
 			o.Props.Del("style")
-			cStyle := genPropsStyleCode(styleJs)
+			cStyle := o.c.genPropsStyleCode(styleJs)
 			c += fmt.Sprintf("PropsStyle: %s, \n", cStyle)
 		}
 
 		// 除了class/style的props
 		if len(o.Props) != 0 {
-			c += fmt.Sprintf("Props: %s, \n", genProps(o.Props))
+			c += fmt.Sprintf("Props: %s, \n", o.c.genProps(o.Props))
 		}
 	}
 
-	if len(o.Attrs) != 0 {
-		c += fmt.Sprintf("Attrs: %s,\n", genAttrsCode(o.Attrs))
+	if len(o.Attrs) != 0 || len(attrProps) != 0 {
+		c += fmt.Sprintf("Attrs: %s,\n", o.c.genAttrsCode(o.Attrs, attrProps...))
 	}
 	if len(o.Class) != 0 {
 		c += fmt.Sprintf("Class: %s,\n", sliceToGoCode(o.Class))
@@ -282,7 +383,7 @@ func (o *OptionsGen) ToGoCodeForRoot() string {
 	for k, v := range o.NamedSlotCode {
 		slot[k] = v
 	}
-	c += fmt.Sprintf("Slots: %s,\n", mapGoCodeToCode(slot, "NamedSlotFunc", false))
+	c += fmt.Sprintf("Slots: %s,\n", genSlotsCode(slot))
 
 	// p 父级option
 	c += fmt.Sprintf("P: options,\n")
@@ -292,21 +393,20 @@ func (o *OptionsGen) ToGoCodeForRoot() string {
 		// 数组
 		dir := "append(options.Directives,\n"
 		for _, v := range o.Directives {
-			valueCode := "nil"
-			if v.Value != "" {
-				var err error
-				valueCode, err = ast.Js2Go(v.Value, ScopeKey)
-				if err != nil {
-					panic(err)
-				}
-			}
-			dir += fmt.Sprintf("directive{Name: \"%s\", Value: %s, Arg: \"%s\"},\n", v.Name, valueCode, v.Arg)
+			dir += "directive" + o.c.genDirectiveCode(v) + ",\n"
 		}
 		dir += ")"
 
 		c += fmt.Sprintf("Directives: %s,\n", dir)
 	}
 
+	// v-on, 和指令一样会合并组件上的v-on
+	if len(o.VOn) != 0 {
+		c += fmt.Sprintf("VonDirectives: append(options.VonDirectives, %s...),\n", o.c.genVonDirectivesCode(o.VOn))
+	} else {
+		c += "VonDirectives: options.VonDirectives,\n"
+	}
+
 	// Scope
 	c += fmt.Sprintf("Scope: %s,\n", ScopeKey)
 
@@ -314,6 +414,334 @@ func (o *OptionsGen) ToGoCodeForRoot() string {
 	return c
 }
 
+// 生成v-once代码, 在第一次渲染后缓存html, key是包的import path(xxPkgPath, 见genCreator), 组件名与节点的序号.
+// 使用共享运行时的多个包中可能有同名的组件, 所以key中需要有包名
+func genVOnce(key string, srcCode string) string {
+	return fmt.Sprintf(`_once(r, w, xxPkgPath+%q, func(w Writer) {
+%s
+})`, key, srcCode)
+}
+
+// 生成v-provide的值: map[string]interface{}{"theme": scope.Get("theme")}
+func (c *Compiler) genProvideCode(provide Props) string {
+	m := make(map[string]string, len(provide))
+	for _, p := range provide {
+		m[p.Key] = p.Val
+	}
+	return c.mapJsCodeToCode(m)
+}
+
+// 生成v-provide代码
+// 组件可以直接将provide放在Options中, 而元素没有自己的Options, 所以需要用一个带有Provide的Options覆盖options变量, 子孙节点的P就会是它.
+func (c *Compiler) genVProvide(provide Props, srcCode string) string {
+	return fmt.Sprintf(`{
+options := provideOptions(options, %s)
+_ = options
+%s
+}`, c.genProvideCode(provide), srcCode)
+}
+
+var moduleClassReg = regexp.MustCompile(`^(\$?[\w]+)(?:\.([\w-]+)|\[['"]([\w-]+)['"]\])$`)
+
+// 如果:class是$style.title或$style['title'], 则返回重命名后的class
+func (c *Compiler) staticModuleClass(e *VueElement) (class string, ok bool) {
+	js, exist := e.Props.Get("class")
+	if !exist {
+		return
+	}
+	m := moduleClassReg.FindStringSubmatch(strings.TrimSpace(js))
+	if m == nil {
+		return
+	}
+	name := m[2]
+	if name == "" {
+		name = m[3]
+	}
+	class, ok = c.cssModules[m[1]][name]
+	return
+}
+
+// 检查<style module>中没有被使用的class, 在模板中使用动态的key(如$style[name])时不检查
+func unusedModuleClasses(modules map[string]map[string]string, code string) (unused []string) {
+	for module, classes := range modules {
+		// $style / $style[name]
+		if usedDynamically(code, fmt.Sprintf(`%s.Get(%q`, ScopeKey, module)) {
+			continue
+		}
+		for class, hashed := range classes {
+			if strings.Contains(code, fmt.Sprintf(`%s.Get(%q, %q)`, ScopeKey, module, class)) || strings.Contains(code, hashed) {
+				continue
+			}
+			unused = append(unused, module+"."+class)
+		}
+	}
+	sort.Strings(unused)
+	return
+}
+
+// $style或者$style[name]: prefix之后是")"或者不是字符串字面量的参数
+func usedDynamically(code, prefix string) bool {
+	for i := strings.Index(code, prefix); i != -1; {
+		rest := code[i+len(prefix):]
+		if strings.HasPrefix(rest, ")") || strings.HasPrefix(rest, ", ") && !strings.HasPrefix(rest, `, "`) {
+			return true
+		}
+		next := strings.Index(rest, prefix)
+		if next == -1 {
+			break
+		}
+		i += len(prefix) + next
+	}
+	return false
+}
+
+// 检查传递给组件的props: 是否缺少required的prop, 字面量, 有类型的表达式与静态attr的类型是否和声明的一样.
+// 使用了v-bind="obj"时无法知道传递了哪些prop, 不检查缺少的prop.
+func (c *Compiler) checkProps(componentName string, e *VueElement) {
+	o := c.Options[componentName]
+	if o == nil || o.Props == nil {
+		return
+	}
+
+	for _, decl := range o.Props {
+		if p, ok := e.Props.prop(decl.Name); ok {
+			if p.Code == "" {
+				// 字面量或者有类型的变量(如声明了类型的props)
+				t := jsLiteralType(p.Val)
+				if t == "" {
+					_, typ := c.js2Go(p.Val)
+					t = jsTypeOfGo(typ)
+				}
+				if t != "" && !decl.Accept(t) {
+					c.errorf("prop '%s' of <%s> should be %s, but got %s: %s", decl.Name, e.TagName, strings.Join(decl.Types, " | "), t, p.Val)
+				}
+			}
+			continue
+		}
+		if attr, ok := getAttr(e.Attrs, decl.Name); ok {
+			// <x disabled>
+			if attr.Val == "" && decl.Accept("Boolean") {
+				continue
+			}
+			if !decl.Accept("String") {
+				c.errorf("prop '%s' of <%s> should be %s, but got String: \"%s\", use :%s=\"...\" instead", decl.Name, e.TagName, strings.Join(decl.Types, " | "), attr.Val, decl.Name)
+			}
+			continue
+		}
+		if decl.Required && decl.Default == "" && !e.Props.HasSpread() {
+			c.errorf("missing required prop '%s' of <%s>", decl.Name, e.TagName)
+		}
+	}
+}
+
+// js字面量的类型, 不是字面量(如变量)时返回空
+func jsLiteralType(js string) string {
+	v, err := ast.ParseJsValue(js)
+	if err != nil {
+		return ""
+	}
+	switch v.Kind {
+	case "string":
+		return "String"
+	case "number":
+		return "Number"
+	case "bool":
+		return "Boolean"
+	case "array":
+		return "Array"
+	case "object":
+		return "Object"
+	}
+	return ""
+}
+
+func getAttr(attrs []Attribute, key string) (Attribute, bool) {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// v-client-data的参数是接收数据的组件, 没有写参数时默认是当前组件, 写在组件上时是这个组件
+func (c *Compiler) withClientData(e *VueElement) *VueElement {
+	for i, d := range e.Directives {
+		if d.Name != "v-client-data" || d.Arg != "" {
+			continue
+		}
+		target := c.component
+		if name, ok := c.Components[e.TagName]; ok {
+			target = name
+		}
+		n := *e
+		n.Directives = append([]Directive{}, e.Directives...)
+		n.Directives[i].Arg = target
+		e = &n
+	}
+	return e
+}
+
+// v-model, 根据表单元素类型生成:
+// - input: value
+// - checkbox: checked, model是数组时判断是否包含value
+// - radio: checked
+// - select: 由下面的option生成selected
+// - textarea: 子节点, 会作为children返回
+// - 组件: value prop
+func (c *Compiler) withVModel(e *VueElement) (ne *VueElement, children codeBlock) {
+	n := *e
+	ne = &n
+	ne.Props = append(Props{}, e.Props...)
+	ne.Attrs = append([]Attribute{}, e.Attrs...)
+
+	// select下的option
+	if m := e.VModelSelect; m != nil {
+		valueCode := c.vModelValueCode(e)
+		if valueCode == "" {
+			valueCode = fmt.Sprintf("%q", strings.Trim(childrenText(e), " \n\t"))
+		}
+		ne.setVModelProp("selected", fmt.Sprintf("vModelEqual(%s, %s)", c.jsToGo(m.Value), valueCode))
+	}
+
+	m := e.VModel
+	if m == nil {
+		return
+	}
+	model := c.jsToGo(m.Value)
+
+	if _, ok := c.Components[e.TagName]; ok || e.TagName == "component" {
+		ne.Props.Del("value")
+		ne.Props = append(ne.Props, Prop{Key: "value", Val: m.Value})
+		return
+	}
+
+	switch e.TagName {
+	case "select":
+	case "textarea":
+		children = writeBlock(codeStr(fmt.Sprintf(`interfaceToStr(vModelValue(%s, %v, %v), true)`, model, m.HasModifier("trim"), m.HasModifier("number"))))
+	case "input":
+		inputType := ""
+		for _, a := range e.Attrs {
+			if a.Key == "type" {
+				inputType = a.Val
+			}
+		}
+		switch inputType {
+		case "checkbox", "radio":
+			valueCode := c.vModelValueCode(e)
+			if valueCode == "" {
+				// 浏览器中checkbox/radio默认的value
+				valueCode = `"on"`
+			}
+			f := "vModelChecked"
+			if inputType == "radio" {
+				f = "vModelEqual"
+			}
+			ne.setVModelProp("checked", fmt.Sprintf("%s(%s, %s)", f, model, valueCode))
+		default:
+			ne.setVModelProp("value", fmt.Sprintf("vModelValue(%s, %v, %v)", model, m.HasModifier("trim"), m.HasModifier("number")))
+		}
+	}
+
+	return
+}
+
+// 设置v-model生成的prop, 会覆盖同名的attr与prop
+func (e *VueElement) setVModelProp(key string, code string) {
+	e.Props.Del(key)
+	for i, a := range e.Attrs {
+		if a.Key == key {
+			e.Attrs = append(e.Attrs[:i], e.Attrs[i+1:]...)
+			break
+		}
+	}
+	e.Props = append(e.Props, Prop{Key: key, Code: code})
+}
+
+// 读取节点上value的go代码, 支持value="a"与:value="a", 没有则返回空
+func (c *Compiler) vModelValueCode(e *VueElement) string {
+	if v, ok := e.Props.Get("value"); ok {
+		return c.jsToGo(v)
+	}
+	for _, a := range e.Attrs {
+		if a.Key == "value" {
+			return fmt.Sprintf("%q", a.Val)
+		}
+	}
+	return ""
+}
+
+// 节点下的纯文本
+func childrenText(e *VueElement) string {
+	t := ""
+	for _, c := range e.Children {
+		if c.NodeType == parser.TextNode {
+			t += c.Text
+		}
+	}
+	return t
+}
+
+// 翻译js表达式, 错误作为Diagnostic报告, 并返回nil使组件的其他代码依然可以生成
+func (c *Compiler) jsToGo(js string) string {
+	code, err := ast.Js2Go(js, ScopeKey)
+	if err != nil {
+		c.errorf("invalid expression %q: %v", js, err)
+		return "nil"
+	}
+	return code
+}
+
+// 生成指令代码
+// e.g. {Name: "v-tooltip", Value: scope.Get("msg"), Arg: "top", Modifiers: map[string]bool{"lazy": true}}
+func (c *Compiler) genDirectiveCode(d Directive) string {
+	valueCode := "nil"
+	if d.Value != "" {
+		valueCode = c.jsToGo(d.Value)
+	}
+
+	code := fmt.Sprintf("{Name: %q, Value: %s, Arg: %s", d.Name, valueCode, c.genArgCode(d.Arg, d.DynamicArg))
+	if len(d.Modifiers) != 0 {
+		m := "map[string]bool{"
+		for _, v := range d.Modifiers {
+			m += fmt.Sprintf("%q: true,", v)
+		}
+		m += "}"
+		code += fmt.Sprintf(", Modifiers: %s", m)
+	}
+	code += "}"
+	return code
+}
+
+// 生成指令参数代码, 动态参数: v-xx:[arg]会在运行时计算
+func (c *Compiler) genArgCode(arg string, dynamic bool) string {
+	if !dynamic {
+		return strconv.Quote(arg)
+	}
+	code := c.jsToGo(arg)
+	return fmt.Sprintf("interfaceToStr(%s)", code)
+}
+
+// 生成v-on代码, 参数将被翻译成go代码在服务端计算
+// e.g. []vonDirective{{Event: "click", Func: "buy", Args: []interface{}{scope.Get("id")}}}
+func (c *Compiler) genVonDirectivesCode(vs []VOnDirective) string {
+	code := "[]vonDirective{\n"
+	for _, v := range vs {
+		argsCode := "nil"
+		if strings.Trim(v.Args, " ") != "" {
+			argsCode = c.jsToGo("[" + v.Args + "]")
+		}
+		modifiersCode := ""
+		if len(v.Modifiers) != 0 {
+			modifiersCode = fmt.Sprintf(", Modifiers: %s", sliceToGoCode(v.Modifiers))
+		}
+		code += fmt.Sprintf("{Event: %s, Func: %q, Args: %s%s},\n", c.genArgCode(v.Event, v.DynamicEvent), strings.Trim(v.Func, " "), argsCode, modifiersCode)
+	}
+	code += "}"
+	return code
+}
+
 type Code struct {
 	Src  string
 	Type string // string 纯字符串 / async 异步(PromiseGroup)
@@ -343,6 +771,25 @@ var voidElements = map[string]bool{
 	"wbr":    true,
 }
 
+// 自带组件, key是tag名字, value是运行时的渲染方法
+var builtinComponents = map[string]string{
+	"component":       "_component",
+	"slot":            "_slot",
+	"async":           "_async",
+	"teleport":        "_teleport",
+	"teleport-target": "_teleportTarget",
+	"von-outlet":      "_vonOutlet",
+	"style-outlet":    "_styleOutlet",
+	"script-outlet":   "_scriptOutlet",
+}
+
+// <template>与除了<component>之外的自带组件没有对应的节点, 不能绑定事件, v-on会被忽略
+func (c *Compiler) ignoreVOn(e *VueElement) {
+	if len(e.VOn) != 0 {
+		c.warningf("v-on on <%s> is ignored, it does not render an element", e.TagName)
+	}
+}
+
 // 组件渲染,
 // 如果该组件被components注册, 则使用Element渲染.
 //
@@ -355,9 +802,30 @@ var voidElements = map[string]bool{
 // slot: 子级代码
 // 返回的code 是一行代码,
 func (c *Compiler) GenEleCode(e *VueElement) (code string, namedSlotCode map[string]string) {
-	var eleCode = ""
+	b, namedSlotCode := c.genEle(e)
+	return b.Code(), namedSlotCode
+}
+
+// 生成节点的代码, 子节点中相邻的输出语句会合并, 见codeBlock
+func (c *Compiler) genEle(e *VueElement) (ele codeBlock, namedSlotCode map[string]string) {
+	c.line = e.Line
+	// 节点与子节点中, 被节点声明的变量覆盖的props不能使用有类型的变量
+	names := declaredNames(e)
+	c.shadow(names, 1)
+	defer c.shadow(names, -1)
+
+	// v-once的缓存和渲染时的数据无关, 在v-for/v-slot中每次执行都会得到第一次的结果
+	if e.VOnce && (c.loops != 0 || e.VSlot != nil) {
+		c.errorf("v-once inside v-for or v-slot is not supported, all iterations would render the cached html of the first one")
+	}
+	if e.VFor != nil || e.VSlot != nil {
+		c.loops++
+		defer func() { c.loops-- }()
+	}
+
+	var isComponent bool
 
-	defaultSlotCode := ""
+	var defaultSlot codeBlock
 
 	namedSlotCode = map[string]string{}
 	if len(e.Children) != 0 {
@@ -366,82 +834,142 @@ func (c *Compiler) GenEleCode(e *VueElement) (code string, namedSlotCode map[str
 			if v.VElse || v.VElseIf {
 				continue
 			}
-			childCode, childNamedSlotCode := c.GenEleCode(v)
+			child, childNamedSlotCode := c.genEle(v)
 			for k, v := range childNamedSlotCode {
 				namedSlotCode[k] = v
 			}
+			defaultSlot = defaultSlot.append(child)
+		}
+		c.line = e.Line
+	}
 
-			if childCode == "" {
-				continue
-			}
-			defaultSlotCode += childCode + "\n"
+	// v-model会修改props, 为了不影响节点本身(节点代码可能会生成多次, 如v-if), 使用复制的节点
+	if e.VModel != nil || e.VModelSelect != nil {
+		var children codeBlock
+		e, children = c.withVModel(e)
+		if len(children) != 0 {
+			defaultSlot = children
 		}
 	}
-	defaultSlotCode = strings.TrimSuffix(defaultSlotCode, "\n")
 
 	switch e.NodeType {
 	case parser.TextNode:
-		// 纯字符串节点
-		// 将文本处理成go代码的字符串写法: "xxx"
-		// 注意{{表达式中的"不应该被处理, 因为这是js代码, 需要解析成为JS AST.
-		text := safeStringCode(e.Text)
-		// 处理变量
-		text = injectVal(text)
-		eleCode = fmt.Sprintf(`w.WriteString(%s)`, text)
+		// 纯字符串节点, 文本与插值
+		ele = writeBlock(c.interpolate(e.Text))
 	case parser.DocumentNode:
 		log.Infof("DocumentNode %+v", e)
 	case parser.ElementNode:
+		// 编译时处理的指令
+		e = c.withPlugins(e)
+
+		// scoped css
+		if c.scopeId != "" && e.VPre == "" {
+			if _, ok := builtinComponents[e.TagName]; (!ok || e.TagName == "component") && e.TagName != "template" {
+				n := *e
+				n.Attrs = append(append([]Attribute{}, e.Attrs...), Attribute{Key: c.scopeId})
+				e = &n
+			}
+		}
+
+		// :class="$style.title", 在编译时就可以确定class
+		if c.cssModules != nil {
+			if class, ok := c.staticModuleClass(e); ok {
+				n := *e
+				n.Props = append(Props{}, e.Props...)
+				n.Props.Del("class")
+				n.Class = append(append([]string{}, e.Class...), class)
+				e = &n
+			}
+		}
+
+		e = c.withClientData(e)
+
 		// 判断是否是自定义组件
 		componentName, exist := c.Components[e.TagName]
-		if exist {
+		if e.VPre != "" {
+			// v-pre, 原样输出
+			ele = writeBlock(textStr(e.VPre))
+		} else if exist {
+			isComponent = true
+			if isDefaultSlotOnComponent(e) {
+				defaultSlot = rawBlock(c.genVSlotScope(e.VSlot)).append(defaultSlot)
+			}
+			c.checkProps(componentName, e)
 			options := OptionsGen{
 				Class:           e.Class,
 				Attrs:           e.Attrs,
 				Props:           e.Props,
 				Style:           e.Style,
-				DefaultSlotCode: defaultSlotCode,
+				DefaultSlotCode: defaultSlot.Code(),
 				NamedSlotCode:   namedSlotCode,
 				Directives:      e.Directives,
+				VOn:             e.VOn,
+				Provide:         e.Provide,
+				c:               c,
 			}
 			optionsCode := options.ToGoCode()
-			eleCode = fmt.Sprintf("xx_%s(r, w, %s)", componentName, optionsCode)
-		} else if e.TagName == "component" || e.TagName == "slot" || e.TagName == "async" {
+			if c.external[componentName] {
+				// 导入的包中的组件, 在运行时由RenderCreator.Use注册
+				ele = rawBlock(fmt.Sprintf("r.Render(%q, w, %s)", componentName, optionsCode))
+			} else {
+				ele = rawBlock(fmt.Sprintf("xx_%s(r, w, %s)", componentName, optionsCode))
+			}
+		} else if builtinFunc, ok := builtinComponents[e.TagName]; ok {
 			// 自带组件
+			// 动态组件的Options会直接传递给组件, 所以也可以在Options中处理provide
+			// 动态组件的v-on也会传递给组件, 绑定在组件的root节点上
+			isComponent = e.TagName == "component"
+			var provide Props
+			var von []VOnDirective
+			if isComponent {
+				provide = e.Provide
+				von = e.VOn
+				if isDefaultSlotOnComponent(e) {
+					defaultSlot = rawBlock(c.genVSlotScope(e.VSlot)).append(defaultSlot)
+				}
+			} else {
+				c.ignoreVOn(e)
+			}
 			options := OptionsGen{
 				Class:           e.Class,
 				Attrs:           e.Attrs,
 				Props:           e.Props,
 				Style:           e.Style,
-				DefaultSlotCode: defaultSlotCode,
+				DefaultSlotCode: defaultSlot.Code(),
 				NamedSlotCode:   namedSlotCode,
 				Directives:      e.Directives,
+				VOn:             von,
+				Provide:         provide,
+				c:               c,
 			}
 			optionsCode := options.ToGoCode()
-			eleCode = fmt.Sprintf("_%s(r, w, %s)", e.TagName, optionsCode)
+			ele = rawBlock(fmt.Sprintf("%s(r, w, %s)", builtinFunc, optionsCode))
 		} else if e.TagName == "template" {
 			// template和其他自带组件不一样: 它可以包含额外多个功能: 使用v-html/v-text
-			children := defaultSlotCode
+			c.ignoreVOn(e)
+			children := defaultSlot
 			if e.VHtml != "" {
-				children = genVHtml(e.VHtml)
+				children = c.genVHtml(e.VHtml)
 			} else if e.VText != "" {
-				children = genVText(e.VText)
+				children = c.genVText(e.VText)
 			}
 
 			// 如果没有指令, 则直接输出子级
 			if len(e.Directives) == 0 {
-				eleCode = children
+				ele = children
 			} else {
 				options := OptionsGen{
 					Class:           nil, // dom相关都不需要处理
 					Attrs:           nil, // dom相关都不需要处理
 					Props:           e.Props,
 					Style:           nil, // dom相关都不需要处理
-					DefaultSlotCode: children,
+					DefaultSlotCode: children.Code(),
 					NamedSlotCode:   namedSlotCode,
 					Directives:      e.Directives,
+					c:               c,
 				}
 				optionsCode := options.ToGoCode()
-				eleCode = fmt.Sprintf("_%s(r, w, %s)", e.TagName, optionsCode)
+				ele = rawBlock(fmt.Sprintf("_%s(r, w, %s)", e.TagName, optionsCode))
 			}
 
 		} else {
@@ -453,12 +981,13 @@ func (c *Compiler) GenEleCode(e *VueElement) (code string, namedSlotCode map[str
 			// - 组件的root节点: root节点会继承上层传递的(class/style/attr)
 
 			// 动态节点
-			if e.IsRoot || len(e.Directives) != 0 {
-				children := defaultSlotCode
+			// - v-bind="obj": 编译时不知道会有哪些attr(包括class/style)
+			if e.IsRoot || len(e.Directives) != 0 || e.Props.HasSpread() {
+				children := defaultSlot
 				if e.VHtml != "" {
-					children = genVHtml(e.VHtml)
+					children = c.genVHtml(e.VHtml)
 				} else if e.VText != "" {
-					children = genVText(e.VText)
+					children = c.genVText(e.VText)
 				}
 
 				options := OptionsGen{
@@ -467,83 +996,98 @@ func (c *Compiler) GenEleCode(e *VueElement) (code string, namedSlotCode map[str
 					Class:           e.Class,
 					Style:           e.Style,
 					Slot:            nil,
-					DefaultSlotCode: children,
+					DefaultSlotCode: children.Code(),
 					NamedSlotCode:   namedSlotCode,
 					Directives:      e.Directives,
+					VOn:             e.VOn,
+					c:               c,
 				}
 
 				if e.IsRoot {
 					optionsCode := options.ToGoCodeForRoot()
-					eleCode = fmt.Sprintf(`_tag(r, w, "%s", true, %s)`, e.TagName, optionsCode)
+					ele = rawBlock(fmt.Sprintf(`_tag(r, w, %q, true, %s)`, e.TagName, optionsCode))
 				} else {
 					optionsCode := options.ToGoCode()
-					eleCode = fmt.Sprintf(`_tag(r, w, "%s", false, %s)`, e.TagName, optionsCode)
+					ele = rawBlock(fmt.Sprintf(`_tag(r, w, %q, false, %s)`, e.TagName, optionsCode))
 				}
 
 			} else {
 				// 静态节点
-				attrs := genAllAttrCode(e)
-				children := defaultSlotCode
+				open := textStr("<" + e.TagName).concat(c.genAllAttrCode(e))
+				children := defaultSlot
 				if e.VHtml != "" {
-					children = genVHtml(e.VHtml)
+					children = c.genVHtml(e.VHtml)
 				} else if e.VText != "" {
-					children = genVText(e.VText)
+					children = c.genVText(e.VText)
 				}
 
-				if children != "" {
-					eleCode = fmt.Sprintf("w.WriteString(\"<%s\"+%s+\">\")\n%s\nw.WriteString(\"</%s>\")", e.TagName, attrs, children, e.TagName)
+				if len(children) != 0 {
+					ele = writeBlock(open.concat(textStr(">"))).append(children, writeBlock(textStr("</"+e.TagName+">")))
+				} else if voidElements[e.TagName] {
+					ele = writeBlock(open.concat(textStr("/>")))
 				} else {
-					if voidElements[e.TagName] {
-						eleCode = fmt.Sprintf("w.WriteString(\"<%s\"+%s+\"/>\")", e.TagName, attrs)
-					} else {
-						eleCode = fmt.Sprintf("w.WriteString(\"<%s\"+%s+\"></%s>\")", e.TagName, attrs, e.TagName)
-					}
+					ele = writeBlock(open.concat(textStr("></" + e.TagName + ">")))
 				}
 			}
 		}
 
 	case parser.CommentNode:
+		// 只有配置了保留注释时才会有注释节点
+		ele = writeBlock(textStr("<!--" + e.Text + "-->"))
 	case parser.DoctypeNode:
-		eleCode = fmt.Sprintf(`w.WriteString("<!doctype %s>")`, e.DocType)
+		ele = writeBlock(textStr("<!doctype " + e.DocType + ">"))
 	default:
 		panic(fmt.Sprintf("bad nodeType, %+v", e))
 	}
 
+	if len(e.VLet) != 0 {
+		ele = rawBlock(c.genVLet(e.VLet, ele.Code()))
+	}
+
+	// 组件的provide已经在Options中处理了
+	if len(e.Provide) != 0 && !isComponent {
+		ele = rawBlock(c.genVProvide(e.Provide, ele.Code()))
+	}
+
 	// 优先级 vSlot > vFor > vIf, 所以先处理VIf(后处理的可覆盖前处理的)
 
 	if e.VIf != nil {
-		var namedSlotCodeElseIf map[string]string
-		eleCode, namedSlotCodeElseIf = genVIf(e.VIf, eleCode, c)
+		code, namedSlotCodeElseIf := genVIf(e.VIf, ele.Code(), c)
+		ele = rawBlock(code)
 		for i, v := range namedSlotCodeElseIf {
 			namedSlotCode[i] = v
 		}
+		c.line = e.Line
 	}
 	if e.VFor != nil {
-		eleCode = genVFor(e.VFor, eleCode)
+		ele = rawBlock(c.genVFor(e.VFor, ele.Code()))
+	}
+	// v-once包裹v-if/v-for, 和vue一样整个节点只会渲染一次
+	if e.VOnce {
+		c.onceId++
+		ele = rawBlock(genVOnce(fmt.Sprintf(":%s:%d", c.component, c.onceId), ele.Code()))
 	}
-	if e.VSlot != nil {
-		var namedSlotCode2 map[string]string
-		eleCode, namedSlotCode2 = genVSlot(e.VSlot, eleCode)
+	// 插槽会将原来的代码去掉, 并将代码放在namedSlot里
+	if e.VSlot != nil && !(isComponent && isDefaultSlotOnComponent(e)) {
+		namedSlotCode2 := c.genVSlot(e.VSlot, ele.Code())
+		ele = nil
 		for i, v := range namedSlotCode2 {
 			namedSlotCode[i] = v
 		}
 	}
 
-	return eleCode, namedSlotCode
+	return ele, namedSlotCode
 }
 
 // vIf处理if节点与elseif/else节点, 会返回elseif节点的namedSlotCode
 func genVIf(e *VIf, srcCode string, c *Compiler) (code string, namedSlotCode map[string]string) {
 	// 自己的conditions
-	condition, err := ast.Js2Go(e.Condition, ScopeKey)
-	if err != nil {
-		panic(err)
-	}
+	condition := ast.ToBoolCode(c.js2Go(e.Condition))
 	namedSlotCode = map[string]string{}
 
 	// open if
 	code = fmt.Sprintf(`
-if interfaceToBool(%s) { %s`, condition, srcCode)
+if %s { %s`, condition, srcCode)
 	// 继续处理else节点
 	for _, v := range e.ElseIf {
 		eleCode, namedSlotCode2 := c.GenEleCode(v.VueElement)
@@ -554,11 +1098,8 @@ if interfaceToBool(%s) { %s`, condition, srcCode)
 		case "else":
 			code += fmt.Sprintf(`} else { %s`, eleCode)
 		case "elseif":
-			condition, err := ast.Js2Go(v.Condition, ScopeKey)
-			if err != nil {
-				panic(err)
-			}
-			code += fmt.Sprintf(`} else if interfaceToBool(%s) { %s`, condition, eleCode)
+			condition := ast.ToBoolCode(c.js2Go(v.Condition))
+			code += fmt.Sprintf(`} else if %s { %s`, condition, eleCode)
 		}
 	}
 
@@ -568,36 +1109,73 @@ if interfaceToBool(%s) { %s`, condition, srcCode)
 	return
 }
 
-func genVSlot(e *VSlot, srcCode string) (code string, namedSlotCode map[string]string) {
+func (c *Compiler) genVSlot(e *VSlot, srcCode string) (namedSlotCode map[string]string) {
+	name := e.SlotName
+	if e.Dynamic {
+		nameCode := c.jsToGo(e.SlotName)
+		name = dynamicSlotName(nameCode)
+	}
+
 	namedSlotCode = map[string]string{
-		e.SlotName: fmt.Sprintf(`func(w Writer, props Props){
-	%s := extendScope(%s, map[string]interface{}{"%s": props})
-_ = %s
+		name: fmt.Sprintf(`func(w Writer, props Props){
+%s
 %s
-}`, ScopeKey, ScopeKey, e.PropsKey, ScopeKey, srcCode),
+}`, c.genVSlotScope(e), srcCode),
 	}
-
-	// 插槽会将原来的子代码去掉, 并将代码放在namedSlot里.
-	code = `""`
 	return
 }
 
-func genVFor(e *VFor, srcCode string) (code string) {
+// 写在组件上的v-slot="{ item }"表示组件的默认插槽, 而不是将组件作为上层组件的插槽
+func isDefaultSlotOnComponent(e *VueElement) bool {
+	return e.VSlot != nil && !e.VSlot.Dynamic && e.VSlot.SlotName == "default"
+}
+
+// 生成插槽的作用域代码, 将slotProps声明为变量
+func (c *Compiler) genVSlotScope(e *VSlot) string {
+	var data string
+	if e.Fields != nil {
+		data = c.genDestructureCode(e.Fields, "props.Map()")
+	} else {
+		data = fmt.Sprintf(`map[string]interface{}{%q: props.Map()}`, e.PropsKey)
+	}
+
+	return fmt.Sprintf(`%s := extendScope(%s, %s)
+_ = %s`, ScopeKey, ScopeKey, data, ScopeKey)
+}
+
+// 动态插槽名会作为namedSlotCode的key, 使用[]包裹以和静态插槽名区分
+func dynamicSlotName(nameCode string) string {
+	return "[" + nameCode + "]"
+}
+
+// 生成Slots代码, 动态插槽名的key是go表达式
+func genSlotsCode(slot map[string]string) string {
+	c := "map[string]NamedSlotFunc{"
+	for _, k := range getSortedKey(slot) {
+		v := slot[k]
+		if strings.HasPrefix(k, "[") && strings.HasSuffix(k, "]") {
+			c += fmt.Sprintf(`interfaceToStr(%s): %s,`, k[1:len(k)-1], v)
+		} else {
+			c += fmt.Sprintf(`%q: %s,`, k, v)
+		}
+	}
+	c += "}"
+	return c
+}
+
+func (c *Compiler) genVFor(e *VFor, srcCode string) (code string) {
 	vfArray := e.ArrayKey
 	vfItem := e.ItemKey
 	vfIndex := e.IndexKey
-	vfArrayCode, err := ast.Js2Go(vfArray, ScopeKey)
-	if err != nil {
-		panic(err)
-	}
+	vfArrayCode := c.jsToGo(vfArray)
 
 	// 将自己for, 将子代码的data字段覆盖, 实现作用域的修改
 	return fmt.Sprintf(`
   for index, item := range interface2Slice(%s) {
     func(xscope *Scope){
         %s := extendScope(xscope, map[string]interface{}{
-          "%s": index,
-          "%s": item,
+          %q: index,
+          %q: item,
         })
 		_ = %s
 		%s
@@ -606,25 +1184,88 @@ func genVFor(e *VFor, srcCode string) (code string) {
 `, vfArrayCode, ScopeKey, vfIndex, vfItem, ScopeKey, srcCode, ScopeKey)
 }
 
-func genVHtml(value string) (code string) {
-	goCode, err := ast.Js2Go(value, ScopeKey)
-	if err != nil {
-		panic(err)
+// v-let, 为节点与子节点扩展作用域
+// 多个v-let会依次声明, 后面的表达式可以读取前面声明的变量
+func (c *Compiler) genVLet(ls []VLet, srcCode string) (code string) {
+	code = srcCode
+	for i := len(ls) - 1; i >= 0; i-- {
+		l := ls[i]
+		valueCode := c.jsToGo(l.Value)
+
+		if l.Fields == nil {
+			code = fmt.Sprintf(`{
+%s := extendScope(%s, map[string]interface{}{%q: %s})
+_ = %s
+%s
+}`, ScopeKey, ScopeKey, l.Name, valueCode, ScopeKey, code)
+		} else {
+			code = fmt.Sprintf(`{
+_let := %s
+%s := extendScope(%s, %s)
+_ = %s
+%s
+}`, valueCode, ScopeKey, ScopeKey, c.genDestructureCode(l.Fields, "_let"), ScopeKey, code)
+		}
 	}
-	return fmt.Sprintf(`w.WriteString(interfaceToStr(%s))`, goCode)
+	return
 }
 
-func genVText(value string) (code string) {
-	goCode, err := ast.Js2Go(value, ScopeKey)
-	if err != nil {
-		panic(err)
+// 生成解构变量的map代码
+// e.g. map[string]interface{}{"a": lookInterface(_let, "a"), "d": defaultValue(lookInterface(_let, "d"), 1)}
+func (c *Compiler) genDestructureCode(fields []DestructureField, valueCode string) string {
+	code := "map[string]interface{}{\n"
+	for _, f := range fields {
+		v := fmt.Sprintf(`lookInterface(%s, %q)`, valueCode, f.Key)
+		if f.Default != "" {
+			defaultCode := c.jsToGo(f.Default)
+			v = fmt.Sprintf(`defaultValue(%s, %s)`, v, defaultCode)
+		}
+		code += fmt.Sprintf("%q: %s,\n", f.Name, v)
 	}
-	return fmt.Sprintf(`w.WriteString(interfaceToStr(%s, true))`, goCode)
+	code += "}"
+	return code
+}
+
+func (c *Compiler) genVHtml(value string) codeBlock {
+	goCode, typ := c.js2Go(value)
+	return writeBlock(codeStr(ast.ToStrCode(goCode, typ, false)))
+}
+
+func (c *Compiler) genVText(value string) codeBlock {
+	goCode, typ := c.js2Go(value)
+	return writeBlock(codeStr(ast.ToStrCode(goCode, typ, true)))
 }
 
 func NewCompiler() *Compiler {
 	return &Compiler{
 		Components: map[string]string{},
+		Options:    map[string]*ComponentOptions{},
+		Globals:    map[string]bool{},
+		Directives: map[string]bool{},
+		Plugins:    map[string]*DirectivePlugin{},
+
+		interpolation:     mustacheReg,
+		interpolationWith: [2]string{"{{", "}}"},
+	}
+}
+
+// 复制编译器用于编译一个组件, 共享只读的组件与配置, 编译状态与Diagnostics是独立的
+func (c *Compiler) fork() *Compiler {
+	return &Compiler{
+		Components: c.Components,
+		Options:    c.Options,
+		Globals:    c.Globals,
+		Directives: c.Directives,
+		Plugins:    c.Plugins,
+		Parser:     c.Parser,
+		Delimiters: c.Delimiters,
+		files:      c.files,
+		external:   c.external,
+		runtime:    c.runtime,
+
+		inheritAllAttrs:   c.inheritAllAttrs,
+		interpolation:     c.interpolation,
+		interpolationWith: c.interpolationWith,
 	}
 }
 
@@ -637,44 +1278,64 @@ func (a *Compiler) AddComponent(name string) {
 	a.Components[compName] = compName
 }
 
-// 处理 Mustache {{}} 插值
-// 生成代码（字符串类型）, .e.g: "123" + interfaceToStr(scope.Get("total"),true)
-func injectVal(src string) (to string) {
-	reg := regexp.MustCompile(`{{.+?}}`)
-
-	src = reg.ReplaceAllStringFunc(src, func(s string) string {
-		key := s[2 : len(s)-2]
-
-		goCode, err := ast.Js2Go(key, ScopeKey)
-		if err != nil {
-			panic(err)
+// 加上组件在<script>中局部注册的组件, 返回新的Components(不修改c.Components)与局部组件的名字 => 组件名.
+// 局部组件的文件必须是同一个包中的组件.
+func (c *Compiler) withLocalComponents(o *ComponentOptions) (components map[string]string, local map[string]string) {
+	if o == nil || len(o.Components) == 0 {
+		return c.Components, nil
+	}
+	components = make(map[string]string, len(c.Components)+2*len(o.Components))
+	for k, v := range c.Components {
+		components[k] = v
+	}
+	local = map[string]string{}
+	for name, path := range o.Components {
+		file := filepath.Clean(filepath.Join(filepath.Dir(c.file), path))
+		compName, ok := c.files[file]
+		if !ok {
+			c.errorf("component '%s' not found: %s", name, path)
+			continue
+		}
+		// 和全局组件一样, 可以使用驼峰或者蛇形的tag
+		for _, tag := range []string{name, tuoFeng2SheXing(name), sheXing2TuoFeng(name)} {
+			components[tag] = compName
+			local[tag] = compName
 		}
-		return fmt.Sprintf(`"+interfaceToStr(%s, true)+"`, goCode)
-	})
+	}
+	return
+}
 
-	src = strings.TrimPrefix(src, `""+`)
-	src = strings.TrimSuffix(src, `+""`)
-	return src
+// 插值的分隔符
+func (c *Compiler) delimiters() (left, right string) {
+	if c.Delimiters[0] == "" || c.Delimiters[1] == "" {
+		return "{{", "}}"
+	}
+	return c.Delimiters[0], c.Delimiters[1]
 }
 
-// 包裹字符串
-// 需要处理如: 将"变为 \"
-// 跳过处理{{表达式中的字符串.
-func safeStringCode(s string) (to string) {
-	var t strings.Builder
-	for _, v := range strings.Split(s, "{{") {
-		sp := strings.Split(v, "}}")
-		if len(sp) == 2 {
-			// 跳过处理{{表达式中的字符串.
-			t.WriteString("{{")
-			t.WriteString(sp[0])
-			t.WriteString("}}")
-			t.WriteString(strings.ReplaceAll(sp[1], `"`, `\"`))
-		} else {
-			t.WriteString(strings.ReplaceAll(sp[0], `"`, `\"`))
-		}
+// 默认分隔符{{ }}的插值正则
+var mustacheReg = regexp.MustCompile(`\{\{(.+?)\}\}`)
+
+// 匹配插值的正则, 第一个分组是表达式.
+// 正则在应用配置时编译一次, 之后所有的文本节点都使用它.
+func (c *Compiler) interpolationReg() *regexp.Regexp {
+	left, right := c.delimiters()
+	if c.interpolation == nil || c.interpolationWith != [2]string{left, right} {
+		c.interpolation = regexp.MustCompile(regexp.QuoteMeta(left) + "(.+?)" + regexp.QuoteMeta(right))
+		c.interpolationWith = [2]string{left, right}
 	}
+	return c.interpolation
+}
 
-	to = `"` + strings.Replace(t.String(), "\n", `\n`, -1) + `"`
-	return
+// 处理 Mustache {{}} 插值, 生成文本与插值表达式拼接的字符串.
+// 没有闭合的分隔符作为普通文本.
+func (c *Compiler) interpolate(text string) (s strExpr) {
+	reg := c.interpolationReg()
+	last := 0
+	for _, m := range reg.FindAllStringSubmatchIndex(text, -1) {
+		goCode, typ := c.js2Go(text[m[2]:m[3]])
+		s = s.concat(textStr(text[last:m[0]]), codeStr(ast.ToStrCode(goCode, typ, true)))
+		last = m[1]
+	}
+	return s.concat(textStr(text[last:]))
 }
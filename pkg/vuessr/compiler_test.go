@@ -1,6 +1,11 @@
 package vuessr
 
 import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -14,15 +19,13 @@ func TestParseVueVif(t *testing.T) {
 	c := NewCompiler()
 	code, _ := c.GenEleCode(e)
 
-	code = minifyCode(code)
-
 	t.Log(code)
 	return
 }
 
 func TestQuote(t *testing.T) {
-	want := `"\"\"{{title +""}}"`
-	x := safeStringCode(`""{{title +""}}`)
+	want := `"\"\"{{title +\"\"}}\\\n"`
+	x := textStr(`""{{title +""}}\` + "\n").Code()
 	if x != want {
 		t.Fatalf("%v; want:%v", x, want)
 	}
@@ -30,7 +33,7 @@ func TestQuote(t *testing.T) {
 
 func TestInjectVal(t *testing.T) {
 	want := `interfaceToStr(scope.Get("total"), true)`
-	x := injectVal(`{{total}}`)
+	x := NewCompiler().interpolate(`{{total}}`).Code()
 	if x != want {
 		t.Fatalf("%s; want: %s", x, want)
 	}
@@ -38,16 +41,53 @@ func TestInjectVal(t *testing.T) {
 
 func TestTextNode(t *testing.T) {
 	text := `123 {{title}}`
-	code := safeStringCode(text)
+	code := NewCompiler().interpolate(text).Code()
 
-	t.Log(code)
-	// 处理变量
-	code = injectVal(code)
+	want := `"123 "+interfaceToStr(scope.Get("title"), true)`
+	if code != want {
+		t.Fatalf("code = %v; want:%v", code, want)
+	}
+}
 
-	want := `interfaceToStr(scope.Get("title"), true)`
+func TestGenVonDirectivesCode(t *testing.T) {
+	c := NewCompiler()
+	code := c.genVonDirectivesCode([]VOnDirective{
+		{Func: "buy", Args: "item.id, 'x'", Event: "click"},
+		{Func: "close", Event: "mouseover"},
+		{Func: "submit", Event: "evt", DynamicEvent: true, Modifiers: []string{"prevent"}},
+	})
+
+	want := "[]vonDirective{\n" +
+		`{Event: "click", Func: "buy", Args: []interface{}{scope.Get("item", "id"),"x"}},` + "\n" +
+		`{Event: "mouseover", Func: "close", Args: nil},` + "\n" +
+		`{Event: interfaceToStr(scope.Get("evt")), Func: "submit", Args: nil, Modifiers: []string{"prevent", }},` + "\n" +
+		"}"
 	if code != want {
 		t.Fatalf("code = %v; want:%v", code, want)
 	}
+
+	// 模板中的引号不会破坏生成的代码
+	code = c.genVonDirectivesCode([]VOnDirective{{Func: `a"b`, Event: `c"d`}})
+	if !strings.Contains(code, `{Event: "c\"d", Func: "a\"b", Args: nil}`) {
+		t.Fatal(code)
+	}
+}
+
+// <component>的v-on传递给组件, <template>等没有节点的自带组件的v-on会被忽略并警告
+func TestVOnBuiltin(t *testing.T) {
+	c := NewCompiler()
+	code, _ := c.GenEleCode(&VueElement{NodeType: parser.ElementNode, TagName: "component", Props: Props{{Key: "is", Val: "'card'"}}, VOn: []VOnDirective{{Func: "open", Event: "click"}}})
+	if !strings.Contains(code, `VonDirectives: []vonDirective{`) || len(c.Diagnostics) != 0 {
+		t.Fatal(code, c.Diagnostics)
+	}
+
+	for _, tag := range []string{"template", "slot"} {
+		c.Diagnostics = nil
+		code, _ = c.GenEleCode(&VueElement{NodeType: parser.ElementNode, TagName: tag, VOn: []VOnDirective{{Func: "open", Event: "click"}}})
+		if strings.Contains(code, "vonDirective") || len(c.Diagnostics) != 1 || c.Diagnostics[0].Level != DiagnosticWarning {
+			t.Fatal(code, c.Diagnostics)
+		}
+	}
 }
 
 // 使用结果表明, 能用+号的地方就用+号
@@ -73,10 +113,266 @@ func BenchmarkAppend(b *testing.B) {
 	})
 }
 
-func TestMini(t *testing.T) {
-	src := `w.WriteString("<head>")
-w.WriteString("<link rel=\"stylesheet\"href=\"//static.f.cdn-static.cn/3.7.0/animate.min.css\"type=\"text/css\"></link>")
-w.WriteString("<link rel=\"stylesheet\"href=\"//static.f.cdn-static.cn/swiper/swiper.min.css\"></link>")`
+// 相邻的输出语句与静态文本会合并, 文本中类似生成代码的内容不会影响合并
+func TestCodeBlock(t *testing.T) {
+	b := writeBlock(textStr("<head>")).
+		append(writeBlock(textStr(`<p>")` + "\n" + `w.WriteString("</p>`)),
+			writeBlock(textStr(`"+"`).concat(codeStr(`interfaceToStr(scope.Get("a"), true)`))),
+			rawBlock("_ = 1"),
+			writeBlock(textStr("</head>")))
+
+	want := `w.WriteString("<head><p>\")\nw.WriteString(\"</p>\"+\""+interfaceToStr(scope.Get("a"), true))` + "\n" +
+		`_ = 1` + "\n" +
+		`w.WriteString("</head>")`
+	if code := b.Code(); code != want {
+		t.Fatalf("code = %v; want:%v", code, want)
+	}
+}
+
+func TestUnusedModuleClasses(t *testing.T) {
+	modules := map[string]map[string]string{
+		"$style":  {"title": "title_1", "page": "page_1", "unused": "unused_1"},
+		"classes": {"card": "card_1"},
+		"theme":   {"dark": "dark_1"},
+	}
+	code := `w.WriteString("<div class=\"page_1\">" + mixinClass(nil, nil, scope.Get("$style", "title")))` + "\n" +
+		`mixinClass(nil, nil, scope.Get("classes", interfaceToStr(scope.Get("name"))))` + "\n" +
+		`mixinClass(nil, nil, scope.Get("theme"))`
+
+	unused := unusedModuleClasses(modules, code)
+	if len(unused) != 1 || unused[0] != "$style.unused" {
+		t.Fatal(unused)
+	}
+}
+
+func TestWithClientData(t *testing.T) {
+	c := &Compiler{Components: map[string]string{"swiper": "swiper"}, component: "page"}
+	d := []Directive{{Name: "v-client-data", Value: "{id: id}"}}
 
-	t.Log(minifyCode(src))
+	if e := c.withClientData(&VueElement{TagName: "div", Directives: d}); e.Directives[0].Arg != "page" {
+		t.Fatal(e.Directives)
+	}
+	if e := c.withClientData(&VueElement{TagName: "swiper", Directives: d}); e.Directives[0].Arg != "swiper" {
+		t.Fatal(e.Directives)
+	}
+	if d[0].Arg != "" {
+		t.Fatal("should not modify the element")
+	}
+}
+
+func TestCheckProps(t *testing.T) {
+	c := NewCompiler()
+	c.AddComponent("card")
+	c.Options["card"] = &ComponentOptions{Props: []PropDecl{
+		{Name: "title", Types: []string{"String"}, Required: true},
+		{Name: "size", Types: []string{"Number"}},
+		{Name: "disabled", Types: []string{"Boolean"}},
+	}}
+
+	cases := []struct {
+		e      *VueElement
+		errors int
+	}{
+		{&VueElement{TagName: "card", Attrs: []Attribute{{Key: "title", Val: "hi"}, {Key: "disabled"}}}, 0},
+		{&VueElement{TagName: "card", Props: Props{{Key: "title", Val: "name"}, {Key: "size", Val: "1"}}}, 0},
+		{&VueElement{TagName: "card", Props: Props{{Spread: true, Val: "obj"}}}, 0},
+		{&VueElement{TagName: "card"}, 1},
+		{&VueElement{TagName: "card", Attrs: []Attribute{{Key: "title", Val: "hi"}, {Key: "size", Val: "1"}}}, 1},
+		{&VueElement{TagName: "card", Props: Props{{Key: "title", Val: "1"}, {Key: "size", Val: "'1'"}}}, 2},
+	}
+	for i, ca := range cases {
+		c.Diagnostics = nil
+		c.checkProps("card", ca.e)
+		if len(c.Diagnostics) != ca.errors {
+			t.Fatalf("case %d: %v", i, c.Diagnostics)
+		}
+	}
+}
+
+func TestTypedVars(t *testing.T) {
+	c := NewCompiler()
+	c.vars = typedVars(&ComponentOptions{Props: []PropDecl{
+		{Name: "title", Types: []string{"String"}, Required: true},
+		{Name: "size", Types: []string{"Number"}, Default: "1"},
+		{Name: "list", Types: []string{"Array"}, Required: true},
+		{Name: "optional", Types: []string{"String"}},
+	}})
+	if len(c.vars) != 2 || c.vars["title"].Type != "string" || c.vars["size"].Type != "float64" {
+		t.Fatal(c.vars)
+	}
+
+	if code, _ := c.js2Go("title + size"); code != `interfaceAdd(xp_title, xp_size)` {
+		t.Fatal(code)
+	}
+	// v-for声明的title覆盖了prop
+	names := declaredNames(&VueElement{VFor: &VFor{ArrayKey: "list", ItemKey: "title", IndexKey: "i"}})
+	c.shadow(names, 1)
+	if code, typ := c.js2Go("title"); code != `scope.Get("title")` || typ != "" {
+		t.Fatal(code)
+	}
+	c.shadow(names, -1)
+	if code, typ := c.js2Go("title"); code != "xp_title" || typ != "string" {
+		t.Fatal(code)
+	}
+
+	c.js2Go("title - 1")
+	if c.Diagnostics.ErrorCount() != 1 {
+		t.Fatal(c.Diagnostics)
+	}
+
+	if code := typedVarsCode(c.vars, "escape(xp_title)"); code != "xp_title := interfaceToStr(scope.Get(\"title\"))\n_ = xp_title\n" {
+		t.Fatal(code)
+	}
+	// 只匹配完整的变量名
+	if code := typedVarsCode(c.vars, "escape(xp_titles) + xp_sizex"); code != "" {
+		t.Fatal(code)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f, err := ioutil.TempFile("", "check*.vue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`<template><div v-tooltip="tittle" v-foo>
+  {{title}} {{formatDate(size)}}
+  <p v-for="(item, i) in list" :key="i">{{item.name}} {{nope}}</p>
+  <card v-slot="{ row }">{{row}}</card>
+  <my-card></my-card>
+  <p v-pre>{{ignored}}</p>
+</div></template>`)
+	f.Close()
+	e, err := ParseVue(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler()
+	c.AddComponent("card")
+	(&Config{Globals: []string{"formatDate"}, Directives: []string{"tooltip"}}).apply(c)
+	c.check(e, &ComponentOptions{Props: []PropDecl{{Name: "title"}, {Name: "size"}, {Name: "list"}}})
+
+	var messages []string
+	for _, d := range c.Diagnostics {
+		messages = append(messages, d.Message)
+	}
+	want := []string{
+		"undefined variable 'tittle': tittle",
+		"unknown directive 'v-foo'",
+		"undefined variable 'nope': nope",
+		"unknown tag <my-card>, it's not a registered component",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Fatal(messages)
+	}
+
+	// 没有声明props的组件不检查变量
+	c.Diagnostics = nil
+	c.check(e, nil)
+	if len(c.Diagnostics) != 2 {
+		t.Fatal(c.Diagnostics)
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	c := NewCompiler()
+	c.Delimiters = [2]string{"${", "}"}
+
+	code := c.interpolate(`"a" {{b}} ${title}`).Code()
+	want := `"\"a\" {{b}} "+interfaceToStr(scope.Get("title"), true)`
+	if code != want {
+		t.Fatalf("code = %v; want:%v", code, want)
+	}
+	// 没有闭合的分隔符
+	if code := NewCompiler().interpolate(`a}} {{"b"`).Code(); code != `"a}} {{\"b\""` {
+		t.Fatal(code)
+	}
+
+	// 应用配置时编译一次正则, fork的编译器共享它
+	c = NewCompiler()
+	(&Config{Delimiters: []string{"${", "}"}}).apply(c)
+	if reg := c.fork().interpolationReg(); reg != c.interpolation || reg.String() != `\$\{(.+?)\}` {
+		t.Fatal(reg)
+	}
+}
+
+func TestWithPlugins(t *testing.T) {
+	c := NewCompiler()
+	(&Config{Plugins: []DirectivePlugin{
+		{Name: "tooltip", Bind: "title", Class: []string{"has-tip"}, Attrs: map[string]string{"role": "tooltip"}},
+		{Name: "v-upper", Func: func(e *VueElement, d Directive) {
+			e.TagName = strings.ToUpper(e.TagName)
+		}},
+	}}).apply(c)
+
+	e := &VueElement{TagName: "span", Class: []string{"a"}, Directives: []Directive{
+		{Name: "v-tooltip", Value: "text"},
+		{Name: "v-focus"},
+		{Name: "v-upper"},
+	}}
+	n := c.withPlugins(e)
+	if len(n.Directives) != 1 || n.Directives[0].Name != "v-focus" {
+		t.Fatal(n.Directives)
+	}
+	if v, _ := n.Props.Get("title"); v != "text" {
+		t.Fatal(n.Props)
+	}
+	if strings.Join(n.Class, " ") != "a has-tip" || len(n.Attrs) != 1 || n.TagName != "SPAN" {
+		t.Fatal(n)
+	}
+	if len(e.Directives) != 3 || len(e.Class) != 1 || e.TagName != "span" {
+		t.Fatal("should not modify the element")
+	}
+}
+
+// 文本与属性中类似生成代码的内容(引号, 反斜杠, 换行, w.WriteString)不会破坏生成的代码, 渲染结果和模板一致
+func TestTextRender(t *testing.T) {
+	cases := []struct {
+		tpl  string
+		want string
+	}{
+		{`<p>""{{title +""}}\</p>`, `<p>""t\</p>`},
+		{`<p>{{total}}</p>`, `<p>3</p>`},
+		{`<p>123 {{title}}</p>`, `<p>123 t</p>`},
+		{"<p>\")\nw.WriteString(\"</p>", "<p>\")\nw.WriteString(\"</p>"},
+		{`<p>"+"{{ a }}"+"</p>`, `<p>"+"&lt;a&gt;"+"</p>`},
+		{`<p title='"+"' :class="'x' + title">"+"</p>`, `<p class="xt" title="&#34;+&#34;">"+"</p>`},
+		{`<p title='"+"' :id="title"></p>`, `<p title="&#34;+&#34;" id="t"></p>`},
+		{`<div><link rel="stylesheet"href="//static.f.cdn-static.cn/3.7.0/animate.min.css"type="text/css"></div>`,
+			`<div><link rel="stylesheet" href="//static.f.cdn-static.cn/3.7.0/animate.min.css" type="text/css"/></div>`},
+	}
+
+	dir := moduleTempDir(t, "text")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	os.Mkdir(src, os.ModePerm)
+	var render strings.Builder
+	for i, c := range cases {
+		ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("t%d.vue", i)), []byte("<template>"+c.tpl+"</template>"), 0666)
+		render.WriteString(fmt.Sprintf("r.Render(%q, w, options)\nw.WriteString(\"\\n---\\n\")\n", fmt.Sprintf("t%d", i)))
+	}
+	desc := filepath.Join(dir, "out")
+	err := genPackage(Package{Src: src, To: desc, Pkg: "main"}, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(desc, "main.go"), []byte(`package main
+
+import "fmt"
+
+func main() {
+	r := NewRenderCreator().NewRender()
+	w := r.NewWriter()
+	options := &Options{Props: NewProps(map[string]interface{}{"title": "t", "total": 3, "a": "<a>"})}
+`+render.String()+`	fmt.Print(w.Result())
+}
+`), 0666)
+
+	out := strings.Split(goRun(t, desc), "\n---\n")
+	for i, c := range cases {
+		if out[i] != c.want {
+			t.Errorf("case %d: %s; want: %s", i, out[i], c.want)
+		}
+	}
 }
@@ -0,0 +1,265 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/pkg/errors"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// 项目配置文件的默认名字
+const ConfigFile = "go-vue-ssr.yaml"
+
+// 项目配置, 写法如:
+//   packages:
+//     - src: ./web/components
+//       to: ./internal/vuetpl
+//       pkg: vuetpl
+//       prefixes: {ui: ui}
+//       namespace: false
+//       runtime: true
+//       imports: [../design/vuetpl]
+//   runtime: false
+//   whitespace: condense
+//   comments: false
+//   delimiters: ["${", "}"]
+//   inheritAllAttrs: false
+//   globals: [siteName]
+//   functions: [formatDate]
+//   directives: [v-tooltip]
+//   plugins:
+//     - name: v-track
+//       bind: data-track
+// 在go中使用时可以直接构造Config, 与配置文件中的选项相同.
+type Config struct {
+	// 需要编译的.vue目录与生成的包, 可以有多个
+	Packages []Package `yaml:"packages"`
+	// 所有包都使用共享运行时, 见Package.Runtime. 默认每个包复制一份运行时代码, 不依赖go-vue-ssr
+	Runtime bool `yaml:"runtime"`
+	// 模板中空白文本的处理方式: trim(默认)/condense/preserve, 见parser.WhitespaceTrim
+	Whitespace string `yaml:"whitespace"`
+	// 是否保留模板中的注释, 默认会删除
+	Comments bool `yaml:"comments"`
+	// 插值的分隔符, 如["${", "}"], 默认为{{ }}
+	Delimiters []string `yaml:"delimiters"`
+	// 没有声明props的组件也和Vue一样把上层传递的所有props渲染为root节点的attr.
+	// 默认为false, 这时没有声明props的组件只渲染id/src/data-*(兼容以前的写法, 如页面组件接收的数据不会渲染为attr).
+	InheritAllAttrs bool `yaml:"inheritAllAttrs"`
+	// 在运行时注册的全局变量与方法(RenderCreator.Var/Func), 静态检查时不会被当成未定义的变量
+	Globals []string `yaml:"globals"`
+	// 在运行时注册的方法(RenderCreator.Func), 和Globals一样用于静态检查
+	Functions []string `yaml:"functions"`
+	// 在运行时注册的自定义指令(RenderCreator.Directive), 可以省略v-前缀
+	Directives []string `yaml:"directives"`
+	// 编译时处理的指令
+	Plugins []DirectivePlugin `yaml:"plugins"`
+	// 并行编译的数量, 默认为CPU数量
+	Jobs int `yaml:"jobs"`
+}
+
+// 一个.vue目录生成的包
+type Package struct {
+	// .vue文件的目录
+	Src string `yaml:"src"`
+	// 生成的目录
+	To string `yaml:"to"`
+	// 包名, 默认为生成目录的名字
+	Pkg string `yaml:"pkg"`
+	// 目录(相对于Src) => 组件名前缀, 如{ui: ui}时ui/button.vue的组件名是ui-button.
+	// 子目录使用最长匹配的前缀.
+	Prefixes map[string]string `yaml:"prefixes"`
+	// 使用目录作为组件名的命名空间, 如admin/button.vue的组件名是admin-button.
+	// 和Prefixes一起使用时, 匹配的目录会被替换为前缀.
+	Namespace bool `yaml:"namespace"`
+	// 生成的代码使用共享的运行时包github.com/zbysir/go-vue-ssr/pkg/vuessr/runtime, 而不是复制一份运行时代码.
+	// 使用共享运行时的包之间可以使用对方的组件.
+	Runtime bool `yaml:"runtime"`
+	// 导入的其他包的生成目录, 模板中可以使用这些包中的组件, 在运行时使用RenderCreator.Use注册.
+	// 导入的包与当前的包都需要使用共享运行时.
+	Imports []string `yaml:"imports"`
+}
+
+// 读取配置文件, 文件不存在时返回空配置.
+// packages中的相对路径相对于配置文件所在的目录.
+func LoadConfig(file string) (*Config, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, errors.NewCoder(err, "read config")
+	}
+	c := &Config{}
+	err = yaml.Unmarshal(bs, c)
+	if err != nil {
+		return nil, errors.NewCoder(err, "parse config: "+file)
+	}
+	err = c.validate()
+	if err != nil {
+		return nil, errors.NewCoder(err, "invalid config: "+file)
+	}
+
+	dir := filepath.Dir(file)
+	abs := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for i, p := range c.Packages {
+		c.Packages[i].Src = abs(p.Src)
+		c.Packages[i].To = abs(p.To)
+		for j, imp := range p.Imports {
+			c.Packages[i].Imports[j] = abs(imp)
+		}
+	}
+	return c, nil
+}
+
+func (cfg *Config) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	for _, p := range cfg.Packages {
+		if p.Src == "" || p.To == "" {
+			return fmt.Errorf("src and to of package are required")
+		}
+		if len(p.Imports) != 0 && !cfg.shared(p) {
+			return fmt.Errorf("package %s imports other packages, it should use the shared runtime", p.Src)
+		}
+	}
+	switch cfg.Whitespace {
+	case "", parser.WhitespaceTrim, parser.WhitespaceCondense, parser.WhitespacePreserve:
+	default:
+		return fmt.Errorf("unknown whitespace '%s', should be one of trim, condense, preserve", cfg.Whitespace)
+	}
+	if len(cfg.Delimiters) != 0 {
+		if len(cfg.Delimiters) != 2 || cfg.Delimiters[0] == "" || cfg.Delimiters[1] == "" {
+			return fmt.Errorf("delimiters should be 2 non-empty strings, but: %q", cfg.Delimiters)
+		}
+	}
+	for _, p := range cfg.Plugins {
+		if p.Name == "" {
+			return fmt.Errorf("name of plugin is required")
+		}
+	}
+	return nil
+}
+
+// 包是否使用共享运行时
+func (cfg *Config) shared(p Package) bool {
+	return p.Runtime || cfg != nil && cfg.Runtime
+}
+
+// 只编译一个包的配置, 其他选项相同
+func (cfg *Config) withPackage(p Package) *Config {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	c.Packages = []Package{p}
+	return &c
+}
+
+// 将配置应用到编译器
+func (cfg *Config) apply(c *Compiler) {
+	if cfg == nil {
+		return
+	}
+	for _, g := range cfg.Globals {
+		c.Globals[g] = true
+	}
+	for _, f := range cfg.Functions {
+		c.Globals[f] = true
+	}
+	for _, d := range cfg.Directives {
+		c.Directives[directiveName(d)] = true
+	}
+	for i := range cfg.Plugins {
+		p := cfg.Plugins[i]
+		c.Plugins[directiveName(p.Name)] = &p
+	}
+	c.Parser = parser.GoHtml{Whitespace: cfg.Whitespace, Comments: cfg.Comments}
+	if len(cfg.Delimiters) == 2 {
+		c.Delimiters = [2]string{cfg.Delimiters[0], cfg.Delimiters[1]}
+		c.interpolationReg()
+	}
+	c.inheritAllAttrs = cfg.InheritAllAttrs
+}
+
+// 补全指令的v-前缀
+func directiveName(d string) string {
+	if !strings.HasPrefix(d, "v-") {
+		d = "v-" + d
+	}
+	return d
+}
+
+func (cfg *Config) jobs() int {
+	if cfg == nil || cfg.Jobs <= 0 {
+		return runtime.NumCPU()
+	}
+	return cfg.Jobs
+}
+
+// 配置改变时需要重新编译所有组件.
+// 插件的Func无法比较, 修改之后需要删除生成目录中的manifest.
+func (cfg *Config) hash() string {
+	if cfg == nil {
+		return ""
+	}
+	globals := append(append([]string{}, cfg.Globals...), cfg.Functions...)
+	directives := append([]string{}, cfg.Directives...)
+	var plugins []string
+	for _, p := range cfg.Plugins {
+		plugins = append(plugins, fmt.Sprintf("%s:%s:%v:%v", p.Name, p.Bind, p.Class, p.Attrs))
+	}
+	sort.Strings(globals)
+	sort.Strings(directives)
+	sort.Strings(plugins)
+	return Md5String(fmt.Sprintf("%v;%v;%v;%s;%v;%q;%v", globals, directives, plugins, cfg.Whitespace, cfg.Comments, cfg.Delimiters, cfg.InheritAllAttrs))
+}
+
+// 按照导入关系排序的包, 被导入的包先编译. 导入的目录不是配置中的包时认为它已经编译过了.
+func (cfg *Config) packages() ([]Package, error) {
+	byTo := map[string]int{}
+	for i, p := range cfg.Packages {
+		byTo[filepath.Clean(p.To)] = i
+	}
+
+	// 0: 未访问, 1: 访问中, 2: 已完成
+	state := make([]int, len(cfg.Packages))
+	var ps []Package
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("import cycle of package %s", cfg.Packages[i].Src)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, imp := range cfg.Packages[i].Imports {
+			if j, ok := byTo[filepath.Clean(imp)]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = 2
+		ps = append(ps, cfg.Packages[i])
+		return nil
+	}
+	for i := range cfg.Packages {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
@@ -0,0 +1,241 @@
+package vuessr
+
+import (
+	"strings"
+)
+
+// 组件的scoped id, 作为attr添加到组件的所有节点上, 如data-v-5f2b1c3a
+func scopeId(componentName string) string {
+	return "data-v-" + Md5String(componentName)[:8]
+}
+
+// 处理<style scoped>中的css, 在每个选择器的最后添加[data-v-xxx]
+//   .a .b {} => .a .b[data-v-xxx] {}
+//   .a:hover {} => .a[data-v-xxx]:hover {}
+//   .a :deep(.b) {} => .a[data-v-xxx] .b {}
+// @media/@supports中的规则也会被处理, @keyframes/@font-face等保持不变.
+func scopeCss(css string, id string) string {
+	attr := "[" + id + "]"
+	return transformCss(css, func(selectors string) string {
+		return scopeSelectors(selectors, attr)
+	})
+}
+
+// 处理<style module>中的css, 将class重命名为moduleClass, 返回css与所有class(按出现顺序)
+//   .title .a {} => .title_5f2b1c3a .a_5f2b1c3a {}
+func moduleCss(css string, componentName string) (out string, classes []string) {
+	exist := map[string]bool{}
+	out = transformCss(css, func(selectors string) string {
+		return renameClasses(selectors, func(name string) string {
+			if !exist[name] {
+				exist[name] = true
+				classes = append(classes, name)
+			}
+			return moduleClass(name, componentName)
+		})
+	})
+	return
+}
+
+// css module中class重命名后的名字
+func moduleClass(name string, componentName string) string {
+	return name + "_" + Md5String(componentName)[:8]
+}
+
+// 重命名选择器中的class, 会跳过[]与字符串中的内容
+func renameClasses(selectors string, rename func(name string) string) string {
+	var b strings.Builder
+	depth := 0
+	var quote byte
+	for i := 0; i < len(selectors); i++ {
+		c := selectors[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			b.WriteByte(c)
+			continue
+		}
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			end := i + 1
+			for end < len(selectors) && isCssNameChar(selectors[end]) {
+				end++
+			}
+			if end > i+1 {
+				b.WriteString("." + rename(selectors[i+1:end]))
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isCssNameChar(c byte) bool {
+	return c == '-' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// 使用f处理css中所有的选择器
+func transformCss(css string, f func(selectors string) string) string {
+	var b strings.Builder
+	transformCssBlock(&b, css, f)
+	return b.String()
+}
+
+func transformCssBlock(b *strings.Builder, css string, f func(selectors string) string) {
+	for i := 0; i < len(css); {
+		if c := css[i]; c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+
+		// 注释原样输出
+		if strings.HasPrefix(css[i:], "/*") {
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				b.WriteString(css[i:])
+				return
+			}
+			b.WriteString(css[i : i+2+end+2])
+			i += 2 + end + 2
+			continue
+		}
+
+		// 选择器或者at-rule一直到 { 或者 ;
+		end := strings.IndexAny(css[i:], "{;")
+		if end == -1 {
+			b.WriteString(css[i:])
+			return
+		}
+		end += i
+		prelude := css[i:end]
+
+		if css[end] == ';' {
+			// @import xxx;
+			b.WriteString(css[i : end+1])
+			i = end + 1
+			continue
+		}
+
+		close := matchCssBrace(css, end)
+		if close == -1 {
+			b.WriteString(css[i:])
+			return
+		}
+		body := css[end+1 : close]
+
+		trimmed := strings.TrimSpace(prelude)
+		switch {
+		case strings.HasPrefix(trimmed, "@media"), strings.HasPrefix(trimmed, "@supports"):
+			b.WriteString(prelude + "{")
+			transformCssBlock(b, body, f)
+			b.WriteString("}")
+		case strings.HasPrefix(trimmed, "@"):
+			b.WriteString(css[i : close+1])
+		default:
+			b.WriteString(f(trimmed))
+			b.WriteString(" {" + body + "}")
+		}
+		i = close + 1
+	}
+}
+
+// 找到与start处的{匹配的}
+func matchCssBrace(css string, start int) int {
+	depth := 0
+	for i := start; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func scopeSelectors(selectors string, attr string) string {
+	var ss []string
+	for _, s := range splitTopLevel(selectors, ',') {
+		ss = append(ss, scopeSelector(strings.TrimSpace(s), attr))
+	}
+	return strings.Join(ss, ", ")
+}
+
+// 给单个选择器添加attr
+func scopeSelector(s string, attr string) string {
+	// 穿透: :deep(.b) / ::v-deep .b / >>> .b / /deep/ .b
+	if i := strings.Index(s, ":deep("); i != -1 {
+		end := matchBracket(s, i+len(":deep"))
+		if end != -1 {
+			return joinDeep(s[:i], s[i+len(":deep("):end]+s[end+1:], attr)
+		}
+	}
+	for _, deep := range []string{"::v-deep", ">>>", "/deep/"} {
+		if i := strings.Index(s, deep); i != -1 {
+			return joinDeep(s[:i], s[i+len(deep):], attr)
+		}
+	}
+
+	// 最后一个复合选择器
+	last := lastCompoundStart(s)
+	compound := s[last:]
+
+	// attr添加在伪类/伪元素之前
+	pseudo := len(compound)
+	depth := 0
+	for i := 0; i < len(compound); i++ {
+		switch compound[i] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ':':
+			if depth == 0 && pseudo == len(compound) {
+				pseudo = i
+			}
+		}
+	}
+
+	return s[:last] + compound[:pseudo] + attr + compound[pseudo:]
+}
+
+func joinDeep(before string, after string, attr string) string {
+	before = strings.TrimSpace(before)
+	after = strings.TrimSpace(after)
+	if before == "" {
+		return attr + " " + after
+	}
+	return scopeSelector(before, attr) + " " + after
+}
+
+// 找到最后一个复合选择器的开始位置, 复合选择器之间使用空格, >, +, ~ 分割
+func lastCompoundStart(s string) int {
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ' ', '>', '+', '~', '\t', '\n':
+			if depth == 0 {
+				start = i + 1
+			}
+		}
+	}
+	return start
+}
@@ -0,0 +1,52 @@
+package vuessr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeCss(t *testing.T) {
+	css := `
+/* comment { } */
+.a .b, h1 > span:hover::before { color: red; }
+@media (max-width: 100px) {
+  .c { top: 0 }
+}
+.d :deep(.e) { left: 0 }
+::v-deep .f { left: 0 }
+@keyframes spin { from { opacity: 0 } }
+input[type="text"]:focus {}
+`
+	want := `
+/* comment { } */
+.a .b[data-v-1], h1 > span[data-v-1]:hover::before { color: red; }
+@media (max-width: 100px) {
+  .c[data-v-1] { top: 0 }
+}
+.d[data-v-1] .e { left: 0 }
+[data-v-1] .f { left: 0 }
+@keyframes spin { from { opacity: 0 } }
+input[type="text"][data-v-1]:focus {}
+`
+	if r := scopeCss(css, "data-v-1"); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+func TestModuleCss(t *testing.T) {
+	css := `.a .b, .a:hover {}
+input[class="c.d"] .e {}
+@keyframes spin { from { opacity: 0 } }`
+	h := "_" + Md5String("x")[:8]
+	want := `.a` + h + ` .b` + h + `, .a` + h + `:hover {}
+input[class="c.d"] .e` + h + ` {}
+@keyframes spin { from { opacity: 0 } }`
+
+	r, classes := moduleCss(css, "x")
+	if r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+	if strings.Join(classes, ",") != "a,b,e" {
+		t.Fatal(classes)
+	}
+}
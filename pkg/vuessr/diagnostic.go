@@ -0,0 +1,88 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
+)
+
+type DiagnosticLevel string
+
+const (
+	DiagnosticError   DiagnosticLevel = "error"
+	DiagnosticWarning DiagnosticLevel = "warning"
+)
+
+// 编译时发现的问题, 如缺少组件必须的prop, 模板中的语法错误.
+type Diagnostic struct {
+	Level     DiagnosticLevel
+	File      string
+	Line      int // 问题所在的节点在文件中的行号, 0表示不确定
+	Component string
+	Message   string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s, file: %s", d.Level, d.Message, d.Position())
+}
+
+// 文件名与行号, 如page.vue:12
+func (d Diagnostic) Position() string {
+	if d.Line == 0 {
+		return d.File
+	}
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) HasError() bool {
+	return ds.ErrorCount() != 0
+}
+
+func (ds Diagnostics) ErrorCount() (n int) {
+	for _, d := range ds {
+		if d.Level == DiagnosticError {
+			n++
+		}
+	}
+	return
+}
+
+// 组件的Diagnostics
+func (ds Diagnostics) Of(component string) (r Diagnostics) {
+	for _, d := range ds {
+		if d.Component == component {
+			r = append(r, d)
+		}
+	}
+	return
+}
+
+// 打印所有Diagnostic
+func (ds Diagnostics) Log() {
+	for _, d := range ds {
+		if d.Level == DiagnosticError {
+			log.Errorf("%s, file: %s", d.Message, d.Position())
+		} else {
+			log.Warningf("%s, file: %s", d.Message, d.Position())
+		}
+	}
+}
+
+func (c *Compiler) errorf(format string, args ...interface{}) {
+	c.diagnose(DiagnosticError, format, args...)
+}
+
+func (c *Compiler) warningf(format string, args ...interface{}) {
+	c.diagnose(DiagnosticWarning, format, args...)
+}
+
+func (c *Compiler) diagnose(level DiagnosticLevel, format string, args ...interface{}) {
+	c.Diagnostics = append(c.Diagnostics, Diagnostic{
+		Level:     level,
+		File:      c.file,
+		Line:      c.line,
+		Component: c.component,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
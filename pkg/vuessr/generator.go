@@ -1,65 +1,249 @@
 package vuessr
 
 import (
-	"bytes"
-	"context"
 	"fmt"
-	"github.com/radovskyb/watcher"
-	"github.com/zbysir/go-vue-ssr/internal/pkg/errors"
 	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
 	"github.com/zbysir/go-vue-ssr/internal/version"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
 	"go/format"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
 func genComponentRenderFunc(c *Compiler, pkgName, name string, file string, srcHash string) []byte {
-	ve, err := ParseVue(file)
+	sfc, err := parseSFC(file, c.Parser)
+	return genComponentCode(c, pkgName, name, file, sfc, err, srcHash)
+}
+
+// 使用已经解析的SFC生成组件代码, err是解析SFC的错误
+func genComponentCode(c *Compiler, pkgName, name string, file string, sfc *SFC, err error, srcHash string) []byte {
 	code := `""`
+	var meta *ComponentOptions
+	// 模板中是否使用了$attrs
+	var usedAttrs bool
+	var modules map[string]map[string]string
+	css := ""
+	js := ""
+	c.component = name
+	c.file = file
+	c.tags = nil
+	c.line = 0
 	if err != nil {
-		log.Warningf("parseVue err: %v, file: %v", err, file)
+		// 无法解析的组件作为错误报告, 编译失败
+		msg := err.Error()
+		if e, ok := err.(*templateError); ok {
+			c.line = e.Line
+			msg = e.Message
+		}
+		c.errorf("parse %s: %s", filepath.Base(file), msg)
 	} else {
-		code, _ = c.GenEleCode(ve)
-		code = minifyCode(code)
+		c.onceId = 0
+		c.scopeId = ""
+		if sfc.Scoped() {
+			c.scopeId = scopeId(name)
+		}
+		modules = sfc.CssModules(name)
+		c.cssModules = modules
+
+		meta, err = sfc.ComponentOptions()
+		if err != nil {
+			c.warningf("parse <script> err: %v", err)
+		}
+		c.vars = typedVars(meta)
+		c.shadowed = nil
+
+		// 局部注册的组件只在编译这个组件时有效
+		var local map[string]string
+		defer func(components map[string]string) {
+			c.Components = components
+		}(c.Components)
+		c.Components, local = c.withLocalComponents(meta)
+
+		usedAttrs = c.check(sfc.Template, meta)["$attrs"]
+		// 局部组件的依赖记录为组件的全局tag, 在不编译组件时也可以检查依赖是否改变
+		c.tags = usedTags(sfc.Template)
+		for i, tag := range c.tags {
+			if name, ok := local[tag]; ok {
+				c.tags[i] = tuoFeng2SheXing(name)
+			}
+		}
+
+		code, _ = c.GenEleCode(sfc.Template)
+
+		for _, class := range unusedModuleClasses(modules, code) {
+			c.warningf("unused css module class: %s", class)
+		}
+
+		css = sfc.Css(name)
+		js = sfc.ClientScript()
+	}
+
+	// 有<script>声明/<style module>, 模板中使用了$attrs或者使用inheritAllAttrs的组件需要生成meta
+	scopeCode := fmt.Sprintf("%s:= propsScope(r, %q, options)\n", ScopeKey, name)
+	metaCode := ""
+	if meta != nil || modules != nil || usedAttrs || c.inheritAllAttrs {
+		metaCode = fmt.Sprintf("var xxMeta_%s = %s\n", name, c.genComponentMetaCode(name, meta, modules, usedAttrs))
+		scopeCode = fmt.Sprintf("%s:= componentScope(r, options, xxMeta_%s)\n", ScopeKey, name)
+	}
+
+	// 声明了类型的props
+	scopeCode += typedVarsCode(c.vars, code)
+
+	// 组件渲染时注册自己的css, 用于<style-outlet>
+	if css != "" {
+		metaCode += fmt.Sprintf("var xxStyle_%s = &block{ID: %q, Code: %q}\n", name, name, css)
+		scopeCode = fmt.Sprintf("useStyle(r, xxStyle_%s)\n", name) + scopeCode
+	}
+	// <script client>, 用于<script-outlet>
+	if js != "" {
+		metaCode += fmt.Sprintf("var xxScript_%s = &block{ID: %q, Code: %q}\n", name, name, js)
+		scopeCode = fmt.Sprintf("useScript(r, xxScript_%s)\n", name) + scopeCode
 	}
 
 	f := []byte(fmt.Sprintf("// Code generated by go-vue-ssr: https://github.com/zbysir/go-vue-ssr\n// src_hash:%s\n\n"+
 		"package %s\n\n"+
 		"import (\"strings\")\ntype _ strings.Builder\n"+
+		"%s"+
 		"func xx_%s(r *Render, w Writer, options *Options){\n"+
-		"%s:= extendScope(r.Global, options.Props.data)\n"+
+		"%s"+
 		"_ = %s\n"+
 		"%s\n"+
 		"return"+
-		"}", srcHash, pkgName, name, ScopeKey, ScopeKey, code))
+		"}\n\n"+
+		"%s", srcHash, pkgName, metaCode, name, scopeCode, ScopeKey, code, genTypedPropsCode(name, meta, c.runtime)))
 	f2, err := format.Source(f)
 	if err != nil {
-		log.Errorf("format.Source [%s] err:%+v, src:%s", name, err, f)
+		// 生成的代码无法编译, 作为错误报告, 组件不会写入文件
+		c.errorf("generated code is invalid: %v", err)
+		log.Debugf("invalid code of %s: %s", name, f)
 		return f
 	}
 
 	return f2
 }
 
-func minifyCode(code string) string {
-	// 如果前后两个都是字符串, 则可以将中间的w.WriterString删除
-	// before:
-	// 	 w.WriteString("<title>")
-	//	 w.WriteString("" + interfaceToStr(scope.Get("title"), true) + "")
-	// after:
-	//   w.WriteString("<title>" + interfaceToStr(scope.Get("title"), true) + "")
+// 生成组件在<script>中声明的选项与css module: &componentMeta{Name: "card", Props: map[string]bool{"title": true}, InheritAttrs: true}
+// attrs: 模板中是否读取了$attrs
+func (c *Compiler) genComponentMetaCode(name string, o *ComponentOptions, modules map[string]map[string]string, attrs bool) string {
+	if o == nil {
+		o = &ComponentOptions{InheritAttrs: true}
+	}
+	props := "nil"
+	if o.Props != nil {
+		props = "map[string]bool{"
+		for _, p := range o.Props {
+			props += fmt.Sprintf(`%q: true,`, p.Name)
+		}
+		props += "}"
+	}
+	code := fmt.Sprintf("&componentMeta{Name: %q, Props: %s, InheritAttrs: %v", name, props, o.InheritAttrs)
+	if attrs {
+		code += ", Attrs: true"
+	}
+	if c.inheritAllAttrs && o.Props == nil {
+		code += ", AllAttrs: true"
+	}
+
+	// 类型与required, 用于strict模式下检查
+	types := map[string]string{}
+	required := map[string]string{}
+	for _, p := range o.Props {
+		if len(p.Types) != 0 {
+			types[p.Name] = sliceToGoCode(p.Types)
+		}
+		if p.Required {
+			required[p.Name] = "true"
+		}
+	}
+	if len(types) != 0 {
+		code += fmt.Sprintf(", Types: %s", mapGoCodeToCode(types, "[]string", false))
+	}
+	if len(required) != 0 {
+		code += fmt.Sprintf(", Required: %s", mapGoCodeToCode(required, "bool", false))
+	}
+
+	// 默认值, 只支持字面量
+	defaults := map[string]string{}
+	for _, p := range o.Props {
+		if p.Default == "" {
+			continue
+		}
+		v, err := ast.Js2Go(p.Default, ScopeKey)
+		if err != nil || strings.Contains(v, ScopeKey+".") {
+			c.warningf("default of prop '%s' should be a literal, but: %s", p.Name, p.Default)
+			continue
+		}
+		defaults[p.Name] = v
+	}
+	if len(defaults) != 0 {
+		code += fmt.Sprintf(", Defaults: %s", mapGoCodeToCode(defaults, "interface{}", false))
+	}
+
+	if modules != nil {
+		m := map[string]string{}
+		for name, classes := range modules {
+			cs := map[string]string{}
+			for k, v := range classes {
+				cs[k] = strconv.Quote(v)
+			}
+			m[name] = mapGoCodeToCode(cs, "interface{}", false)
+		}
+		code += fmt.Sprintf(", Modules: %s", mapGoCodeToCode(m, "map[string]interface{}", true))
+	}
+	return code + "}"
+}
 
-	code = strings.Replace(code, "\")\nw.WriteString(\"", "", -1)
-	code = strings.Replace(code, "\n\"\"\n", "\n", -1)
+// 生成声明了props的组件的XxxProps结构体与RenderXxx方法, 在Go中可以类型安全的渲染组件:
+//   r.RenderCard(w, CardProps{Title: "hi"})
+// 有默认值的prop会生成为指针, 为nil时使用默认值.
+// 使用共享运行时时Render不是本包的类型, 生成的是函数: vuetpl.RenderCard(r, w, CardProps{Title: "hi"})
+func genTypedPropsCode(name string, o *ComponentOptions, shared bool) string {
+	if o == nil || len(o.Props) == 0 {
+		return ""
+	}
+	typeName := exportedName(name) + "Props"
+
+	fields := ""
+	set := ""
+	for _, p := range o.Props {
+		field := exportedName(p.Name)
+		if p.Default != "" {
+			comment := ""
+			if !strings.Contains(p.Default, "\n") {
+				comment = " // default: " + p.Default
+			}
+			fields += fmt.Sprintf("%s *%s%s\n", field, p.FieldType(), comment)
+			set += fmt.Sprintf("if p.%s != nil {\nprops.Set(%q, *p.%s)\n}\n", field, p.Name, field)
+		} else {
+			comment := ""
+			if p.Required {
+				comment = " // required"
+			}
+			fields += fmt.Sprintf("%s %s%s\n", field, p.FieldType(), comment)
+			set += fmt.Sprintf("props.Set(%q, p.%s)\n", p.Name, field)
+		}
+	}
 
-	// 处理多余的纯字符串拼接: "a"+"b" => "ab"
-	code = strings.Replace(code, `"+"`, "", -1)
+	receiver := "(r *Render) Render%[5]s(w Writer, "
+	if shared {
+		receiver = "Render%[5]s(r *Render, w Writer, "
+	}
+	return fmt.Sprintf("// %[1]s %[2]s组件的props\n"+
+		"type %[1]s struct {\n%[3]s}\n\n"+
+		"func (p %[1]s) props() Props {\nprops := Props{}\n%[4]sreturn props\n}\n\n"+
+		"// Render%[5]s 使用类型安全的props渲染%[2]s组件\n"+
+		"func "+receiver+"p %[1]s) {\nxx_%[2]s(r, w, &Options{Props: p.props()})\n}\n",
+		typeName, name, fields, set, exportedName(name))
+}
 
-	return code
+// 导出的go名字, 如info-card => InfoCard
+func exportedName(name string) string {
+	name = sheXing2TuoFeng(name)
+	return strings.ToUpper(name[:1]) + name[1:]
 }
 
 func tuoFeng2SheXing(src string) (outStr string) {
@@ -107,7 +291,7 @@ func sheXing2TuoFeng(src string) (outStr string) {
 	return string(out)
 }
 
-func genCreator(components map[string]string, pkgName string) []byte {
+func genCreator(components map[string]string, pkgName string) ([]byte, error) {
 	m := map[string]string{}
 	for tagName, comName := range components {
 		m[tagName] = fmt.Sprintf(`xx_%s`, comName)
@@ -115,6 +299,10 @@ func genCreator(components map[string]string, pkgName string) []byte {
 
 	f := []byte(fmt.Sprintf("// Code generated by go-vue-ssr: https://github.com/zbysir/go-vue-ssr\n\n"+
 		"package %s\n\n"+
+		"import \"reflect\"\n\n"+
+		"// 包的import path, 用于区分不同包中同名组件的v-once缓存\n"+
+		"type xxPkg struct{}\n\n"+
+		"var xxPkgPath = reflect.TypeOf(xxPkg{}).PkgPath()\n\n"+
 		"func NewRenderCreator() *RenderCreator{"+
 		"r:=newRenderCreator()\n"+
 		"r.Components = %s\n"+
@@ -124,11 +312,10 @@ func genCreator(components map[string]string, pkgName string) []byte {
 
 	formatted, err := format.Source(f)
 	if err != nil {
-		log.Errorf("format.Source [%s] err:%+v, src:%s", "genCreator", err, f)
-		return f
+		return nil, fmt.Errorf("generated creator.go is invalid: %v", err)
 	}
 
-	return formatted
+	return formatted, nil
 }
 
 // 组件名字, 驼峰
@@ -140,10 +327,99 @@ type VueFile struct {
 	ComponentName string // xText
 	Path          string
 	Filename      string // x-text.vue
+
+	// 解析后的SFC与错误, 每个文件只解析一次, 用于读取props, 编译与生成css
+	sfc    *SFC
+	sfcErr error
 }
 
 // 生成并写入文件夹
 func GenAllFile(src, desc string, pkg string) (err error) {
+	return GenAllFileWithConfig(src, desc, pkg, nil)
+}
+
+// 使用项目配置编译, config为nil时和GenAllFile一样, 忽略config中的Packages
+func GenAllFileWithConfig(src, desc string, pkg string, config *Config) (err error) {
+	return genPackage(Package{Src: src, To: desc, Pkg: pkg}, config)
+}
+
+// 编译配置中的所有包
+func GenPackages(config *Config) (err error) {
+	if config == nil || len(config.Packages) == 0 {
+		return fmt.Errorf("no package to compile")
+	}
+	ps, err := config.packages()
+	if err != nil {
+		return
+	}
+	for _, p := range ps {
+		err = genPackage(p, config)
+		if err != nil {
+			return fmt.Errorf("compile %s: %w", p.Src, err)
+		}
+	}
+	return
+}
+
+// 组件名字, 驼峰. 文件所在目录有前缀时会加上前缀: ui/button.vue => uiButton,
+// 使用命名空间时会加上目录: admin/user/card.vue => adminUserCard
+func (p Package) componentName(file string) string {
+	_, fileName := filepath.Split(file)
+	var parts []string
+
+	dir, prefix := p.prefix(file)
+	if prefix != "" {
+		parts = append(parts, prefix)
+	}
+	if p.Namespace {
+		// 匹配前缀的目录之下的目录
+		rel := strings.TrimPrefix(strings.TrimPrefix(p.relDir(file), dir), "/")
+		if rel != "" {
+			parts = append(parts, strings.Split(rel, "/")...)
+		}
+	}
+	parts = append(parts, strings.TrimSuffix(fileName, ".vue"))
+	return componentName(strings.Join(parts, "-"))
+}
+
+// 文件所在的目录, 相对于Src, 使用/分割, 在Src下时为空
+func (p Package) relDir(file string) string {
+	rel, err := filepath.Rel(p.Src, filepath.Dir(file))
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// 文件所在目录最长匹配的目录与前缀
+func (p Package) prefix(file string) (dir string, prefix string) {
+	rel := p.relDir(file)
+
+	longest := -1
+	for d, pre := range p.Prefixes {
+		d = strings.Trim(filepath.ToSlash(filepath.Clean(d)), "/")
+		if d == "." {
+			d = ""
+		}
+		if d != "" && rel != d && !strings.HasPrefix(rel, d+"/") {
+			continue
+		}
+		if len(d) > longest {
+			longest = len(d)
+			dir, prefix = d, pre
+		}
+	}
+	return
+}
+
+func genPackage(p Package, config *Config) (err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	p.Runtime = config.shared(p)
+	src, desc, pkg := p.Src, p.To, p.Pkg
+
 	// 生成文件夹
 	err = os.MkdirAll(desc, os.ModePerm)
 	if err != nil {
@@ -174,11 +450,24 @@ func GenAllFile(src, desc string, pkg string) (err error) {
 	}
 
 	c := NewCompiler()
+	config.apply(c)
+	c.runtime = p.Runtime
+
+	c.files = map[string]string{}
+	// 组件名 => 文件
+	names := map[string]string{}
 
 	var vs []VueFile
 	for _, v := range vueFiles {
 		_, fileName := filepath.Split(v)
-		name := componentName(strings.TrimSuffix(fileName, ".vue"))
+		name := p.componentName(v)
+
+		// 同名的组件会互相覆盖
+		if o, ok := names[name]; ok {
+			return fmt.Errorf("component '%s' of %s conflicts with %s, rename it or use prefixes/namespace", tuoFeng2SheXing(name), v, o)
+		}
+		names[name] = v
+		c.files[filepath.Clean(v)] = name
 
 		vs = append(vs, VueFile{
 			ComponentName: name,
@@ -190,130 +479,243 @@ func GenAllFile(src, desc string, pkg string) (err error) {
 		c.AddComponent(name)
 	}
 
+	// 先解析所有组件声明的props, 用于在编译时检查上层传递的props
+	for i, v := range vs {
+		vs[i].sfc, vs[i].sfcErr = parseSFC(v.Path, c.Parser)
+		if vs[i].sfcErr != nil {
+			continue
+		}
+		o, err := vs[i].sfc.ComponentOptions()
+		if err != nil || o == nil {
+			continue
+		}
+		c.Options[v.ComponentName] = o
+	}
+
+	// 导入的包中的组件, 在运行时通过RenderCreator.Use注册
+	c.external = map[string]bool{}
+	for _, dir := range p.Imports {
+		im, err := loadImport(dir)
+		if err != nil {
+			return err
+		}
+		for name, v := range im.Components {
+			if o, ok := names[name]; ok {
+				return fmt.Errorf("component '%s' imported from %s conflicts with %s", tuoFeng2SheXing(name), dir, o)
+			}
+			names[name] = dir
+			c.AddComponent(name)
+			c.external[name] = true
+			if v.Options != nil {
+				c.Options[name] = v.Options
+			}
+		}
+	}
+
 	_, pkgName := filepath.Split(desc)
 	if pkg != "" {
 		pkgName = pkg
 	}
 
+	// 所有文件先写入临时目录, 最后再移动到生成目录
+	s, err := newStaging(desc)
+	if err != nil {
+		return
+	}
+	defer s.clean()
+
 	// 生成new代码
-	code := genCreator(c.Components, pkgName)
-	err = ioutil.WriteFile(desc+string(os.PathSeparator)+"creator.go", code, 0666)
+	local := map[string]string{}
+	for tag, name := range c.Components {
+		if !c.external[name] {
+			local[tag] = name
+		}
+	}
+	code, err := genCreator(local, pkgName)
+	if err != nil {
+		return
+	}
+	err = s.write("creator.go", code)
 	if err != nil {
 		return
 	}
 
 	willDelOld := oldVs
+	old := loadManifest(desc, config)
+	// 切换运行时之后生成的代码不同, 需要全部重新编译
+	if old.Runtime != p.Runtime {
+		old = newManifest(config)
+	}
+	m := newManifest(config)
+	m.Runtime = p.Runtime
 
-	// 生成vue组件代码
+	// 只有源文件或者依赖改变过才会再次编译，优化性能
+	var todo []compileJob
 	for _, v := range vs {
-		vuePath := v.Path
-		// 读取文件是否改变
-		// 只有改变过才会再次编译，优化性能
-		srcHash := fileMd5(vuePath, version.Version)
-
-		codePath := desc + string(os.PathSeparator) + v.ComponentName + ".vue.go"
-
-		if _, ok := oldVs[v.ComponentName]; ok {
-			oldCode, _ := ioutil.ReadFile(codePath)
-			oldCodeStr := string(oldCode)
-			if strings.Contains(oldCodeStr, "src_hash:") {
-				oldSrcHash := strings.Split(strings.Split(oldCodeStr, "src_hash:")[1], "\n")[0]
-
-				if oldSrcHash == srcHash {
-					// 如果hash相同，则不动老代码
-					delete(willDelOld, v.ComponentName)
-					continue
-				}
-			}
+		srcHash := fileMd5(v.Path, version.Version)
+		// 如果有新代码则不删除老代码, 要么覆盖, 要么不动(新老代码一样)
+		// 有错误的组件也不删除老代码
+		delete(willDelOld, v.ComponentName)
+
+		if _, ok := oldVs[v.ComponentName]; ok && old.fresh(c, v.ComponentName, srcHash) {
+			// 依赖没有改变，则不动老代码
+			m.Components[v.ComponentName] = old.Components[v.ComponentName]
+			continue
 		}
+		todo = append(todo, compileJob{VueFile: v, srcHash: srcHash})
+	}
 
-		newCode := genComponentRenderFunc(c, pkgName, v.ComponentName, v.Path, srcHash)
+	// 并行生成vue组件代码, 结果按照顺序处理, 保证输出稳定
+	for _, r := range c.compileAll(pkgName, todo, config.jobs()) {
+		c.Diagnostics = append(c.Diagnostics, r.diagnostics...)
 
-		if _, ok := oldVs[v.ComponentName]; ok {
-			// 如果有新代码则不删除老代码, 要么覆盖, 要么不动(新老代码一样)
-			delete(willDelOld, v.ComponentName)
-			oldCode, err := ioutil.ReadFile(codePath)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					return errors.NewCoder(err, "read oldCode file")
-				}
-			}
+		// 有错误的组件不写入文件, 也不记录在manifest中
+		if r.diagnostics.HasError() {
+			continue
+		}
 
-			// 对比老代码, 如果新老代码一样则不动作, 否则删除掉老代码, 新写代码
-			if bytes.Equal(oldCode, newCode) {
-				continue
-			}
+		err = s.write(r.ComponentName+".vue.go", r.code)
+		if err != nil {
+			return
+		}
 
-			err = ioutil.WriteFile(codePath, newCode, os.ModePerm)
-			if err != nil {
-				return errors.NewCoder(err, "write oldCode file")
-			}
-		} else {
-			err = ioutil.WriteFile(codePath, newCode, os.ModePerm)
-			if err != nil {
-				return errors.NewCoder(err, "write oldCode file")
-			}
+		deps := map[string]string{}
+		for _, tag := range r.tags {
+			deps[tag] = c.depHash(tag)
 		}
+		m.Components[r.ComponentName] = &manifestComponent{SrcHash: r.srcHash, Deps: deps, Options: c.Options[r.ComponentName]}
 	}
 
 	// 删除应该删除的老文件
 	for _, v := range willDelOld {
-		err = os.Remove(v.Path)
-		if err != nil {
-			err = errors.NewCoder(err, fmt.Sprintf("del oldCode file :%s", v.Path))
-			return
-		}
+		s.remove(v.Path)
 	}
 
-	// builtin代码
-	code = []byte(fmt.Sprintf("// Code generated by go-vue-ssr: https://github.com/zbysir/go-vue-ssr\n\npackage %s\n", pkgName) +
-		strings.ReplaceAll(builtinCode, "package xxx", ""))
-	err = ioutil.WriteFile(desc+string(os.PathSeparator)+"builtin.go", code, 0666)
+	// 所有组件的css
+	err = genStyles(vs, s)
 	if err != nil {
 		return
 	}
 
-	return
-}
+	// builtin代码, 使用共享运行时时只生成运行时的别名
+	builtin := strings.ReplaceAll(builtinCode, "package xxx", "")
+	if p.Runtime {
+		builtin = runtimeAliasCode + fmt.Sprintf("\n// 检查共享运行时的版本是否与生成代码的go-vue-ssr版本一致, 建议在程序启动时调用\n"+
+			"func CheckRuntimeVersion() error {\nreturn runtime.CheckVersion(%q)\n}\n", version.Version)
+	}
+	code = []byte(fmt.Sprintf("// Code generated by go-vue-ssr: https://github.com/zbysir/go-vue-ssr\n\npackage %s\n", pkgName) + builtin)
+	err = s.write("builtin.go", code)
+	if err != nil {
+		return
+	}
 
-func GenAllFileWithWatch(ctx context.Context, src, desc string, pkg string) (err error) {
-	log.Infof("watching dir and subdirectories: %s", src)
+	// manifest最后写入, 中断时下一次会重新编译
+	err = s.write(manifestFile, m.encode())
+	if err != nil {
+		return
+	}
+	// go/format只能发现语法错误, 使用go/types检查生成的包, 发现使用了不存在的变量, 类型错误等问题
+	if !c.Diagnostics.HasError() && s.changed() {
+		c.typeCheck(s, vs)
+	}
 
-	w := watcher.New()
+	// 有错误时不写入任何文件, 保留上一次生成的代码, 否则其他组件与creator.go会引用没有生成的组件
+	c.Diagnostics.Log()
+	if n := c.Diagnostics.ErrorCount(); n != 0 {
+		err = fmt.Errorf("compile failed with %d errors", n)
+		return
+	}
 
-	err = w.AddRecursive(src)
+	err = s.commit()
 	if err != nil {
 		return
 	}
 
-	w.SetMaxEvents(1)
-	// Only files that match the regular expression during file listings
-	// will be watched.
-	r := regexp.MustCompile(".vue$")
-	w.AddFilterHook(watcher.RegexFilterHook(r, false))
+	return
+}
 
-	go w.Start(400 * time.Millisecond)
-	defer w.Close()
+type compileJob struct {
+	VueFile
+	srcHash string
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case err = <-w.Error:
-			return
-		case e, ok := <-w.Event:
-			if ok {
-				log.Infof("file changed: %v", e.Path)
-				err = GenAllFile(src, desc, pkg)
-				if err != nil {
-					return
-				}
-				log.Infof("compile success")
-			} else {
-				return
+// 一个组件的编译结果
+type compileResult struct {
+	compileJob
+	code        []byte
+	tags        []string
+	diagnostics Diagnostics
+}
+
+// 使用n个goroutine并行编译组件, 返回的结果和jobs的顺序一致.
+// 模板中的错误记录在Diagnostics中, 编译中意外的panic会在编译完成之后在调用的goroutine中重新panic.
+func (c *Compiler) compileAll(pkgName string, jobs []compileJob, n int) []compileResult {
+	results := make([]compileResult, len(jobs))
+	panics := make([]interface{}, len(jobs))
+
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				func() {
+					defer func() {
+						panics[i] = recover()
+					}()
+					results[i] = c.compile(pkgName, jobs[i])
+				}()
 			}
+		}()
+	}
+	for i := range jobs {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	for _, p := range panics {
+		if p != nil {
+			panic(p)
+		}
+	}
+	return results
+}
+
+// 使用复制的编译器编译一个组件, 可以在多个goroutine中同时调用
+func (c *Compiler) compile(pkgName string, job compileJob) compileResult {
+	fc := c.fork()
+	code := genComponentCode(fc, pkgName, job.ComponentName, job.Path, job.sfc, job.sfcErr, job.srcHash)
+	return compileResult{
+		compileJob:  job,
+		code:        code,
+		tags:        fc.tags,
+		diagnostics: fc.Diagnostics,
+	}
+}
+
+// 将所有组件<style>中的css写入styles.css, 没有css时会删除styles.css
+func genStyles(vs []VueFile, s *staging) (err error) {
+	var css strings.Builder
+	for _, v := range vs {
+		// 无法解析的组件在编译时已经报告了错误
+		if v.sfcErr != nil {
+			continue
 		}
+		c := v.sfc.Css(v.ComponentName)
+		if c == "" {
+			continue
+		}
+		css.WriteString(fmt.Sprintf("/* %s */\n%s\n", v.Filename, c))
 	}
+
+	if css.Len() == 0 {
+		s.remove(filepath.Join(s.desc, "styles.css"))
+		return
+	}
+
+	return s.write("styles.css", []byte(css.String()))
 }
 
 func walkDir(dirPth string, suffix string) (files []string, err error) {
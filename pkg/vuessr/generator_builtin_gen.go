@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/zbysir/go-vue-ssr/pkg/ssrtool/rinterface"
 	"html"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -30,6 +31,19 @@ type Render struct {
 	writerCreator func() Writer
 
 	// 一个Render可能不只一个Write, 多个Write可能并行
+
+	// <teleport>收集的节点, 将在<teleport-target>中输出
+	teleports *teleports
+	// v-on收集的事件
+	von *vonManifest
+	// 本次渲染中用到的组件css, 将在<style-outlet>中输出
+	styles *blocks
+	// 本次渲染中用到的组件<script client>, 将在<script-outlet>中输出
+	scripts *blocks
+
+	// strict模式, 见RenderCreator.Strict
+	strict   bool
+	warnings *warnings
 }
 
 func (r Render) NewWriter() Writer {
@@ -45,6 +59,18 @@ func (r *Render) Render(name string, w Writer, options *Options) {
 	w.WriteString(fmt.Sprintf("<p>not register component: %s</p>", name))
 }
 
+// 获取本次渲染中所有v-on事件, 用于给前端绑定事件
+func (r *Render) VonManifest() []VonEvent {
+	return r.von.get()
+}
+
+// 获取本次渲染中的警告, 只在strict模式下收集, 如:
+//   - 模板中使用了未定义的变量
+//   - 缺少组件必须的prop, prop的类型不正确
+func (r *Render) Warnings() []Warning {
+	return r.warnings.get()
+}
+
 // 用来低成本生成一个Render
 // 注意: RenderCreator里所有变量在初始化之后都不应该被修改, 在Render中不应该有对其有副作用的操作.
 type RenderCreator struct {
@@ -55,6 +81,11 @@ type RenderCreator struct {
 	Directives map[string]DirectivesFunc
 	// 支持在指令里新生成一个Writer (用于异步渲染)
 	WriterCreator func() Writer
+	// strict模式, 用于开发与测试, 渲染时会检查并记录警告(见Render.Warnings):
+	//   - 模板中使用了未定义的变量 (Scope.Get找不到变量), 如拼写错误的{{tittle}}
+	//   - 组件声明的prop类型不正确或者缺少required的prop
+	// 由于会有额外的开销, 不建议在生产环境中开启.
+	Strict bool
 }
 
 func (c *RenderCreator) NewRender() *Render {
@@ -64,6 +95,12 @@ func (c *RenderCreator) NewRender() *Render {
 		components:    c.Components,
 		directives:    c.Directives,
 		writerCreator: c.WriterCreator,
+		teleports:     &teleports{m: map[string][]Span{}},
+		von:           &vonManifest{},
+		styles:        newBlocks(),
+		scripts:       newBlocks(),
+		strict:        c.Strict,
+		warnings:      &warnings{},
 	}
 }
 
@@ -77,27 +114,81 @@ func (c *RenderCreator) Func(name string, f Function) {
 	c.Var.Set(name, f)
 }
 
+// 使用另一个包生成的组件库, 合并它的组件与指令, 之后在模板中就可以使用库中的组件.
+// 只有使用共享运行时(pkg/vuessr/runtime)生成的包才能互相使用, 它们的Render等类型是相同的.
+// 有重名的组件或者指令时返回错误, 并且不会修改c. 库中注册的全局变量与方法不会被合并.
+func (c *RenderCreator) Use(lib *RenderCreator) error {
+	var conflicts []string
+	for name := range lib.Components {
+		if _, ok := c.Components[name]; ok {
+			conflicts = append(conflicts, "component "+name)
+		}
+	}
+	builtin := builtinDirectives()
+	for name := range lib.Directives {
+		if _, ok := builtin[name]; ok {
+			continue
+		}
+		if _, ok := c.Directives[name]; ok {
+			conflicts = append(conflicts, "directive "+name)
+		}
+	}
+	if len(conflicts) != 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("conflict with registered: %s", strings.Join(conflicts, ", "))
+	}
+
+	if c.Components == nil {
+		c.Components = map[string]ComponentFunc{}
+	}
+	for name, f := range lib.Components {
+		c.Components[name] = f
+	}
+	if c.Directives == nil {
+		c.Directives = map[string]DirectivesFunc{}
+	}
+	for name, f := range lib.Directives {
+		if _, ok := builtin[name]; !ok {
+			c.Directives[name] = f
+		}
+	}
+	return nil
+}
+
 // newRenderCreator 由代码生成器调用, 用作初始化(减少代码生成)
 func newRenderCreator() *RenderCreator {
+	v := NewScope(nil)
+	v.Set("inject", Function(inject))
+
 	return &RenderCreator{
-		Var:        NewScope(nil),
+		Var:        v,
 		Components: nil, // inject by generator
-		Directives: map[string]DirectivesFunc{
-			"v-show": func(r *Render, w Writer, binding DirectivesBinding, options *Options) {
-				if !rinterface.ToBool(binding.Value) {
-					if options.Style == nil {
-						options.Style = map[string]string{}
-					}
-					options.Style["display"] = "none"
-				}
-			},
-		},
+		Directives: builtinDirectives(),
 		WriterCreator: func() Writer {
 			return NewBufferSpans()
 		},
 	}
 }
 
+// 运行时自带的指令
+func builtinDirectives() map[string]DirectivesFunc {
+	return map[string]DirectivesFunc{
+		// 收集组件实例的数据, 作为data参数传递给组件的<script client>, 见_scriptOutlet
+		// 参数是组件名, 由编译器生成
+		"v-client-data": func(r *Render, w Writer, binding DirectivesBinding, options *Options) {
+			r.scripts.add(binding.Arg, nil, binding.Value)
+		},
+		"v-show": func(r *Render, w Writer, binding DirectivesBinding, options *Options) {
+			if !rinterface.ToBool(binding.Value) {
+				if options.Style == nil {
+					options.Style = map[string]string{}
+				}
+				options.Style["display"] = "none"
+			}
+		},
+	}
+}
+
 type Store map[string]interface{}
 
 func (g Store) Get(key string) interface{} {
@@ -128,8 +219,10 @@ type Function func(r *Render, options *Options, args ...interface{}) interface{}
 
 type DirectivesBinding struct {
 	Value interface{}
-	Arg   string
+	Arg   string // v-tooltip:top, 动态参数v-tooltip:[placement]会计算为字符串
 	Name  string
+	// 修饰符, v-tooltip.lazy.once => {"lazy": true, "once": true}
+	Modifiers map[string]bool
 }
 
 type DirectivesFunc func(r *Render, w Writer, b DirectivesBinding, options *Options)
@@ -145,6 +238,13 @@ func emptyFunc(r *Render, options *Options, args ...interface{}) interface{} {
 type Scope struct {
 	p      *Scope
 	values map[string]interface{}
+	// strict模式下用于记录未定义的变量, 子作用域会继承
+	trace *scopeTrace
+}
+
+type scopeTrace struct {
+	r         *Render
+	component string
 }
 
 func (s *Scope) ParentScope() *Scope {
@@ -172,17 +272,27 @@ func (s *Scope) Find(k string) map[string]interface{} {
 }
 
 func NewScope(parent *Scope) *Scope {
-	return &Scope{
-		p:      parent,
-		values: map[string]interface{}{},
-	}
+	return extendScope(parent, map[string]interface{}{})
 }
 
 func extendScope(parent *Scope, data map[string]interface{}) *Scope {
-	return &Scope{
+	s := &Scope{
 		p:      parent,
 		values: data,
 	}
+	if parent != nil {
+		s.trace = parent.trace
+	}
+	return s
+}
+
+// 组件的作用域, 由没有<script>声明的组件调用
+func propsScope(r *Render, name string, options *Options) *Scope {
+	s := extendScope(r.Global, options.Props.data)
+	if r.strict {
+		s.trace = &scopeTrace{r: r, component: name}
+	}
+	return s
 }
 
 // 获取作用域中的变量
@@ -206,6 +316,9 @@ func (s *Scope) Get(k ...string) (v interface{}) {
 		curr = curr.p
 	}
 
+	if s.trace != nil && len(k) != 0 {
+		s.trace.r.warnings.add(s.trace.component, fmt.Sprintf("undefined variable '%s': %s", k[0], strings.Join(k, ".")))
+	}
 	return
 }
 
@@ -243,20 +356,35 @@ func NewBufferSpan(s string) Span {
 }
 
 // buffer块, 同步计算
+// 写入的Span不会立即计算, 而是在Result时才计算, 这样Span就可以输出在它之后才渲染的内容(如teleport)
 type BufferWriter struct {
-	s *strings.Builder
+	s     *strings.Builder
+	spans []Span // 在s之前写入的块
 }
 
-func (p BufferWriter) WriteSpan(span Span) {
-	p.s.WriteString(span.Result())
+func (p *BufferWriter) WriteSpan(span Span) {
+	if p.s.Len() != 0 {
+		p.spans = append(p.spans, &BufferSpan{s: p.s})
+		p.s = &strings.Builder{}
+	}
+	p.spans = append(p.spans, span)
 }
 
-func (p BufferWriter) WriteString(s string) {
+func (p *BufferWriter) WriteString(s string) {
 	p.s.WriteString(s)
 }
 
-func (p BufferWriter) Result() string {
-	return p.s.String()
+func (p *BufferWriter) Result() string {
+	if len(p.spans) == 0 {
+		return p.s.String()
+	}
+
+	var b strings.Builder
+	for _, s := range p.spans {
+		b.WriteString(s.Result())
+	}
+	b.WriteString(p.s.String())
+	return b.String()
 }
 
 func NewBufferSpans() Writer {
@@ -403,7 +531,10 @@ func _component(r *Render, w Writer, options *Options) {
 	}
 
 	if c, ok := r.components[is]; ok {
-		c(r, w, options)
+		// is只用于选择组件, 不会传递给组件, 也不会出现在$attrs中
+		o := *options
+		o.Props = options.Props.omit("is")
+		c(r, w, &o)
 		return
 	}
 	w.WriteString(fmt.Sprintf("<p>not register com: %s</p>", is))
@@ -416,6 +547,52 @@ func _template(r *Render, w Writer, options *Options) {
 	options.Slots.Exec(w, "default", Props{})
 }
 
+// v-once渲染的html, 进程级别的缓存, key是包的import path, 组件名与节点的序号
+var onceCache sync.Map
+
+// v-once, 第一次渲染后缓存html
+// tip: 缓存中的html是同步计算的, 所以v-once中不应该有<teleport-target>等延迟计算的组件
+// 缓存中还会记录渲染时用到的组件css/js, v-client-data与v-on事件, 在之后的渲染中重新注册.
+// v-on事件的id在每次渲染中是唯一的, 重新注册时会使用新的id, 并替换html中的data-von-id.
+func _once(r *Render, w Writer, key string, f func(w Writer)) {
+	if c, ok := onceCache.Load(key); ok {
+		c := c.(onceCached)
+		for _, u := range c.styles {
+			r.styles.add(u.ID, u.block, u.data...)
+		}
+		for _, u := range c.scripts {
+			r.scripts.add(u.ID, u.block, u.data...)
+		}
+		html := c.html
+		if len(c.events) != 0 {
+			html = r.von.replay(c.events).Replace(html)
+		}
+		w.WriteString(html)
+		return
+	}
+
+	styles := r.styles.snapshot()
+	scripts := r.scripts.snapshot()
+	events := r.von.snapshot()
+	ow := r.NewWriter()
+	f(ow)
+	c := onceCached{
+		html:    ow.Result(),
+		styles:  r.styles.since(styles),
+		scripts: r.scripts.since(scripts),
+		events:  r.von.since(events),
+	}
+	onceCache.Store(key, c)
+	w.WriteString(c.html)
+}
+
+type onceCached struct {
+	html    string
+	styles  []usedBlock
+	scripts []usedBlock
+	events  []VonEvent
+}
+
 // 内置组件Slot, 将渲染父级传递的slot.
 func _slot(r *Render, w Writer, options *Options) {
 	attr, _ := options.Attrs.Get("name")
@@ -448,6 +625,224 @@ func _async(r *Render, w Writer, options *Options) {
 	return
 }
 
+// 内置组件teleport, 将子节点渲染到同名的<teleport-target>处, 而不是当前位置.
+// <teleport to="body-end">...</teleport>
+// 当disabled为true时则在当前位置渲染.
+func _teleport(r *Render, w Writer, options *Options) {
+	if builtinArgBool(options, "disabled") {
+		options.Slots.Exec(w, "default", Props{})
+		return
+	}
+
+	tw := r.NewWriter()
+	options.Slots.Exec(tw, "default", Props{})
+	r.teleports.add(builtinArg(options, "to"), tw)
+}
+
+// 内置组件teleport-target, 输出所有to为name的teleport内容.
+// <teleport-target name="body-end"></teleport-target>
+// 由于输出的是延迟计算的Span, 所以target可以写在teleport之前.
+// 注意: 在<async>中的target会在异步渲染结束时就计算结果, 只能输出在这之前收集到的内容.
+func _teleportTarget(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&teleportSpan{
+		t:    r.teleports,
+		name: builtinArg(options, "name"),
+	})
+}
+
+type teleports struct {
+	l sync.Mutex
+	m map[string][]Span
+}
+
+func (t *teleports) add(name string, s Span) {
+	t.l.Lock()
+	t.m[name] = append(t.m[name], s)
+	t.l.Unlock()
+}
+
+func (t *teleports) get(name string) []Span {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.m[name]
+}
+
+type teleportSpan struct {
+	t    *teleports
+	name string
+}
+
+func (p *teleportSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.t.get(p.name) {
+		b.WriteString(s.Result())
+	}
+	return b.String()
+}
+
+// 内置组件von-outlet, 输出本次渲染中所有v-on事件的json, 供前端的事件分发脚本使用.
+// 和teleport-target一样是延迟计算的, 可以写在任意位置.
+func _vonOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&vonSpan{m: r.von})
+}
+
+// 组件<style>中的css或者<script client>中的js, 由代码生成器生成, id是组件名
+type block struct {
+	ID   string
+	Code string
+}
+
+// 组件渲染时注册自己的css
+func useStyle(r *Render, b *block) {
+	r.styles.add(b.ID, b)
+}
+
+// 组件渲染时注册自己的<script client>
+func useScript(r *Render, b *block) {
+	r.scripts.add(b.ID, b)
+}
+
+// 本次渲染中用到的块, 每个块只记录一次
+type blocks struct {
+	l sync.Mutex
+	m map[string]*usedBlock
+}
+
+type usedBlock struct {
+	*block
+	// v-client-data收集的组件实例数据, 按照渲染顺序排列
+	data []interface{}
+}
+
+func newBlocks() *blocks {
+	return &blocks{m: map[string]*usedBlock{}}
+}
+
+// 注册块与数据, b为nil时只记录数据
+func (s *blocks) add(id string, b *block, data ...interface{}) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	u, ok := s.m[id]
+	if !ok {
+		u = &usedBlock{}
+		s.m[id] = u
+	}
+	if b != nil {
+		u.block = b
+	}
+	u.data = append(u.data, data...)
+}
+
+// 按照id排序, 保证每次渲染的顺序一致, 没有注册块(只有数据)的不会返回
+func (s *blocks) get() []usedBlock {
+	s.l.Lock()
+	defer s.l.Unlock()
+	bs := make([]usedBlock, 0, len(s.m))
+	for _, u := range s.m {
+		if u.block != nil {
+			bs = append(bs, usedBlock{block: u.block, data: append([]interface{}{}, u.data...)})
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool {
+		return bs[i].ID < bs[j].ID
+	})
+	return bs
+}
+
+// 记录当前每个块的数据长度, 配合since获取之后新注册的块与数据
+func (s *blocks) snapshot() map[string]int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	m := make(map[string]int, len(s.m))
+	for id, u := range s.m {
+		if u.block != nil {
+			m[id] = len(u.data)
+		}
+	}
+	return m
+}
+
+func (s *blocks) since(snapshot map[string]int) (bs []usedBlock) {
+	for _, u := range s.get() {
+		n, ok := snapshot[u.ID]
+		if !ok {
+			bs = append(bs, u)
+		} else if len(u.data) > n {
+			bs = append(bs, usedBlock{block: u.block, data: u.data[n:]})
+		}
+	}
+	return
+}
+
+// 获取本次渲染中用到的所有组件的css
+func (r *Render) Css() string {
+	var b strings.Builder
+	for _, s := range r.styles.get() {
+		b.WriteString(s.Code)
+	}
+	return b.String()
+}
+
+// 内置组件style-outlet, 输出本次渲染中用到的组件的css, 每个组件一个<style>.
+// 和teleport-target一样是延迟计算的, 可以写在<head>中.
+func _styleOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&styleSpan{s: r.styles})
+}
+
+type styleSpan struct {
+	s *blocks
+}
+
+func (p *styleSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.s.get() {
+		b.WriteString("<style data-style-id=\"" + s.ID + "\">" + s.Code + "</style>")
+	}
+	return b.String()
+}
+
+// 内置组件script-outlet, 输出本次渲染中用到的组件的<script client>, 每个组件一个<script>.
+// 组件的js会被包裹在方法中执行, v-client-data收集的所有实例数据将作为data参数传入:
+//   <script data-script-id="swiper">(function(data){...})([{"id":1}]);</script>
+func _scriptOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&scriptSpan{s: r.scripts})
+}
+
+type scriptSpan struct {
+	s *blocks
+}
+
+func (p *scriptSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.s.get() {
+		data := s.data
+		if data == nil {
+			data = []interface{}{}
+		}
+		bs, _ := json.Marshal(data)
+		b.WriteString("<script data-script-id=\"" + s.ID + "\">(function(data){\n" + s.Code + "\n})(" + string(bs) + ");</script>")
+	}
+	return b.String()
+}
+
+// 获取内置组件的参数, 支持静态写法name="x"与动态写法:name="x"
+func builtinArg(options *Options, key string) string {
+	if v, ok := options.Props.Get(key); ok {
+		return interfaceToStr(v)
+	}
+	attr, _ := options.Attrs.Get(key)
+	return attr.Val
+}
+
+// 获取内置组件的bool参数, 静态写法只要存在这个attr就是true
+func builtinArgBool(options *Options, key string) bool {
+	if v, ok := options.Props.Get(key); ok {
+		return interfaceToBool(v)
+	}
+	_, ok := options.Attrs.Get(key)
+	return ok
+}
+
 // voidElements 没有子元素, 会渲染成 <br/> 这样的格式
 var voidElements = map[string]bool{
 	"area":   true,
@@ -480,10 +875,31 @@ func _tag(r *Render, w Writer, tagName string, isRoot bool, options *Options) {
 		p = options.P
 	}
 
+	// v-bind="obj"展开的class/style在Props中, 需要和静态class/style合并
+	class, style, props := options.Class, options.Style, options.Props
+	c, hasClass := props.Get("class")
+	if hasClass {
+		class = append(getClassFromProps(c), class...)
+	}
+	s, hasStyle := props.Get("style")
+	if hasStyle {
+		st := getStyleFromProps(styleToMap(s))
+		for k, v := range style {
+			st[k] = v
+		}
+		style = st
+	}
+	if hasClass || hasStyle {
+		props = props.omit("class", "style")
+	}
+
 	// attr
-	attr := mixinClass(p, options.Class, options.PropsClass) +
-		mixinStyle(p, options.Style, options.PropsStyle) +
-		mixinAttr(p, options.Attrs, options.Props)
+	attr := mixinClass(p, class, options.PropsClass) +
+		mixinStyle(p, style, options.PropsStyle) +
+		mixinAttr(p, options.Attrs, props)
+	if len(options.VonDirectives) != 0 {
+		attr += vonAttr(r, options.VonDirectives)
+	}
 
 	if voidElements[tagName] {
 		w.WriteString(fmt.Sprintf("<%s%s/>", tagName, attr))
@@ -541,6 +957,224 @@ type Options struct {
 	// tips: 由于渲染顺序, 修改只会影响到子节点
 	Scope   *Scope
 	Provide map[string]interface{}
+
+	// 组件在<script>中声明的信息, 在组件render方法中设置, 没有声明时为nil
+	meta *componentMeta
+}
+
+// 组件在<script>中声明的选项, 由代码生成器生成
+type componentMeta struct {
+	Props        map[string]bool // 声明的props, 为nil表示没有声明
+	InheritAttrs bool
+	// 模板中读取了$attrs, 只有这时才会生成$attrs
+	Attrs bool
+	// 没有声明props时也把所有props渲染为attr, 见fallthroughProps
+	AllAttrs bool
+	// <style module>中的class, 如{"$style": {"title": "title_5f2b1c3a"}}
+	Modules map[string]map[string]interface{}
+	// props的默认值, 上层没有传递这个prop时使用
+	Defaults map[string]interface{}
+
+	// 以下用于strict模式
+	Name string
+	// props声明的类型, 如{"size": {"Number", "String"}}
+	Types    map[string][]string
+	Required map[string]bool
+}
+
+// 生成组件的作用域, 由有<script>/<style module>或者使用了$attrs的组件调用
+// $attrs与静态传递的props(如<card title="hi">)存放在Props的上一层作用域中, 避免修改Props.
+func componentScope(r *Render, options *Options, meta *componentMeta) *Scope {
+	options.meta = meta
+	s := NewScope(r.Global)
+	if meta != nil && meta.Attrs {
+		s.Set("$attrs", options.attrs().Map())
+	}
+	if meta != nil {
+		for name, classes := range meta.Modules {
+			s.Set(name, classes)
+		}
+		if r.strict {
+			s.trace = &scopeTrace{r: r, component: meta.Name}
+			// 声明了但没有传递的prop是undefined, 而不是未定义的变量
+			for name := range meta.Props {
+				s.Set(name, nil)
+			}
+		}
+		for name, v := range meta.Defaults {
+			s.Set(name, v)
+		}
+	}
+	for _, i := range options.Attrs {
+		if options.declared(i.Key) {
+			s.Set(i.Key, i.Val)
+		}
+	}
+	if r.strict && meta != nil {
+		meta.validate(r, options)
+	}
+	return extendScope(s, options.Props.data)
+}
+
+// 检查上层传递的props是否符合声明
+func (m *componentMeta) validate(r *Render, options *Options) {
+	names := make([]string, 0, len(m.Props))
+	for name := range m.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := options.Props.Get(name)
+		if !ok {
+			var attr Attribute
+			attr, ok = options.Attrs.Get(name)
+			v = attr.Val
+		}
+		if !ok {
+			if m.Required[name] {
+				r.warnings.add(m.Name, fmt.Sprintf("missing required prop '%s'", name))
+			}
+			continue
+		}
+		if types := m.Types[name]; v != nil && len(types) != 0 && !isJsType(v, types) {
+			r.warnings.add(m.Name, fmt.Sprintf("invalid prop '%s': expected %s, got %T", name, strings.Join(types, "|"), v))
+		}
+	}
+}
+
+// 值是否是js中的某个类型, 未知的类型(如Date)认为都符合
+func isJsType(v interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "String":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "Boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "Number":
+			switch v.(type) {
+			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+				return true
+			}
+		case "Array":
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+				return true
+			}
+		case "Object":
+			if reflect.ValueOf(v).Kind() == reflect.Map {
+				return true
+			}
+		case "Function":
+			if _, ok := v.(Function); ok {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// strict模式下收集的警告
+type Warning struct {
+	Component string
+	Message   string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s, component: %s", w.Message, w.Component)
+}
+
+// 同一个警告只记录一次 (如v-for中每次循环都会读取一次未定义的变量)
+type warnings struct {
+	l    sync.Mutex
+	list []Warning
+	seen map[Warning]bool
+}
+
+func (s *warnings) add(component, message string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	w := Warning{Component: component, Message: message}
+	if s.seen[w] {
+		return
+	}
+	if s.seen == nil {
+		s.seen = map[Warning]bool{}
+	}
+	s.seen[w] = true
+	s.list = append(s.list, w)
+}
+
+func (s *warnings) get() []Warning {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]Warning(nil), s.list...)
+}
+
+// 是否是组件声明了的prop
+func (o *Options) declared(key string) bool {
+	return o.meta != nil && o.meta.Props[key]
+}
+
+// 上层传递了但组件没有声明的props与静态attr (不包括class/style)
+// 组件没有声明props时, 所有props都被认为是attr
+func (o *Options) attrs() Props {
+	a := Props{}
+	for _, i := range o.Attrs {
+		if o.declared(i.Key) {
+			continue
+		}
+		a.Set(i.Key, i.Val)
+	}
+	for _, k := range o.Props.orderKey {
+		if k == "class" || k == "style" {
+			continue
+		}
+		if o.declared(k) {
+			continue
+		}
+		a.Set(k, o.Props.data[k])
+	}
+	return a
+}
+
+// 渲染在组件root节点上的静态attr, 不包括组件声明了的prop
+func (o *Options) fallthroughAttrs() []Attribute {
+	if o.meta == nil || o.meta.Props == nil {
+		return o.Attrs
+	}
+	var as []Attribute
+	for _, i := range o.Attrs {
+		if !o.declared(i.Key) {
+			as = append(as, i)
+		}
+	}
+	return as
+}
+
+// 渲染在组件root节点上的props
+// - inheritAttrs: false 时不渲染
+// - 声明了props时渲染未声明的props
+// - 没有声明props时(兼容以前的写法)只渲染id/src/data-*, 使用了inheritAllAttrs配置时渲染所有props
+func (o *Options) fallthroughProps() Props {
+	if o.meta == nil || o.meta.Props == nil && !o.meta.AllAttrs {
+		return o.Props.CanBeAttr()
+	}
+	if !o.meta.InheritAttrs {
+		return Props{}
+	}
+	a := Props{}
+	for _, k := range o.Props.orderKey {
+		if k == "class" || k == "style" || o.declared(k) {
+			continue
+		}
+		a.Set(k, o.Props.data[k])
+	}
+	return a
 }
 
 func (o *Options) SetProvide(d map[string]interface{}) {
@@ -572,16 +1206,142 @@ func (o *Options) GetProvide(k string) (v interface{}) {
 	return nil
 }
 
+// 生成一个带有Provide的Options, 用于元素上的v-provide指令.
+// 复制了所属组件的Options, 所以在子节点中读取options.P(如slot/class)的结果不变.
+func provideOptions(options *Options, provide map[string]interface{}) *Options {
+	o := *options
+	o.P = options
+	o.Provide = provide
+	return &o
+}
+
+// 模板中的inject('key')方法, 读取上层通过v-provide提供的值
+func inject(r *Render, options *Options, args ...interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return options.GetProvide(interfaceToStr(args[0]))
+}
+
 type directive struct {
-	Name  string
-	Value interface{}
-	Arg   string
+	Name      string
+	Value     interface{}
+	Arg       string
+	Modifiers map[string]bool
 }
 
 type vonDirective struct {
-	Event string
-	Func  string
-	Args  []interface{}
+	Event     string
+	Func      string
+	Args      []interface{}
+	Modifiers []string
+}
+
+// v-on事件, 会被序列化为json给前端使用
+type VonEvent struct {
+	Id        string        // 节点上data-von-id的值
+	Event     string        // click
+	Func      string        // 前端的方法名
+	Args      []interface{} // 在服务端计算好的参数
+	Modifiers []string      // @click.prevent.stop, 由前端处理
+}
+
+// 序列化为{id, event, func, args, modifiers}, 没有修饰符时不输出modifiers
+// tip: 此文件会被生成到反引号字符串中, 所以不能使用struct tag
+func (e VonEvent) MarshalJSON() ([]byte, error) {
+	args := e.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+	m := map[string]interface{}{
+		"id":    e.Id,
+		"event": e.Event,
+		"func":  e.Func,
+		"args":  args,
+	}
+	if len(e.Modifiers) != 0 {
+		m["modifiers"] = e.Modifiers
+	}
+	return json.Marshal(m)
+}
+
+type vonManifest struct {
+	l      sync.Mutex
+	events []VonEvent
+	id     int
+}
+
+func (m *vonManifest) add(vs []vonDirective) (id string) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.id++
+	id = "von-" + strconv.Itoa(m.id)
+	for _, v := range vs {
+		m.events = append(m.events, VonEvent{
+			Id:        id,
+			Event:     v.Event,
+			Func:      v.Func,
+			Args:      v.Args,
+			Modifiers: v.Modifiers,
+		})
+	}
+	return
+}
+
+// 已经注册的事件数量, 用于since
+func (m *vonManifest) snapshot() int {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return len(m.events)
+}
+
+// snapshot之后注册的事件
+func (m *vonManifest) since(n int) []VonEvent {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]VonEvent(nil), m.events[n:]...)
+}
+
+// 使用新的id重新注册v-once缓存中的事件, 返回将html中的旧id替换为新id的Replacer
+func (m *vonManifest) replay(es []VonEvent) *strings.Replacer {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	ids := map[string]string{}
+	var oldnew []string
+	for _, e := range es {
+		id, ok := ids[e.Id]
+		if !ok {
+			m.id++
+			id = "von-" + strconv.Itoa(m.id)
+			ids[e.Id] = id
+			oldnew = append(oldnew, "data-von-id=\""+e.Id+"\"", "data-von-id=\""+id+"\"")
+		}
+		e.Id = id
+		m.events = append(m.events, e)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func (m *vonManifest) get() []VonEvent {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return m.events
+}
+
+// 注册节点上的v-on事件, 返回需要添加到节点上的eventId属性
+func vonAttr(r *Render, vs []vonDirective) string {
+	return " data-von-id=\"" + r.von.add(vs) + "\""
+}
+
+type vonSpan struct {
+	m *vonManifest
+}
+
+func (p *vonSpan) Result() string {
+	bs, _ := json.Marshal(p.m.get())
+	return "<script type=\"application/json\" id=\"von-manifest\">" + string(bs) + "</script>"
 }
 
 type directives []directive
@@ -590,9 +1350,10 @@ func (ds directives) Exec(r *Render, w Writer, options *Options) {
 	for _, d := range ds {
 		if f, ok := r.directives[d.Name]; ok {
 			f(r, w, DirectivesBinding{
-				Value: d.Value,
-				Arg:   d.Arg,
-				Name:  d.Name,
+				Value:     d.Value,
+				Arg:       d.Arg,
+				Name:      d.Name,
+				Modifiers: d.Modifiers,
 			}, options)
 		}
 	}
@@ -603,6 +1364,11 @@ type Props struct {
 	data     map[string]interface{} // 存储map有利于快速存取
 }
 
+// 生成的代码中使用, 按照orderKey的顺序生成attr
+func orderedProps(orderKey []string, data map[string]interface{}) Props {
+	return Props{orderKey: orderKey, data: data}
+}
+
 func (p *Props) Del(key string, value interface{}) {
 	for index, k := range p.orderKey {
 		if k == key {
@@ -614,6 +1380,25 @@ func (p *Props) Del(key string, value interface{}) {
 	delete(p.data, key)
 }
 
+// 展开对象中的值, 用于v-bind="obj"
+// 为了生成的attr顺序固定, map会按照key排序
+func (p *Props) Spread(obj interface{}) {
+	switch t := obj.(type) {
+	case Props:
+		for _, k := range t.orderKey {
+			p.Set(k, t.data[k])
+		}
+	case map[string]interface{}:
+		for _, k := range getMapInterfaceKey(t) {
+			p.Set(k, t[k])
+		}
+	case map[string]string:
+		for _, k := range getSortedKey(t) {
+			p.Set(k, t[k])
+		}
+	}
+}
+
 func (p *Props) Set(key string, value interface{}) {
 	if p.data == nil {
 		p.data = map[string]interface{}{}
@@ -648,8 +1433,26 @@ func NewProps(data map[string]interface{}) Props {
 	}
 }
 
+// 去掉一些key, 返回新的Props
+func (p Props) omit(keys ...string) Props {
+	a := Props{}
+	for _, k := range p.orderKey {
+		skip := false
+		for _, o := range keys {
+			if k == o {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			a.Set(k, p.data[k])
+		}
+	}
+	return a
+}
+
 // 能够被当成attr渲染出来的Props
-// 只在自定义组件的rootTag上使用
+// 只在没有声明props的自定义组件的rootTag上使用
 func (p Props) CanBeAttr() Props {
 	htmlAttr := map[string]struct{}{
 		"id":  {},
@@ -723,6 +1526,11 @@ func mixinClass(options *Options, staticClass []string, classProps interface{})
 	}
 
 	if options != nil {
+		// 上层通过v-bind="obj"传递的class
+		if c, ok := options.Props.Get("class"); ok {
+			class = append(class, getClassFromProps(c)...)
+		}
+
 		// 上层传递的props
 		if options.PropsClass != nil {
 			for _, c := range getClassFromProps(options.PropsClass) {
@@ -765,6 +1573,13 @@ func mixinStyle(options *Options, staticStyle map[string]string, styleProps map[
 	}
 
 	if options != nil {
+		// 上层通过v-bind="obj"传递的style
+		if s, ok := options.Props.Get("style"); ok {
+			for k, v := range getStyleFromProps(styleToMap(s)) {
+				style[k] = v
+			}
+		}
+
 		// 上层传递的props
 		if options.PropsStyle != nil {
 			ps := getStyleFromProps(options.PropsStyle)
@@ -797,13 +1612,13 @@ func mixinAttr(options *Options, staticAttr []Attribute, propsAttr Props) string
 	// 当前props中的attr
 	attrs = append(attrs, getAttrFromProps(propsAttr)...)
 
-	if options != nil {
-		// 上层传递的静态style
-		attrs = append(attrs, options.Attrs...)
+	if options != nil && (options.meta == nil || options.meta.InheritAttrs) {
+		// 上层传递的静态attr
+		attrs = append(attrs, options.fallthroughAttrs()...)
 
 		// 上层传递的props
 		if options.Props.data != nil {
-			attrs = append(attrs, getAttrFromProps(options.Props.CanBeAttr())...)
+			attrs = append(attrs, getAttrFromProps(options.fallthroughProps())...)
 		}
 	}
 
@@ -869,7 +1684,8 @@ func genAttr(attr []Attribute) string {
 			st.WriteByte(' ')
 		}
 		if k.Val != "" {
-			st.WriteString(k.Key + "=" + "\"" + k.Val + "\"")
+			// 模板中的静态属性值没有转义, 其中的"会破坏属性
+			st.WriteString(k.Key + "=" + "\"" + strings.ReplaceAll(k.Val, "\"", "&#34;") + "\"")
 		} else {
 			st.WriteString(k.Key)
 		}
@@ -894,6 +1710,25 @@ func getStyleFromProps(styleProps map[string]interface{}) map[string]string {
 	return st
 }
 
+// 将style的值转为map, 支持map与字符串"color: red; top: 0"
+func styleToMap(style interface{}) map[string]interface{} {
+	switch t := style.(type) {
+	case map[string]interface{}:
+		return t
+	case string:
+		m := map[string]interface{}{}
+		for _, item := range strings.Split(t, ";") {
+			kv := strings.SplitN(item, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			m[strings.Trim(kv[0], " ")] = strings.Trim(kv[1], " ")
+		}
+		return m
+	}
+	return nil
+}
+
 // bool属性, 如果是 则当值不是true时不会渲染出此属性
 var boolAttr = map[string]bool{
 	"autofocus": true,
@@ -997,6 +1832,55 @@ func getClassFromProps(classProps interface{}) []string {
 	return cs
 }
 
+// v-model在input/textarea上渲染的值
+// trim/number: v-model.trim / v-model.number
+func vModelValue(v interface{}, trim, number bool) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if trim {
+		s = strings.TrimSpace(s)
+		v = s
+	}
+	if number {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			v = f
+		}
+	}
+	return v
+}
+
+// v-model在checkbox上是否选中: 数组model包含value, 否则model为真值
+func vModelChecked(model interface{}, value interface{}) bool {
+	if ms := interface2Slice(model); ms != nil {
+		return vModelContains(ms, value)
+	}
+	return interfaceToBool(model)
+}
+
+// v-model在radio/option上是否选中: model和value相等, 数组model(select multiple)包含value
+func vModelEqual(model interface{}, value interface{}) bool {
+	if ms := interface2Slice(model); ms != nil {
+		return vModelContains(ms, value)
+	}
+	return looseEqual(model, value)
+}
+
+func vModelContains(ms []interface{}, value interface{}) bool {
+	for _, m := range ms {
+		if looseEqual(m, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// 和vue一样, 比较字符串形式, 如1与"1"相等
+func looseEqual(a, b interface{}) bool {
+	return interfaceToStr(a) == interfaceToStr(b)
+}
+
 func lookInterface(data interface{}, keys ...string) (desc interface{}) {
 	m, _, ok := shouldLookInterface(data, keys...)
 	if !ok {
@@ -1006,6 +1890,14 @@ func lookInterface(data interface{}, keys ...string) (desc interface{}) {
 	return m
 }
 
+// 用于解构的默认值: {a = 1}
+func defaultValue(v interface{}, d interface{}) interface{} {
+	if v == nil {
+		return d
+	}
+	return v
+}
+
 func lookInterfaceToSlice(data interface{}, key string) (desc []interface{}) {
 	m, _, ok := shouldLookInterface(data, key)
 	if !ok {
@@ -1046,6 +1938,15 @@ func interfaceToStr(s interface{}, escaped ...bool) (d string) {
 	return
 }
 
+// 有类型的值转为字符串, 用于声明了类型的props, 结果和interfaceToStr一样
+func intToStr(i int) string {
+	return strconv.Itoa(i)
+}
+
+func floatToStr(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
 // 字符串false,0 会被认定为false
 func interfaceToBool(s interface{}) (d bool) {
 	if s == nil {
@@ -1158,7 +2059,6 @@ func interfaceToFunc(s interface{}) (d Function) {
 		return a
 	default:
 		panic(a)
-		return emptyFunc
 	}
 }
 
@@ -1251,4 +2151,119 @@ func shouldLookInterface(data interface{}, keys ...string) (desc interface{}, ro
 
 func escape(src string) string {
 	return html.EscapeString(src)
-}`
\ No newline at end of file
+}`
+
+const runtimeAliasCode = `
+import "github.com/zbysir/go-vue-ssr/pkg/vuessr/runtime"
+
+type (
+	Attribute         = runtime.Attribute
+	Attributes        = runtime.Attributes
+	BufferSpan        = runtime.BufferSpan
+	BufferWriter      = runtime.BufferWriter
+	ChanSpan          = runtime.ChanSpan
+	ComponentFunc     = runtime.ComponentFunc
+	DirectivesBinding = runtime.DirectivesBinding
+	DirectivesFunc    = runtime.DirectivesFunc
+	Function          = runtime.Function
+	Global            = runtime.Global
+	ListSpans         = runtime.ListSpans
+	NamedSlotFunc     = runtime.NamedSlotFunc
+	Options           = runtime.Options
+	Props             = runtime.Props
+	Render            = runtime.Render
+	RenderCreator     = runtime.RenderCreator
+	Scope             = runtime.Scope
+	Slots             = runtime.Slots
+	Span              = runtime.Span
+	Store             = runtime.Store
+	VonEvent          = runtime.VonEvent
+	Warning           = runtime.Warning
+	Writer            = runtime.Writer
+	block             = runtime.Block
+	blocks            = runtime.Blocks
+	componentMeta     = runtime.ComponentMeta
+	directive         = runtime.Directive
+	directives        = runtime.Directives
+	onceCached        = runtime.OnceCached
+	scopeTrace        = runtime.ScopeTrace
+	scriptSpan        = runtime.ScriptSpan
+	styleSpan         = runtime.StyleSpan
+	teleportSpan      = runtime.TeleportSpan
+	teleports         = runtime.Teleports
+	usedBlock         = runtime.UsedBlock
+	vonDirective      = runtime.VonDirective
+	vonManifest       = runtime.VonManifest
+	vonSpan           = runtime.VonSpan
+	warnings          = runtime.Warnings
+)
+
+var (
+	NewBufferSpan        = runtime.NewBufferSpan
+	NewBufferSpans       = runtime.NewBufferSpans
+	NewChanSpan          = runtime.NewChanSpan
+	NewListSpans         = runtime.NewListSpans
+	NewProps             = runtime.NewProps
+	NewScope             = runtime.NewScope
+	_async               = runtime.BuiltinAsync
+	_component           = runtime.BuiltinComponent
+	_once                = runtime.BuiltinOnce
+	_scriptOutlet        = runtime.BuiltinScriptOutlet
+	_slot                = runtime.BuiltinSlot
+	_styleOutlet         = runtime.BuiltinStyleOutlet
+	_tag                 = runtime.BuiltinTag
+	_teleport            = runtime.BuiltinTeleport
+	_teleportTarget      = runtime.BuiltinTeleportTarget
+	_template            = runtime.BuiltinTemplate
+	_vonOutlet           = runtime.BuiltinVonOutlet
+	builtinArg           = runtime.BuiltinArg
+	builtinArgBool       = runtime.BuiltinArgBool
+	builtinDirectives    = runtime.BuiltinDirectives
+	componentScope       = runtime.ComponentScope
+	defaultValue         = runtime.DefaultValue
+	emptyFunc            = runtime.EmptyFunc
+	escape               = runtime.Escape
+	extendMap            = runtime.ExtendMap
+	extendScope          = runtime.ExtendScope
+	floatToStr           = runtime.FloatToStr
+	genAttr              = runtime.GenAttr
+	genStyle             = runtime.GenStyle
+	getAttrFromProps     = runtime.GetAttrFromProps
+	getClassFromProps    = runtime.GetClassFromProps
+	getMapInterfaceKey   = runtime.GetMapInterfaceKey
+	getSortedKey         = runtime.GetSortedKey
+	getStyleFromProps    = runtime.GetStyleFromProps
+	inject               = runtime.Inject
+	intToStr             = runtime.IntToStr
+	interface2Slice      = runtime.Interface2Slice
+	interfaceAdd         = runtime.InterfaceAdd
+	interfaceGreater     = runtime.InterfaceGreater
+	interfaceLess        = runtime.InterfaceLess
+	interfaceToBool      = runtime.InterfaceToBool
+	interfaceToFloat     = runtime.InterfaceToFloat
+	interfaceToFunc      = runtime.InterfaceToFunc
+	interfaceToStr       = runtime.InterfaceToStr
+	isJsType             = runtime.IsJsType
+	isNumber             = runtime.IsNumber
+	lookInterface        = runtime.LookInterface
+	lookInterfaceToSlice = runtime.LookInterfaceToSlice
+	looseEqual           = runtime.LooseEqual
+	mixinAttr            = runtime.MixinAttr
+	mixinClass           = runtime.MixinClass
+	mixinStyle           = runtime.MixinStyle
+	newBlocks            = runtime.NewBlocks
+	newRenderCreator     = runtime.NewRenderCreator
+	orderedProps         = runtime.OrderedProps
+	propsScope           = runtime.PropsScope
+	provideOptions       = runtime.ProvideOptions
+	shouldLookInterface  = runtime.ShouldLookInterface
+	styleToMap           = runtime.StyleToMap
+	useScript            = runtime.UseScript
+	useStyle             = runtime.UseStyle
+	vModelChecked        = runtime.VModelChecked
+	vModelContains       = runtime.VModelContains
+	vModelEqual          = runtime.VModelEqual
+	vModelValue          = runtime.VModelValue
+	vonAttr              = runtime.VonAttr
+)
+`
\ No newline at end of file
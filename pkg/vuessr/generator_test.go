@@ -1,6 +1,13 @@
 package vuessr
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/version"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -22,6 +29,45 @@ func TestGenComponentRenderFunc(t *testing.T) {
 	t.Logf("%s", code)
 }
 
+// 只有模板中读取了$attrs变量的组件才会生成$attrs, 字符串'$attrs'不算
+func TestComponentScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		tpl   string
+		attrs bool
+	}{
+		{`<template><p :id="$attrs.id"></p></template>`, true},
+		{`<template><p v-bind="$attrs"></p></template>`, true},
+		{`<template><p>{{'$attrs'}} "$attrs"</p></template>`, false},
+		{`<template><p v-for="$attrs in list">{{$attrs}}</p></template>`, false},
+		// 声明了props的组件也只在读取了$attrs时生成
+		{`<template><p></p></template><script>export default {props: ['a']}</script>`, false},
+		{`<template><p v-bind="$attrs"></p></template><script>export default {props: ['a']}</script>`, true},
+	}
+	for i, ca := range cases {
+		file := filepath.Join(dir, "a.vue")
+		ioutil.WriteFile(file, []byte(ca.tpl), 0666)
+		code := genComponentRenderFunc(NewCompiler(), "out", "a", file, "")
+		if strings.Contains(string(code), ", Attrs: true") != ca.attrs {
+			t.Fatalf("case %d: %s", i, code)
+		}
+	}
+
+	// inheritAllAttrs: 没有声明props的组件也会生成meta, 渲染所有props
+	c := NewCompiler()
+	(&Config{InheritAllAttrs: true}).apply(c)
+	file := filepath.Join(dir, "a.vue")
+	ioutil.WriteFile(file, []byte(`<template><p></p></template>`), 0666)
+	if code := genComponentRenderFunc(c, "out", "a", file, ""); !strings.Contains(string(code), ", AllAttrs: true") {
+		t.Fatalf("%s", code)
+	}
+}
+
 func TestShouldLookInterface(t *testing.T) {
 	d, exist := shouldLookInterface([]int64{1, 3}, "length")
 	t.Log(exist, d)
@@ -107,3 +153,764 @@ func shouldLookInterface(data interface{}, key string) (desc interface{}, exist
 
 	return
 }
+
+func TestManifest(t *testing.T) {
+	c := NewCompiler()
+	c.AddComponent("page")
+	m := newManifest(nil)
+	m.Components["page"] = &manifestComponent{SrcHash: "x", Deps: map[string]string{"div": "", "card": ""}}
+	if !m.fresh(c, "page", "x") || m.fresh(c, "page", "y") {
+		t.Fatal("src hash")
+	}
+
+	// 添加了card组件后, 使用了<card>的组件需要重新编译
+	c.AddComponent("card")
+	if m.fresh(c, "page", "x") {
+		t.Fatal("should rebuild after card added")
+	}
+	m.Components["page"].Deps["card"] = c.depHash("card")
+	if !m.fresh(c, "page", "x") {
+		t.Fatal("should be fresh")
+	}
+
+	// card的props声明改变
+	c.Options["card"] = &ComponentOptions{Props: []PropDecl{{Name: "title", Required: true}}}
+	if m.fresh(c, "page", "x") {
+		t.Fatal("should rebuild after props changed")
+	}
+}
+
+func TestStaging(t *testing.T) {
+	desc, err := ioutil.TempDir("", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(desc)
+	ioutil.WriteFile(filepath.Join(desc, "old.vue.go"), []byte("old"), 0666)
+
+	s, err := newStaging(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.clean()
+	s.write("a.vue.go", []byte("a"))
+	s.remove(filepath.Join(desc, "old.vue.go"))
+
+	// commit之前生成目录中没有新文件
+	if _, err := os.Stat(filepath.Join(desc, "a.vue.go")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if err := s.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := ioutil.ReadFile(filepath.Join(desc, "a.vue.go")); string(bs) != "a" {
+		t.Fatal(string(bs))
+	}
+	if _, err := os.Stat(filepath.Join(desc, "old.vue.go")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+// css使用编译时已经解析的SFC生成, 不会再次读取文件
+func TestGenStyles(t *testing.T) {
+	desc, err := ioutil.TempDir("", "styles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(desc)
+	s, err := newStaging(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.clean()
+
+	sfc := &SFC{Blocks: []*SFCBlock{{Tag: "style", Attrs: map[string]string{}, Content: "p { color: red }"}}}
+	vs := []VueFile{
+		{ComponentName: "card", Path: filepath.Join(desc, "not-exist.vue"), Filename: "card.vue", sfc: sfc},
+		{ComponentName: "bad", Path: filepath.Join(desc, "bad.vue"), Filename: "bad.vue", sfcErr: fmt.Errorf("bad")},
+	}
+	err = genStyles(vs, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := ioutil.ReadFile(filepath.Join(s.dir, "styles.css")); string(bs) != "/* card.vue */\np { color: red }\n" {
+		t.Fatal(string(bs))
+	}
+}
+
+// 生成n个组件的树, 每个组件使用两个子组件
+func genComponentTree(t testing.TB, n int) (src string) {
+	src, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		children := ""
+		for _, c := range []int{2*i + 1, 2*i + 2} {
+			if c < n {
+				children += fmt.Sprintf(`<node%d :title="title + '-%d'" :items="items"></node%d>`, c, c, c)
+			}
+		}
+		vue := fmt.Sprintf(`<template>
+  <div class="node" :class="{empty: !items}">
+    <h3 v-if="title.length > 10">{{title}}</h3>
+    <p v-else>{{title}} #%d</p>
+    <ul><li v-for="(item, index) in items" :key="index">{{index}}: {{item.name}}</li></ul>
+    %s
+  </div>
+</template>
+<script>
+export default {
+  props: {
+    title: {type: String, required: true},
+    items: Array,
+  }
+}
+</script>
+<style scoped>
+.node h3 { color: red }
+</style>
+`, i, children)
+		err = ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("node%d.vue", i)), []byte(vue), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestGenAllFileParallel(t *testing.T) {
+	src := genComponentTree(t, 50)
+	defer os.RemoveAll(src)
+
+	var outs []string
+	for _, jobs := range []int{1, 8} {
+		desc, err := ioutil.TempDir("", "out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(desc)
+		err = GenAllFileWithConfig(src, desc, "out", &Config{Jobs: jobs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, desc)
+	}
+
+	// 并行编译的结果和串行一样
+	files, _ := filepath.Glob(filepath.Join(outs[0], "*"))
+	if len(files) < 50 {
+		t.Fatal(files)
+	}
+	for _, f := range files {
+		a, _ := ioutil.ReadFile(f)
+		b, err := ioutil.ReadFile(filepath.Join(outs[1], filepath.Base(f)))
+		if err != nil || !bytes.Equal(a, b) {
+			t.Fatalf("%s is different", f)
+		}
+	}
+}
+
+func BenchmarkGenAllFile(b *testing.B) {
+	src := genComponentTree(b, 500)
+	defer os.RemoveAll(src)
+
+	for _, jobs := range []int{1, 4} {
+		b.Run(fmt.Sprintf("j=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// 删除生成目录, 每次都编译所有组件
+				desc, err := ioutil.TempDir("", "out")
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = GenAllFileWithConfig(src, desc, "out", &Config{Jobs: jobs})
+				os.RemoveAll(desc)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "web", "ui", "form"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "web", "page.vue"), []byte(`<template><ui-button>[[ title ]]</ui-button></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "web", "ui", "button.vue"), []byte(`<template><button><slot></slot></button></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "web", "ui", "form", "input.vue"), []byte(`<template><input></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(dir, ConfigFile), []byte(`
+packages:
+  - src: web
+    to: out
+    prefixes: {ui: ui}
+delimiters: ["[[", "]]"]
+whitespace: condense
+`), 0666)
+
+	config, err := LoadConfig(filepath.Join(dir, ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Packages[0].Src != filepath.Join(dir, "web") {
+		t.Fatal(config.Packages)
+	}
+	err = GenPackages(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"page", "uiButton", "uiInput"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name+".vue.go")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "out", "page.vue.go"))
+	if !strings.Contains(string(bs), "xx_uiButton(") || !strings.Contains(string(bs), `scope.Get("title")`) {
+		t.Fatal(string(bs))
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, ConfigFile), []byte(`whitespace: none`), 0666)
+	_, err = LoadConfig(filepath.Join(dir, ConfigFile))
+	if err == nil {
+		t.Fatal("should be invalid")
+	}
+}
+
+func TestGenPackagesImports(t *testing.T) {
+	dir := moduleTempDir(t, "imports")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "app"), os.ModePerm)
+	os.MkdirAll(filepath.Join(dir, "lib"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "app", "page.vue"), []byte(`<template>
+  <div>
+    <my-button title="ok" :size="2" @click="submit" v-once>
+      <template v-slot:icon="{ name }"><i :class="name"></i></template>
+      <span v-for="item in items">{{item}}</span>
+    </my-button>
+    <item-card v-for="item in items" :title="item" :key="item"></item-card>
+  </div>
+</template>`), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "app", "item-card.vue"), []byte(`<template>
+  <my-button :title="title" :class="{active: title == 'a'}" style="color: red"><slot></slot></my-button>
+</template>
+<script>
+export default {props: {title: String}}
+</script>`), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "lib", "my-button.vue"), []byte(`<template>
+  <button :title="title" :data-size="size * 2" v-once>
+    <slot name="icon" :name="'icon-' + title"></slot>
+    <slot>{{title}}</slot>
+  </button>
+</template>
+<script>
+export default {props: {title: {type: String, required: true}, size: {type: Number, goType: 'int', default: 1}}}
+</script>
+<style scoped>
+button { color: red }
+</style>`), 0666)
+
+	// 被导入的包先编译
+	config := &Config{Packages: []Package{
+		{Src: filepath.Join(dir, "app"), To: filepath.Join(dir, "appout"), Runtime: true, Imports: []string{filepath.Join(dir, "libout")}},
+		{Src: filepath.Join(dir, "lib"), To: filepath.Join(dir, "libout"), Runtime: true},
+	}}
+	err := GenPackages(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goBuild(t, filepath.Join(dir, "libout"))
+	goBuild(t, filepath.Join(dir, "appout"))
+
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "appout", "page.vue.go"))
+	if !strings.Contains(string(bs), `r.Render("myButton", w,`) {
+		t.Fatal(string(bs))
+	}
+	bs, _ = ioutil.ReadFile(filepath.Join(dir, "appout", "creator.go"))
+	if strings.Contains(string(bs), "myButton") {
+		t.Fatal(string(bs))
+	}
+	bs, _ = ioutil.ReadFile(filepath.Join(dir, "libout", "builtin.go"))
+	if !strings.Contains(string(bs), `"github.com/zbysir/go-vue-ssr/pkg/vuessr/runtime"`) ||
+		!strings.Contains(string(bs), fmt.Sprintf("return runtime.CheckVersion(%q)", version.Version)) {
+		t.Fatal(string(bs))
+	}
+	bs, _ = ioutil.ReadFile(filepath.Join(dir, "libout", "myButton.vue.go"))
+	if !strings.Contains(string(bs), "func RenderMyButton(r *Render, w Writer, p MyButtonProps)") {
+		t.Fatal(string(bs))
+	}
+
+	// 导入的组件的props也会在编译时检查
+	ioutil.WriteFile(filepath.Join(dir, "app", "page.vue"), []byte(`<template><my-button></my-button></template>`), 0666)
+	err = GenPackages(config)
+	if err == nil {
+		t.Fatal("should report missing required prop")
+	}
+
+	// 导入的包需要使用共享运行时
+	config.Packages[1].Runtime = false
+	err = GenPackages(config)
+	if err == nil || !strings.Contains(err.Error(), "shared runtime") {
+		t.Fatal(err)
+	}
+
+	config.Packages[1].Imports = []string{filepath.Join(dir, "appout")}
+	config.Packages[1].Runtime = true
+	err = GenPackages(config)
+	if err == nil || !strings.Contains(err.Error(), "import cycle") {
+		t.Fatal(err)
+	}
+
+	// 导入的包需要使用相同版本的go-vue-ssr编译
+	m := &manifest{Version: "0.0.1", Runtime: true}
+	ioutil.WriteFile(filepath.Join(dir, "libout", manifestFile), m.encode(), 0666)
+	err = GenPackages(&Config{Packages: config.Packages[:1]})
+	if err == nil || !strings.Contains(err.Error(), "recompile") {
+		t.Fatal(err)
+	}
+}
+
+// 共享运行时的版本与go-vue-ssr不一致时在生成时报告错误
+func TestRuntimeVersionMismatch(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	dir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 使用replace导入另一个版本的运行时
+	runtimeDir := filepath.Join(dir, "old", "pkg", "vuessr", "runtime")
+	os.MkdirAll(runtimeDir, os.ModePerm)
+	os.Mkdir(filepath.Join(dir, "src"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.13\n\n"+
+		"require github.com/zbysir/go-vue-ssr v0.0.0\n\nreplace github.com/zbysir/go-vue-ssr => ./old\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "old", "go.mod"), []byte("module github.com/zbysir/go-vue-ssr\n"), 0666)
+	ioutil.WriteFile(filepath.Join(runtimeDir, "version.go"), []byte("package runtime\n\nconst Version = \"0.0.1\"\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "src", "page.vue"), []byte(`<template><div></div></template>`), 0666)
+
+	desc := filepath.Join(dir, "out")
+	err = genPackage(Package{Src: filepath.Join(dir, "src"), To: desc, Runtime: true}, nil)
+	if err == nil {
+		t.Fatal("should fail")
+	}
+
+	s, err := newStaging(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.clean()
+	s.write("builtin.go", []byte(fmt.Sprintf("package out\n\nimport %q\n\nvar _ = runtime.Version\n", runtimePackage)))
+	c := NewCompiler()
+	c.typeCheck(s, nil)
+	want := fmt.Sprintf("the shared runtime %s is 0.0.1, but go-vue-ssr is %s", runtimePackage, version.Version)
+	if len(c.Diagnostics) != 1 || !strings.Contains(c.Diagnostics[0].Message, want) {
+		t.Fatal(c.Diagnostics)
+	}
+}
+
+// 生成的代码无法编译时报告错误, 不写入文件
+func TestGenInvalidCode(t *testing.T) {
+	// 生成的代码导入了go-vue-ssr中的包, 需要在module中才能检查类型
+	dir := moduleTempDir(t, "invalid")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	desc := filepath.Join(dir, "out")
+	os.Mkdir(src, os.ModePerm)
+
+	// 文本中类似go代码的内容不影响生成的代码
+	ioutil.WriteFile(filepath.Join(src, "text.vue"), []byte("<template><p title='\\\"+\"'>\")\nw.WriteString(\" \"+\" \\ {{ a }}</p></template>"), 0666)
+	ioutil.WriteFile(filepath.Join(src, "page.vue"), []byte(`<template><div><bad></bad></div></template>`), 0666)
+	config := &Config{Plugins: []DirectivePlugin{{Name: "bad", Func: func(e *VueElement, d Directive) {
+		e.Props = append(e.Props, Prop{Key: "x", Code: "a b"})
+	}}}}
+	err := genPackage(Package{Src: src, To: desc}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(src, "bad.vue"), []byte(`<template><p v-bad></p></template>`), 0666)
+	c := NewCompiler()
+	config.apply(c)
+	c.AddComponent("bad")
+	genComponentRenderFunc(c, "out", "bad", filepath.Join(src, "bad.vue"), "")
+	if !c.Diagnostics.HasError() || !strings.Contains(c.Diagnostics[0].Message, "generated code is invalid") {
+		t.Fatal(c.Diagnostics)
+	}
+
+	page, _ := ioutil.ReadFile(filepath.Join(desc, "page.vue.go"))
+	creator, _ := ioutil.ReadFile(filepath.Join(desc, "creator.go"))
+	err = genPackage(Package{Src: src, To: desc}, config)
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if _, err := os.Stat(filepath.Join(desc, "bad.vue.go")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	// 有错误时保留上一次生成的代码, 使用了<bad>的page.vue也不会引用没有生成的组件
+	if bs, _ := ioutil.ReadFile(filepath.Join(desc, "page.vue.go")); string(bs) != string(page) {
+		t.Fatal(string(bs))
+	}
+	if bs, _ := ioutil.ReadFile(filepath.Join(desc, "creator.go")); string(bs) != string(creator) {
+		t.Fatal(string(bs))
+	}
+
+	// 可以解析但是无法编译的代码(如使用了不存在的变量)也会报告错误
+	os.Remove(filepath.Join(src, "bad.vue"))
+	config.Plugins = append(config.Plugins, DirectivePlugin{Name: "undef", Func: func(e *VueElement, d Directive) {
+		e.Props = append(e.Props, Prop{Key: "x", Code: "notDefined"})
+	}})
+	ioutil.WriteFile(filepath.Join(src, "undef.vue"), []byte(`<template><p v-undef></p></template>`), 0666)
+	err = genPackage(Package{Src: src, To: desc}, config)
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if _, err := os.Stat(filepath.Join(desc, "undef.vue.go")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// 生成目录中用户自己的文件有错误时只是警告
+	os.Remove(filepath.Join(src, "undef.vue"))
+	ioutil.WriteFile(filepath.Join(desc, "extra.go"), []byte("package out\n\nvar _ = notDefined\n"), 0666)
+	err = genPackage(Package{Src: src, To: desc}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageComponentName(t *testing.T) {
+	p := Package{Src: "web", Prefixes: map[string]string{"ui": "ui", "ui/form": "f"}}
+	cases := map[string][2]string{
+		// 文件 => 不使用/使用命名空间的组件名
+		"web/page.vue":                {"page", "page"},
+		"web/admin/user/card.vue":     {"card", "adminUserCard"},
+		"web/ui/button.vue":           {"uiButton", "uiButton"},
+		"web/ui/form/input.vue":       {"fInput", "fInput"},
+		"web/ui/form/date/picker.vue": {"fPicker", "fDatePicker"},
+	}
+	for file, want := range cases {
+		p.Namespace = false
+		if name := p.componentName(filepath.FromSlash(file)); name != want[0] {
+			t.Fatalf("%s: %s", file, name)
+		}
+		p.Namespace = true
+		if name := p.componentName(filepath.FromSlash(file)); name != want[1] {
+			t.Fatalf("%s: %s", file, name)
+		}
+	}
+}
+
+func TestLocalComponents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "admin"), os.ModePerm)
+	os.MkdirAll(filepath.Join(src, "shop"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "admin", "button.vue"), []byte(`<template><b></b></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(src, "shop", "button.vue"), []byte(`<template><i></i></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(src, "page.vue"), []byte(`<template><div><btn></btn><admin-button></admin-button></div></template>
+<script>
+import ShopButton from './shop/button.vue'
+export default {components: {btn: ShopButton}}
+</script>`), 0666)
+
+	// 不使用命名空间时两个button冲突
+	err = GenAllFile(src, filepath.Join(dir, "out"), "out")
+	if err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Fatal(err)
+	}
+
+	config := &Config{Packages: []Package{{Src: src, To: filepath.Join(dir, "out"), Namespace: true}}}
+	err = GenPackages(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "out", "page.vue.go"))
+	if !strings.Contains(string(bs), "xx_shopButton(") || !strings.Contains(string(bs), "xx_adminButton(") {
+		t.Fatal(string(bs))
+	}
+	// 局部组件的依赖记录为全局的tag
+	m := loadManifest(filepath.Join(dir, "out"), config)
+	if _, ok := m.Components["page"].Deps["shop-button"]; !ok {
+		t.Fatal(m.Components["page"].Deps)
+	}
+}
+
+// 使用了所有模板功能的组件
+var featureFiles = map[string]string{
+	"card.vue": `<template>
+  <div class="card" v-client-data="{title: title}">
+    <slot name="header" :title="title"></slot>
+    <p v-once>{{title + '!'}} {{size * 2}} {{count + 1}}</p>
+    <p :data-half="count * 0.5" v-if="count > 0.5">{{count + 1.5}} {{size * 0.5}}</p>
+    <p v-if="size > 1">{{inject('theme')}}</p>
+    <slot :item="title"></slot>
+  </div>
+</template>
+<script>
+export default {
+  props: {
+    title: {type: String, required: true},
+    size: {type: Number, default: 1},
+    count: {type: Number, default: 2, goType: 'int'},
+  },
+}
+</script>
+<script client>
+console.log(data)
+</script>
+<style scoped>
+.card p { color: red }
+</style>`,
+	// 模板中的引号不会破坏生成的代码
+	"quote.vue": `<template>
+  <div style='font-family: "Helvetica Neue"' :class='{"a\"b": true}' v-loading:a"b.c"d @click='a"b'>
+    <p @click.stop='a"b("\n", 1)' title='"x"'>{{"\"" + '"'}}</p>
+    <slot name='a"b'></slot>
+  </div>
+</template>`,
+	"panel.vue": `<template>
+  <section :class="$style.panel"><p :class="$style['title']">{{$attrs.role}}</p></section>
+</template>
+<script>
+export default {inheritAttrs: false}
+</script>
+<style module>
+.panel { color: blue }
+.title { color: red }
+</style>`,
+	"page.vue": `<template>
+  <html>
+  <head><style-outlet></style-outlet></head>
+  <body>
+    <card title="a" :size="2" v-provide:theme="'dark'">
+      <template #header="{ title: t, extra = 'def' }"><b>{{t}} {{extra}}</b></template>
+      <template v-slot="props"><i>{{props.item}}</i></template>
+    </card>
+    <card v-for="(item, i) in list" :key="i" :title="item.name" @click="buy(item.id, 'x')"></card>
+    <template v-for="item in list"><template #[item.slot]></template></template>
+    <p v-if="a">x</p>
+    <p v-else-if="b">y</p>
+    <p v-else>z</p>
+    <panel role="note" v-bind="$attrs"></panel>
+    <component :is="'card'" title="dyn" @click="open(1)"></component>
+    <template v-loading="a"><span>t</span></template>
+    <template v-let="{name, age: years, role = 'guest'} = user"><p>{{name}} {{years}} {{role}}</p></template>
+    <p v-let="[first, second] = list">{{first}} {{second}}</p>
+    <div v-let:total="a * 2" :data-total="total" v-bind="attrs" :title.attr="a" v-show="a"></div>
+    <div v-provide:locale="lang"><p :[name]="a" :class="{active: a}" :style="{color: c}">{{a}}</p></div>
+    <input v-model="text"><input type="checkbox" v-model="checked"><input type="radio" value="1" v-model="sel">
+    <textarea v-model.trim="text"></textarea>
+    <select v-model="sel"><option value="1">1</option><option>2</option></select>
+    <div v-html="raw"></div><div v-text="raw"></div>
+    <pre v-pre>{{ msg }}</pre>
+    <teleport to="end"><p>moved</p></teleport>
+    <teleport-target name="end"></teleport-target>
+    <async><p>{{a}}</p></async>
+    <span v-loading:[placement].lazy="msg" @click.prevent="go" @[evt]="go"></span>
+    <button v-tooltip="a">?</button>
+    <von-outlet></von-outlet>
+    <script-outlet></script-outlet>
+    <slot></slot>
+  </body>
+  </html>
+</template>`,
+}
+
+// 在模块中创建临时目录, 生成的包可以使用go build编译
+func moduleTempDir(t *testing.T, prefix string) string {
+	dir, err := ioutil.TempDir(".", "_"+prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// 使用go build编译生成的包
+func goBuild(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	cmd := exec.Command("go", "build", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build %s: %v\n%s", dir, err, out)
+	}
+}
+
+// 使用go run运行生成的包, 返回输出
+func goRun(t *testing.T, dir string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run %s: %v\n%s", dir, err, out)
+	}
+	return string(out)
+}
+
+// 使用共享运行时的两个包中有同名的组件时, v-once的缓存不会冲突
+func TestVOncePerPackage(t *testing.T) {
+	dir := moduleTempDir(t, "once")
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b"} {
+		src := filepath.Join(dir, name+"src")
+		os.Mkdir(src, os.ModePerm)
+		ioutil.WriteFile(filepath.Join(src, "item.vue"), []byte(fmt.Sprintf(`<template><p v-once>%s</p></template>`, name)), 0666)
+		err := genPackage(Package{Src: src, To: filepath.Join(dir, name), Runtime: true}, &Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg := "github.com/zbysir/go-vue-ssr/pkg/vuessr/" + filepath.Base(dir)
+	os.Mkdir(filepath.Join(dir, "main"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "main", "main.go"), []byte(fmt.Sprintf(`package main
+
+import (
+	"fmt"
+	"%[1]s/a"
+	"%[1]s/b"
+)
+
+func main() {
+	ra := a.NewRenderCreator().NewRender()
+	wa := ra.NewWriter()
+	ra.Render("item", wa, &a.Options{})
+	rb := b.NewRenderCreator().NewRender()
+	wb := rb.NewWriter()
+	rb.Render("item", wb, &b.Options{})
+	fmt.Print(wa.Result() + wb.Result())
+}
+`, pkg)), 0666)
+	if out := goRun(t, filepath.Join(dir, "main")); out != "<p>a</p><p>b</p>" {
+		t.Fatal(out)
+	}
+}
+
+// v-once的缓存key只和节点在模板中的位置有关: 组件的多个实例共用第一次渲染的结果, v-once包裹的v-for整个只渲染一次
+func TestVOnceInstances(t *testing.T) {
+	dir := moduleTempDir(t, "instances")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	os.Mkdir(src, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "item.vue"), []byte(`<template><p v-once>{{title}}</p></template>`), 0666)
+	ioutil.WriteFile(filepath.Join(src, "page.vue"), []byte(`<template><div><item :title="'a'"></item><item :title="'b'"></item><i v-for="n in list" v-once>{{n}}</i></div></template>`), 0666)
+	desc := filepath.Join(dir, "out")
+	err := genPackage(Package{Src: src, To: desc, Pkg: "main"}, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(desc, "main.go"), []byte(`package main
+
+import "fmt"
+
+func main() {
+	for _, list := range [][]interface{}{{1, 2}, {3}} {
+		r := NewRenderCreator().NewRender()
+		w := r.NewWriter()
+		r.Render("page", w, &Options{Props: NewProps(map[string]interface{}{"list": list})})
+		fmt.Println(w.Result())
+	}
+}
+`), 0666)
+	want := "<div><p>a</p><p>a</p><i>1</i><i>2</i></div>\n<div><p>a</p><p>a</p><i>1</i><i>2</i></div>\n"
+	if out := goRun(t, desc); out != want {
+		t.Fatal(out)
+	}
+}
+
+// 复制运行时与使用共享运行时生成的包都可以编译
+func TestGenFeatures(t *testing.T) {
+	dir := moduleTempDir(t, "features")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	os.Mkdir(src, os.ModePerm)
+	for name, code := range featureFiles {
+		ioutil.WriteFile(filepath.Join(src, name), []byte(code), 0666)
+	}
+
+	config := &Config{
+		Directives: []string{"loading"},
+		Plugins:    []DirectivePlugin{{Name: "tooltip", Bind: "title", Class: []string{"has-tip"}}},
+	}
+	for _, runtime := range []bool{false, true} {
+		desc := filepath.Join(dir, fmt.Sprintf("out%v", runtime))
+		err := genPackage(Package{Src: src, To: desc, Runtime: runtime}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goBuild(t, desc)
+	}
+}
+
+// 模板中的错误作为带行号的Diagnostic报告, 而不是panic
+func TestTemplateErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		tpl  string
+		line int
+		msg  string
+	}{
+		{"<template>\n<div>\n<p :title='a +'>x</p>\n</div>\n</template>", 3, "invalid expression"},
+		{"<template>\n<div>\n<p>\n{{ a + }}</p>\n</div>\n</template>", 3, "invalid expression"},
+		{"<template>\n<ul>\n<li v-for='item in (a'>x</li>\n</ul>\n</template>", 3, "invalid expression"},
+		{"<template>\n<div>\n<p v-if='a(' >x</p>\n</div>\n</template>", 3, "invalid expression"},
+		{"<template>\n<div>\n\n<button @click='f(a +)'>x</button>\n</div>\n</template>", 4, "invalid expression"},
+		{"<template>\n<div v-let:x='{'>\n<p>x</p>\n</div>\n</template>", 2, "invalid expression"},
+		{"<template>\n<div>\n<p v-tip:[a+]='b'>x</p>\n</div>\n</template>", 3, "invalid expression"},
+		{"<template>\n<div>\n<p v-else>x</p>\n</div>\n</template>", 3, "v-else must below v-if"},
+		{"<template>\n<div>\n<card v-slot='{a'>x</card>\n</div>\n</template>", 3, "parse"},
+		{"<template>\n<ul>\n<li v-for='i in list'>\n<b v-once>x</b></li>\n</ul>\n</template>", 4, "v-once inside v-for"},
+		{"<template>\n<card>\n<template #item='{x}'>\n<b v-once>x</b></template>\n</card>\n</template>", 4, "v-once inside v-for or v-slot"},
+	}
+	for i, tc := range cases {
+		file := filepath.Join(dir, fmt.Sprintf("c%d.vue", i))
+		ioutil.WriteFile(file, []byte(tc.tpl), 0666)
+		c := NewCompiler()
+		c.AddComponent("card")
+		genComponentRenderFunc(c, "out", "c", file, "")
+		var d Diagnostic
+		for _, d = range c.Diagnostics {
+			if d.Level == DiagnosticError {
+				break
+			}
+		}
+		if d.Level != DiagnosticError || d.File != file || d.Line != tc.line || !strings.Contains(d.Message, tc.msg) {
+			t.Fatalf("case %d: %+v", i, d)
+		}
+	}
+
+	// 有错误的组件使编译失败
+	src := filepath.Join(dir, "src")
+	os.Mkdir(src, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "page.vue"), []byte(cases[0].tpl), 0666)
+	err = genPackage(Package{Src: src, To: filepath.Join(dir, "out")}, &Config{})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
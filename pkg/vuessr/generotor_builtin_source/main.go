@@ -3,13 +3,25 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 )
 
+// 生成:
+//   - generator_builtin_gen.go: 复制到生成的包中的运行时源码(builtinCode), 与使用共享运行时时的别名(runtimeAliasCode)
+//   - runtime/runtime_gen.go: 共享的运行时包
+//   - runtime/export_gen.go: 导出运行时中未导出的类型与方法, 生成的代码可以使用运行时中的任何类型与方法
 func main() {
 	sourceFiles := []string{"./generotor_builtin_source/source.go"}
 	target := "./generator_builtin_gen.go"
+	runtimeTarget := "./runtime/runtime_gen.go"
+	exportTarget := "./runtime/export_gen.go"
 	pkg := "vuessr"
 	beginTag := []byte("// begin")
 
@@ -32,13 +44,161 @@ func main() {
 		source += fmt.Sprintf("\n\n// src: %s\n%s", sourceFile, code)
 	}
 
+	ids, err := runtimeIdents(sourceFiles)
+	if err != nil {
+		panic(err)
+	}
+
 	to := fmt.Sprintf(`// generate by ./generotor_builtin_source/main.go
 package %s
 
-const builtinCode = `+"`%s`", pkg, source)
+const builtinCode = `+"`%s`"+`
+
+const runtimeAliasCode = `+"`%s`", pkg, source, ids.alias())
+
+	err = ioutil.WriteFile(target, []byte(to), os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+
+	runtime := fmt.Sprintf("// Code generated by ./generotor_builtin_source/main.go. DO NOT EDIT.\n\npackage runtime%s\n", source)
+	err = ioutil.WriteFile(runtimeTarget, []byte(runtime), os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(exportTarget, []byte(ids.export()), os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// 运行时中的顶层标识符
+type idents struct {
+	// 名字 => 导出的名字, 已经导出的名字不变
+	types  map[string]string
+	funcs  map[string]string
+	consts map[string]string
+}
+
+// 收集运行时中所有的类型, 方法与常量. 变量是运行时的状态(如v-once的缓存), 生成的代码不会使用, 不导出.
+func runtimeIdents(files []string) (*idents, error) {
+	ids := &idents{types: map[string]string{}, funcs: map[string]string{}, consts: map[string]string{}}
+	exported := map[string]bool{}
+	add := func(m map[string]string, n *ast.Ident) {
+		if n.IsExported() {
+			exported[n.Name] = true
+		}
+		m[n.Name] = exportedName(n.Name)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					add(ids.funcs, d.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						add(ids.types, s.Name)
+					case *ast.ValueSpec:
+						for _, n := range s.Names {
+							if d.Tok == token.CONST {
+								add(ids.consts, n)
+							} else if n.IsExported() {
+								exported[n.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// 导出的名字不能和已经导出的标识符重复
+	for _, m := range []map[string]string{ids.types, ids.funcs, ids.consts} {
+		for name, e := range m {
+			if name != e && exported[e] {
+				return nil, fmt.Errorf("can't export %s as %s, it's already declared in runtime", name, e)
+			}
+		}
+	}
+	return ids, nil
+}
 
-	err := ioutil.WriteFile(target, []byte(to), os.ModePerm)
+// 导出的名字: escape => Escape, _slot => BuiltinSlot
+func exportedName(name string) string {
+	if ast.IsExported(name) {
+		return name
+	}
+	if strings.HasPrefix(name, "_") {
+		name = strings.TrimPrefix(name, "_")
+		return "Builtin" + strings.ToUpper(name[:1]) + name[1:]
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// 按照名字排序, 输出稳定
+func sortedSpecs(m map[string]string, f func(name, exported string) string, unexportedOnly bool) string {
+	var names []string
+	for name := range m {
+		if unexportedOnly && ast.IsExported(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var specs []string
+	for _, name := range names {
+		specs = append(specs, f(name, m[name]))
+	}
+	return strings.Join(specs, "\n")
+}
+
+// 声明块, 没有声明时为空
+func declBlock(tok string, specs string) string {
+	if specs == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (\n%s\n)\n\n", tok, specs)
+}
+
+// runtime/export_gen.go
+func (ids *idents) export() string {
+	spec := func(name, exported string) string {
+		return fmt.Sprintf("%s = %s", exported, name)
+	}
+	code := fmt.Sprintf("// Code generated by ./generotor_builtin_source/main.go. DO NOT EDIT.\n\n"+
+		"package runtime\n\n"+
+		"// 生成的代码中使用的未导出的类型与方法.\n"+
+		"// 使用共享运行时的包中, builtin.go会声明它们的别名(如propsScope = runtime.PropsScope), 生成的组件代码和复制运行时的包一样.\n\n"+
+		"%s%s%s",
+		declBlock("type", sortedSpecs(ids.types, spec, true)), declBlock("const", sortedSpecs(ids.consts, spec, true)), declBlock("var", sortedSpecs(ids.funcs, spec, true)))
+	bs, err := format.Source([]byte(code))
+	if err != nil {
+		panic(err)
+	}
+	return string(bs)
+}
+
+// 生成的包引用共享运行时的别名, 包括运行时中所有的类型, 方法与常量
+func (ids *idents) alias() string {
+	spec := func(name, exported string) string {
+		return fmt.Sprintf("%s = runtime.%s", name, exported)
+	}
+	code := fmt.Sprintf("\nimport \"github.com/zbysir/go-vue-ssr/pkg/vuessr/runtime\"\n\n"+
+		"%s%s%s",
+		declBlock("type", sortedSpecs(ids.types, spec, false)), declBlock("const", sortedSpecs(ids.consts, spec, false)), declBlock("var", sortedSpecs(ids.funcs, spec, false)))
+	bs, err := format.Source([]byte("package xxx\n" + code))
 	if err != nil {
 		panic(err)
 	}
+	return strings.TrimPrefix(string(bs), "package xxx\n")
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -122,6 +124,111 @@ func TestBufferSpans(t *testing.T) {
 
 }
 
+func TestTeleport(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+
+	// target在teleport之前
+	_teleportTarget(r, w, &Options{Attrs: Attributes{{Key: "name", Val: "body-end"}}})
+	w.WriteString("<main>")
+	_teleport(r, w, &Options{
+		Attrs: Attributes{{Key: "to", Val: "body-end"}},
+		Slots: Slots{"default": func(w Writer, slotProps Props) {
+			w.WriteString("<div>modal</div>")
+		}},
+	})
+	_teleport(r, w, &Options{
+		Props: NewProps(map[string]interface{}{"to": "body-end", "disabled": true}),
+		Slots: Slots{"default": func(w Writer, slotProps Props) {
+			w.WriteString("<p>inline</p>")
+		}},
+	})
+	w.WriteString("</main>")
+
+	want := "<div>modal</div><main><p>inline</p></main>"
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+func TestVonManifest(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+
+	_vonOutlet(r, w, &Options{})
+	_tag(r, w, "button", false, &Options{
+		VonDirectives: []vonDirective{{Event: "click", Func: "buy", Args: []interface{}{1, "x"}}},
+	})
+	w.WriteString("<a" + vonAttr(r, []vonDirective{{Event: "mouseover", Func: "hover"}}) + "></a>")
+
+	want := `<script type="application/json" id="von-manifest">` +
+		`[{"args":[1,"x"],"event":"click","func":"buy","id":"von-1"},{"args":[],"event":"mouseover","func":"hover","id":"von-2"}]` +
+		`</script><button data-von-id="von-1"></button><a data-von-id="von-2"></a>`
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+func TestStyleOutlet(t *testing.T) {
+	card := &block{ID: "card", Code: ".card{}"}
+	alert := &block{ID: "alert", Code: ".alert{}"}
+
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+	_styleOutlet(r, w, &Options{})
+	useStyle(r, card)
+	useStyle(r, alert)
+	useStyle(r, card)
+
+	want := `<style data-style-id="alert">.alert{}</style><style data-style-id="card">.card{}</style>`
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+	if css := r.Css(); css != ".alert{}.card{}" {
+		t.Fatal(css)
+	}
+}
+
+func TestScriptOutlet(t *testing.T) {
+	swiper := &block{ID: "swiper", Code: "init(data)"}
+
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+	_scriptOutlet(r, w, &Options{})
+	for _, id := range []int{1, 2} {
+		useScript(r, swiper)
+		directives{{Name: "v-client-data", Arg: "swiper", Value: map[string]interface{}{"id": id}}}.Exec(r, w, &Options{})
+	}
+	// 没有<script client>的组件的数据不会输出
+	directives{{Name: "v-client-data", Arg: "card", Value: 1}}.Exec(r, w, &Options{})
+
+	want := "<script data-script-id=\"swiper\">(function(data){\ninit(data)\n})([{\"id\":1},{\"id\":2}]);</script>"
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+func TestInject(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	// 组件上的provide
+	parent := &Options{Provide: map[string]interface{}{"theme": "dark", "locale": "zh"}}
+	component := &Options{P: parent}
+	// 元素上的provide会覆盖上层
+	el := provideOptions(component, map[string]interface{}{"theme": "light"})
+	child := &Options{P: el}
+
+	f := interfaceToFunc(r.Global.Get("inject"))
+	if v := f(r, child, "theme"); v != "light" {
+		t.Fatal(v)
+	}
+	if v := f(r, child, "locale"); v != "zh" {
+		t.Fatal(v)
+	}
+	if v := f(r, component, "theme"); v != "dark" {
+		t.Fatal(v)
+	}
+}
+
 func Test_getAttrFromProps(t *testing.T) {
 	as := getAttrFromProps(NewProps(map[string]interface{}{
 		"autoplay":  false,
@@ -130,3 +237,250 @@ func Test_getAttrFromProps(t *testing.T) {
 	}))
 	t.Logf("%+v", as)
 }
+
+func TestSpreadAttrs(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+
+	// 父组件传递: <card title="hi" id="c" :size="1" v-bind="{'aria-x': 'x', class: 'b'}">
+	p := Props{}
+	p.Set("size", 1)
+	p.Spread(map[string]interface{}{"aria-x": "x", "class": "b"})
+	parent := &Options{
+		Props: p,
+		Attrs: Attributes{{Key: "title", Val: "hi"}, {Key: "id", Val: "c"}},
+	}
+	scope := componentScope(r, parent, &componentMeta{Props: map[string]bool{"title": true, "size": true}, InheritAttrs: true, Attrs: true})
+	if scope.Get("title") != "hi" || scope.Get("size") != 1 {
+		t.Fatal(scope.Get("title"), scope.Get("size"))
+	}
+	if attrs := scope.Get("$attrs").(map[string]interface{}); len(attrs) != 2 || attrs["id"] != "c" || attrs["aria-x"] != "x" {
+		t.Fatal(attrs)
+	}
+
+	_tag(r, w, "div", true, &Options{P: parent, Class: []string{"a"}})
+	parent.meta.InheritAttrs = false
+	_tag(r, w, "div", true, &Options{P: parent})
+
+	want := `<div class="a b" id="c" aria-x="x"></div><div class="b"></div>`
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+// <component :is="'card'" title="hi">, is不会传递给组件
+func TestComponentIs(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	r.components = map[string]ComponentFunc{"card": func(r *Render, w Writer, options *Options) {
+		scope := componentScope(r, options, &componentMeta{Props: map[string]bool{"size": true}, InheritAttrs: true, Attrs: true})
+		if _, ok := scope.Get("$attrs").(map[string]interface{})["is"]; ok {
+			t.Fatal(scope.Get("$attrs"))
+		}
+		_tag(r, w, "div", true, &Options{P: options})
+	}}
+	w := r.NewWriter()
+	p := Props{}
+	p.Set("is", "card")
+	p.Set("title", "hi")
+	_component(r, w, &Options{Props: p})
+
+	want := `<div title="hi"></div>`
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+// 没有声明props的组件只渲染id/src/data-*, 使用了inheritAllAttrs配置时渲染所有props
+func TestAllAttrs(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+	p := Props{}
+	p.Set("id", "c")
+	p.Set("title", "hi")
+
+	legacy := &Options{Props: p}
+	propsScope(r, "card", legacy)
+	_tag(r, w, "div", true, &Options{P: legacy})
+
+	all := &Options{Props: p}
+	scope := componentScope(r, all, &componentMeta{InheritAttrs: true, AllAttrs: true})
+	// 模板中没有读取$attrs
+	if scope.Get("$attrs") != nil {
+		t.Fatal(scope.Get("$attrs"))
+	}
+	_tag(r, w, "div", true, &Options{P: all})
+
+	want := `<div id="c"></div><div id="c" title="hi"></div>`
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+func TestPropsDefault(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	meta := &componentMeta{Props: map[string]bool{"title": true, "size": true}, InheritAttrs: true, Defaults: map[string]interface{}{"title": "t", "size": 1}}
+
+	// <card title="hi">
+	scope := componentScope(r, &Options{Attrs: Attributes{{Key: "title", Val: "hi"}}}, meta)
+	if scope.Get("title") != "hi" || scope.Get("size") != 1 {
+		t.Fatal(scope.Get("title"), scope.Get("size"))
+	}
+}
+
+func TestStrict(t *testing.T) {
+	c := newRenderCreator()
+	c.Strict = true
+	r := c.NewRender()
+	meta := &componentMeta{
+		Name:     "card",
+		Props:    map[string]bool{"title": true, "size": true, "optional": true},
+		Types:    map[string][]string{"title": {"String"}, "size": {"Number"}},
+		Required: map[string]bool{"title": true},
+	}
+
+	// <card :size="'big'">
+	scope := componentScope(r, &Options{Props: NewProps(map[string]interface{}{"size": "big"})}, meta)
+	scope.Get("optional")
+	scope.Get("tittle")
+	extendScope(scope, map[string]interface{}{"item": 1}).Get("tittle", "length")
+	for i := 0; i < 2; i++ {
+		propsScope(r, "plain", &Options{}).Get("x")
+	}
+
+	want := []Warning{
+		{Component: "card", Message: "invalid prop 'size': expected Number, got string"},
+		{Component: "card", Message: "missing required prop 'title'"},
+		{Component: "card", Message: "undefined variable 'tittle': tittle"},
+		{Component: "card", Message: "undefined variable 'tittle': tittle.length"},
+		{Component: "plain", Message: "undefined variable 'x': x"},
+	}
+	if ws := r.Warnings(); !reflect.DeepEqual(ws, want) {
+		t.Fatal(ws)
+	}
+
+	// 非strict模式不检查
+	r = newRenderCreator().NewRender()
+	componentScope(r, &Options{}, meta).Get("tittle")
+	if ws := r.Warnings(); len(ws) != 0 {
+		t.Fatal(ws)
+	}
+}
+
+func TestVModel(t *testing.T) {
+	if v := vModelValue("  18 ", true, true); v != float64(18) {
+		t.Fatal(v)
+	}
+	if v := vModelValue("18a", false, true); v != "18a" {
+		t.Fatal(v)
+	}
+	if !vModelChecked([]interface{}{"go", 1}, "1") || vModelChecked([]string{"go"}, "js") {
+		t.Fatal("checkbox array")
+	}
+	if !vModelChecked(true, "on") || vModelChecked(nil, "on") {
+		t.Fatal("checkbox bool")
+	}
+	if !vModelEqual("f", "f") || vModelEqual("f", "m") || !vModelEqual([]string{"a", "b"}, "b") {
+		t.Fatal("radio/option")
+	}
+}
+
+func TestOnce(t *testing.T) {
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+
+	n := 0
+	f := func(w Writer) {
+		n++
+		w.WriteString("<p>" + strconv.Itoa(n) + "</p>")
+	}
+	_once(r, w, "test:1", f)
+	_once(r, w, "test:1", f)
+	_once(r, w, "test:2", f)
+
+	want := "<p>1</p><p>1</p><p>2</p>"
+	if r := w.Result(); r != want {
+		t.Fatalf("want:%s but:%s", want, r)
+	}
+}
+
+// v-once缓存之后, 之后的渲染也需要注册缓存中组件的css
+func TestOnceStyle(t *testing.T) {
+	card := &block{ID: "card", Code: ".card{}"}
+	r := newRenderCreator().NewRender()
+	_once(r, r.NewWriter(), "test:style", func(w Writer) {
+		useStyle(r, card)
+	})
+
+	r = newRenderCreator().NewRender()
+	_once(r, r.NewWriter(), "test:style", func(w Writer) {})
+	if css := r.Css(); css != ".card{}" {
+		t.Fatal(css)
+	}
+}
+
+// v-once中的v-on事件在之后的渲染中使用新的id重新注册
+func TestOnceVOn(t *testing.T) {
+	f := func(r *Render) func(w Writer) {
+		return func(w Writer) {
+			w.WriteString("<button" + vonAttr(r, []vonDirective{{Event: "click", Func: "buy"}}) + "></button>")
+		}
+	}
+
+	r := newRenderCreator().NewRender()
+	w := r.NewWriter()
+	_once(r, w, "test:von", f(r))
+	if r := w.Result(); r != `<button data-von-id="von-1"></button>` {
+		t.Fatal(r)
+	}
+
+	// 新的渲染中已经有了von-1, 缓存中的事件不会和它冲突
+	r = newRenderCreator().NewRender()
+	w = r.NewWriter()
+	w.WriteString("<a" + vonAttr(r, []vonDirective{{Event: "click", Func: "open"}}) + "></a>")
+	_once(r, w, "test:von", f(r))
+	if r := w.Result(); r != `<a data-von-id="von-1"></a><button data-von-id="von-2"></button>` {
+		t.Fatal(r)
+	}
+	events := r.von.get()
+	if len(events) != 2 || events[1].Id != "von-2" || events[1].Func != "buy" {
+		t.Fatalf("%+v", events)
+	}
+}
+
+func TestUse(t *testing.T) {
+	lib := newRenderCreator()
+	lib.Components = map[string]ComponentFunc{
+		"card": func(r *Render, w Writer, options *Options) {
+			w.WriteString("<div>card</div>")
+		},
+	}
+	lib.Directive("v-loading", func(r *Render, w Writer, b DirectivesBinding, options *Options) {})
+
+	c := newRenderCreator()
+	c.Components = map[string]ComponentFunc{
+		"page": func(r *Render, w Writer, options *Options) {
+			r.Render("card", w, options)
+		},
+	}
+	err := c.Use(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Directives["v-loading"]; !ok {
+		t.Fatal("directive should be merged")
+	}
+
+	r := c.NewRender()
+	w := r.NewWriter()
+	r.Render("page", w, &Options{})
+	if w.Result() != "<div>card</div>" {
+		t.Fatal(w.Result())
+	}
+
+	// 重名的组件与指令返回错误, 内置指令不算重名
+	err = c.Use(lib)
+	want := "conflict with registered: component card, directive v-loading"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want:%s but:%v", want, err)
+	}
+}
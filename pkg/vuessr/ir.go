@@ -0,0 +1,128 @@
+package vuessr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 组件代码的中间表示.
+// 输出字符串的语句(w.WriteString)记录为strExpr, 其他语句(如if/for/调用组件)是go代码.
+// 相邻的输出语句与静态文本在这里合并, 静态文本在生成代码时才使用strconv.Quote, 所以模板中的任何文本都不会破坏生成的代码.
+
+// 字符串表达式, 由静态文本与值为string的go表达式拼接而成
+type strExpr []strPart
+
+type strPart struct {
+	// 静态文本
+	text string
+	// 值为string的go表达式, 不为空时忽略text
+	code string
+}
+
+// 静态文本
+func textStr(text string) strExpr {
+	if text == "" {
+		return nil
+	}
+	return strExpr{{text: text}}
+}
+
+// go表达式, 如interfaceToStr(scope.Get("title"), true)
+func codeStr(code string) strExpr {
+	return strExpr{{code: code}}
+}
+
+// 拼接字符串, 相邻的静态文本会合并为一个
+func (s strExpr) concat(others ...strExpr) strExpr {
+	r := append(strExpr{}, s...)
+	for _, o := range others {
+		for _, p := range o {
+			if p.code == "" {
+				if p.text == "" {
+					continue
+				}
+				if n := len(r); n != 0 && r[n-1].code == "" {
+					r[n-1].text += p.text
+					continue
+				}
+			}
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// 生成go代码, e.g. "<p>"+interfaceToStr(scope.Get("title"), true)+"</p>"
+func (s strExpr) Code() string {
+	if len(s) == 0 {
+		return `""`
+	}
+	codes := make([]string, len(s))
+	for i, p := range s {
+		if p.code != "" {
+			codes[i] = p.code
+		} else {
+			codes[i] = strconv.Quote(p.text)
+		}
+	}
+	return strings.Join(codes, "+")
+}
+
+// 一段代码, 由多个语句组成
+type codeBlock []codeStmt
+
+type codeStmt struct {
+	// 输出的字符串, code为空时是w.WriteString语句
+	write strExpr
+	// 其他go代码
+	code string
+}
+
+// 输出字符串的语句
+func writeBlock(s strExpr) codeBlock {
+	if len(s) == 0 {
+		return nil
+	}
+	return codeBlock{{write: s}}
+}
+
+// 其他go代码
+func rawBlock(code string) codeBlock {
+	if code == "" {
+		return nil
+	}
+	return codeBlock{{code: code}}
+}
+
+// 拼接代码, 相邻的输出语句会合并为一个:
+//   w.WriteString("<p>")
+//   w.WriteString(interfaceToStr(scope.Get("title"), true))
+// 合并为
+//   w.WriteString("<p>"+interfaceToStr(scope.Get("title"), true))
+func (b codeBlock) append(others ...codeBlock) codeBlock {
+	r := append(codeBlock{}, b...)
+	for _, o := range others {
+		for _, st := range o {
+			if n := len(r); st.code == "" && n != 0 && r[n-1].code == "" {
+				r[n-1].write = r[n-1].write.concat(st.write)
+				continue
+			}
+			r = append(r, st)
+		}
+	}
+	return r
+}
+
+// 生成go代码
+func (b codeBlock) Code() string {
+	lines := make([]string, len(b))
+	for i, st := range b {
+		if st.code != "" {
+			lines[i] = st.code
+		} else {
+			lines[i] = fmt.Sprintf("w.WriteString(%s)", st.write.Code())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,244 @@
+package vuessr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/pkg/errors"
+	"github.com/zbysir/go-vue-ssr/internal/version"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 增量编译的记录, 存放在生成目录下
+const manifestFile = ".go-vue-ssr-manifest.json"
+
+// 记录每个组件编译时的依赖, 只有依赖改变了的组件才需要重新编译:
+//   - 源文件
+//   - 编译器版本与项目配置
+//   - 模板中使用的tag对应的组件与组件的props声明, 如添加了card.vue后, 使用了<card>的组件需要重新编译
+// 被其他包导入时, 也用于读取包中的组件与组件的选项.
+type manifest struct {
+	Version    string                        `json:"version"`
+	Config     string                        `json:"config"`
+	Runtime    bool                          `json:"runtime"`
+	Components map[string]*manifestComponent `json:"components"`
+}
+
+type manifestComponent struct {
+	SrcHash string `json:"src_hash"`
+	// 模板中使用的tag => 编译时tag对应的组件的hash, 不是组件时为空
+	Deps map[string]string `json:"deps"`
+	// 组件在<script>中声明的选项
+	Options *ComponentOptions `json:"options,omitempty"`
+}
+
+func newManifest(config *Config) *manifest {
+	return &manifest{
+		Version:    version.Version,
+		Config:     config.hash(),
+		Components: map[string]*manifestComponent{},
+	}
+}
+
+// 读取上一次编译的记录, 不存在或者版本与配置改变时返回空记录(全部重新编译)
+func loadManifest(desc string, config *Config) *manifest {
+	m := newManifest(config)
+	bs, err := ioutil.ReadFile(filepath.Join(desc, manifestFile))
+	if err != nil {
+		return m
+	}
+	old := &manifest{}
+	if json.Unmarshal(bs, old) != nil || old.Version != m.Version || old.Config != m.Config || old.Components == nil {
+		return m
+	}
+	return old
+}
+
+// 读取导入的包中的组件, 包需要使用共享运行时
+func loadImport(dir string) (*manifest, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("imported package %s is not compiled: %v", dir, err)
+	}
+	m := &manifest{}
+	err = json.Unmarshal(bs, m)
+	if err != nil {
+		return nil, fmt.Errorf("bad manifest of imported package %s: %v", dir, err)
+	}
+	if !m.Runtime {
+		return nil, fmt.Errorf("imported package %s doesn't use the shared runtime", dir)
+	}
+	// 不同版本生成的代码使用的运行时不同
+	if m.Version != version.Version {
+		return nil, fmt.Errorf("imported package %s is compiled by go-vue-ssr %s, but current is %s, recompile it", dir, m.Version, version.Version)
+	}
+	return m, nil
+}
+
+// 组件在上一次编译之后依赖是否没有改变
+func (m *manifest) fresh(c *Compiler, name string, srcHash string) bool {
+	mc, ok := m.Components[name]
+	if !ok || mc.SrcHash != srcHash {
+		return false
+	}
+	for tag, h := range mc.Deps {
+		if c.depHash(tag) != h {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *manifest) encode() []byte {
+	bs, _ := json.MarshalIndent(m, "", "  ")
+	return bs
+}
+
+// tag对应的组件的hash, 包含组件名与props声明(会影响上层组件的props检查)
+func (c *Compiler) depHash(tag string) string {
+	name, ok := c.Components[tag]
+	if !ok {
+		return ""
+	}
+	var props []PropDecl
+	if o := c.Options[name]; o != nil {
+		props = o.Props
+	}
+	// 导入的组件与本包的组件生成的调用代码不同
+	return Md5String(fmt.Sprintf("%s:%v:%+v", name, c.external[name], props))
+}
+
+// 组件模板中使用的所有tag
+func usedTags(e *VueElement) (tags []string) {
+	m := map[string]bool{}
+	var walk func(e *VueElement)
+	walk = func(e *VueElement) {
+		if e == nil {
+			return
+		}
+		if e.TagName != "" {
+			m[e.TagName] = true
+		}
+		for _, child := range e.Children {
+			walk(child)
+		}
+	}
+	walk(e)
+
+	for tag := range m {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return
+}
+
+// 生成的文件先写入生成目录下的临时目录, 全部生成后再逐个rename到生成目录中,
+// 避免go build读取到写了一半的文件. 临时目录以.开头, 会被go忽略.
+type staging struct {
+	dir  string
+	desc string
+	// 需要移动到生成目录的文件名, 按照写入的顺序
+	files []string
+	// 需要删除的文件
+	removes []string
+}
+
+const stagingPrefix = ".go-vue-ssr-staging"
+
+func newStaging(desc string) (s *staging, err error) {
+	// 清理上一次中断的编译留下的临时目录
+	old, _ := filepath.Glob(filepath.Join(desc, stagingPrefix+"*"))
+	for _, o := range old {
+		os.RemoveAll(o)
+	}
+
+	dir, err := ioutil.TempDir(desc, stagingPrefix)
+	if err != nil {
+		return nil, errors.NewCoder(err, "create staging dir")
+	}
+	return &staging{dir: dir, desc: desc}, nil
+}
+
+// 写入文件, 与生成目录中的文件内容相同时不写入
+func (s *staging) write(name string, data []byte) (err error) {
+	old, err := ioutil.ReadFile(filepath.Join(s.desc, name))
+	if err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	err = ioutil.WriteFile(filepath.Join(s.dir, name), data, 0666)
+	if err != nil {
+		return errors.NewCoder(err, "write "+name)
+	}
+	s.files = append(s.files, name)
+	return
+}
+
+// 是否有需要写入或者删除的文件
+func (s *staging) changed() bool {
+	return len(s.files) != 0 || len(s.removes) != 0
+}
+
+func (s *staging) remove(path string) {
+	s.removes = append(s.removes, path)
+}
+
+// 文件移动到生成目录的顺序: 组件和样式文件, builtin.go, creator.go.
+// creator.go引用了所有组件, 放在组件之后, 同时运行的go build不会看到引用了不存在的组件的creator.go.
+func commitRank(name string) int {
+	switch name {
+	case "builtin.go":
+		return 1
+	case "creator.go":
+		return 2
+	}
+	return 0
+}
+
+// 将文件按commitRank的顺序移动到生成目录, 再删除需要删除的文件, 最后写入manifest.
+// 提交中断时manifest还是旧的, 下一次编译会重新生成所有改变了的组件.
+func (s *staging) commit() (err error) {
+	files := make([]string, 0, len(s.files))
+	manifest := false
+	for _, name := range s.files {
+		if name == manifestFile {
+			manifest = true
+		} else {
+			files = append(files, name)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return commitRank(files[i]) < commitRank(files[j])
+	})
+
+	for _, name := range files {
+		err = s.rename(name)
+		if err != nil {
+			return
+		}
+	}
+	for _, path := range s.removes {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.NewCoder(err, fmt.Sprintf("del oldCode file :%s", path))
+		}
+	}
+	if manifest {
+		return s.rename(manifestFile)
+	}
+	return nil
+}
+
+func (s *staging) rename(name string) (err error) {
+	err = os.Rename(filepath.Join(s.dir, name), filepath.Join(s.desc, name))
+	if err != nil {
+		return errors.NewCoder(err, "rename "+name)
+	}
+	return nil
+}
+
+func (s *staging) clean() {
+	os.RemoveAll(s.dir)
+}
@@ -1,10 +1,14 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/zbysir/go-vue-ssr/internal/pkg/html"
 	"github.com/zbysir/go-vue-ssr/internal/pkg/html/atom"
-	"os"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -13,32 +17,48 @@ import (
 // - 不支持不规则的html, 已知的有<select>里嵌套<slot>, 在<head>里嵌套<div>, 其实还有很多未知的问题, 为了避免引起未知bug, vue模板不需要做html的规则检查.
 // 还在寻求另一个解决方案.
 type GoHtml struct {
+	// 空白文本的处理方式, 见WhitespaceTrim/WhitespaceCondense/WhitespacePreserve
+	Whitespace string
+	// 是否保留注释, 默认会忽略
+	Comments bool
 }
 
+// 空白文本的处理方式, <pre>/<textarea>/<script>/<style>中的文本总是原样保留(WhitespaceTrim除外)
+const (
+	// 忽略只有空格与换行的文本, 其他文本原样保留, 默认
+	WhitespaceTrim = "trim"
+	// 忽略包含换行的空白文本, 其他文本中连续的空白替换为一个空格, 同vue的whitespace: 'condense'
+	WhitespaceCondense = "condense"
+	// 原样保留所有文本
+	WhitespacePreserve = "preserve"
+)
+
 func (g GoHtml) Parse(html string) (es []*Element, err error) {
-	return parseHtml(html)
+	return g.parseHtml(html)
 }
 
 // parse HTML
-func parseHtml(filename string) (es []*Element, err error) {
-	file, err := os.Open(filename)
+func (g GoHtml) parseHtml(filename string) (es []*Element, err error) {
+	src, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return
 	}
-	defer file.Close()
+	file := bytes.NewReader(src)
 
 	var nodes []*html.Node
 
 	// 两个情况: 一种是<template>开头的 则是标准的vue组件, 一种vue组件如html页面. 但为了简化流程, html页面也可以被当为vue组件来渲染.
-	peekWant := "<template"
-	peek := make([]byte, len(peekWant))
-	_, err = file.Read(peek)
-	if err != nil {
+	// 标准的vue组件也可以由<script>或<style>块开头
+	if len(src) == 0 {
+		err = io.EOF
 		return
 	}
-	_, _ = file.Seek(0, 0)
+	peek := src
+	if len(peek) > len("<template") {
+		peek = peek[:len("<template")]
+	}
 
-	if string(peek) == peekWant {
+	if isComponentStart(string(peek)) {
 		root := &html.Node{
 			Type:     html.ElementNode,
 			DataAtom: atom.Div,
@@ -66,11 +86,70 @@ func parseHtml(filename string) (es []*Element, err error) {
 		}
 	}
 
-	es = hNodeToElement(nodes)
+	es = g.hNodeToElement(nodes, false, newLineIndex(src))
 	return
 }
 
-func hNodeToElement(nodes []*html.Node) []*Element {
+// 每一行的开始偏移, 用于将节点的偏移转换为行号
+type lineIndex []int
+
+func newLineIndex(src []byte) lineIndex {
+	l := lineIndex{0}
+	for i, b := range src {
+		if b == '\n' {
+			l = append(l, i+1)
+		}
+	}
+	return l
+}
+
+// 偏移所在的行, 从1开始
+func (l lineIndex) line(offset int) int {
+	return sort.Search(len(l), func(i int) bool { return l[i] > offset })
+}
+
+func isComponentStart(peek string) bool {
+	for _, tag := range []string{"<template", "<script", "<style"} {
+		if strings.HasPrefix(peek, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// 其中的文本不处理空白
+var rawTextTags = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+var spaceReg = regexp.MustCompile(`\s+`)
+
+// 处理空白文本, 返回false表示忽略这个节点
+func (g GoHtml) whitespace(text string, raw bool) (string, bool) {
+	switch g.Whitespace {
+	case WhitespacePreserve:
+		return text, true
+	case WhitespaceCondense:
+		if raw {
+			return text, true
+		}
+		if strings.TrimSpace(text) == "" {
+			if strings.Contains(text, "\n") {
+				return "", false
+			}
+			return " ", true
+		}
+		return spaceReg.ReplaceAllString(text, " "), true
+	default:
+		return text, strings.Trim(text, "\n ") != ""
+	}
+}
+
+// raw: 是否在<pre>等保留空白的节点中
+func (g GoHtml) hNodeToElement(nodes []*html.Node, raw bool, lines lineIndex) []*Element {
 	var es []*Element
 	for _, node := range nodes {
 		var e Element
@@ -84,14 +163,15 @@ func hNodeToElement(nodes []*html.Node) []*Element {
 			//reg := regexp.MustCompile(`\s+`)
 			//text = reg.ReplaceAllString(text, " ")
 
-			// 忽略空节点
-			if strings.Trim(node.Data, "\n ") == "" {
+			text, ok := g.whitespace(node.Data, raw)
+			if !ok {
 				omitNode = true
 				break
 			}
 			e = Element{
 				NodeType: TextNode,
-				Text:     node.Data,
+				Text:     text,
+				Line:     lines.line(node.Offset),
 			}
 		case html.DocumentNode:
 			e = Element{
@@ -102,9 +182,17 @@ func hNodeToElement(nodes []*html.Node) []*Element {
 			e = Element{
 				NodeType: ElementNode,
 				TagName:  node.Data,
+				Line:     lines.line(node.Offset),
 			}
 		case html.CommentNode:
-			omitNode = true
+			if !g.Comments {
+				omitNode = true
+				break
+			}
+			e = Element{
+				NodeType: CommentNode,
+				Text:     node.Data,
+			}
 		case html.DoctypeNode:
 			e = Element{
 				NodeType: DoctypeNode,
@@ -127,7 +215,7 @@ func hNodeToElement(nodes []*html.Node) []*Element {
 				c = c.NextSibling
 			}
 
-			children = hNodeToElement(allC)
+			children = g.hNodeToElement(allC, raw || node.Type == html.ElementNode && rawTextTags[node.Data], lines)
 		}
 
 		e.Children = children
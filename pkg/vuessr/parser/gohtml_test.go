@@ -2,6 +2,8 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -16,3 +18,64 @@ func TestGoHtmlParse(t *testing.T) {
 	bs, _ := json.MarshalIndent(x, " ", " ")
 	t.Logf("%s", bs)
 }
+
+func TestGoHtmlWhitespace(t *testing.T) {
+	texts := func(p GoHtml) (ts []string) {
+		es, err := p.Parse(`./test_src/whitespace.vue`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var walk func(es []*Element)
+		walk = func(es []*Element) {
+			for _, e := range es {
+				if e.NodeType == TextNode || e.NodeType == CommentNode {
+					ts = append(ts, e.Text)
+				}
+				walk(e.Children)
+			}
+		}
+		walk(es)
+		return
+	}
+
+	cases := []struct {
+		p    GoHtml
+		want []string
+	}{
+		{GoHtml{}, []string{"  a   b  ", "x", "y", "  keep\n  this  "}},
+		{GoHtml{Whitespace: WhitespaceCondense, Comments: true}, []string{" note ", " a b ", "x", " ", "y", "  keep\n  this  "}},
+	}
+	for i, c := range cases {
+		if ts := texts(c.p); strings.Join(ts, "|") != strings.Join(c.want, "|") {
+			t.Fatalf("case %d: %q", i, ts)
+		}
+	}
+
+	// preserve保留所有空白
+	if ts := texts(GoHtml{Whitespace: WhitespacePreserve}); len(ts) != 13 {
+		t.Fatalf("%q", ts)
+	}
+}
+
+func TestGoHtmlLine(t *testing.T) {
+	es, err := GoHtml{}.Parse(`./test_src/whitespace.vue`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	var walk func(es []*Element)
+	walk = func(es []*Element) {
+		for _, e := range es {
+			if e.NodeType == ElementNode {
+				lines = append(lines, fmt.Sprintf("%s:%d", e.TagName, e.Line))
+			}
+			walk(e.Children)
+		}
+	}
+	walk(es)
+
+	want := "template:1 div:2 p:4 span:5 span:5 pre:6"
+	if s := strings.Join(lines, " "); s != want {
+		t.Fatal(s)
+	}
+}
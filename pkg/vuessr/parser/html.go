@@ -15,6 +15,7 @@ type Element struct {
 	DocType  string // 特殊的docType值
 	Attrs    []html.Attribute
 	Children []*Element
+	Line     int // 元素或文本在文件中的行号
 }
 
 type NodeType int
@@ -0,0 +1,71 @@
+package vuessr
+
+import (
+	"sort"
+)
+
+// 编译时处理的指令, 在生成代码时修改节点, 不会在运行时调用. 如配置:
+//   plugins:
+//     - name: tooltip
+//       bind: title
+//       class: [has-tooltip]
+// 会将<span v-tooltip="text">编译为<span class="has-tooltip" :title="text">
+type DirectivePlugin struct {
+	// 指令名, 可以省略v-前缀
+	Name string `yaml:"name"`
+	// 将指令的值绑定到这个attr/prop上
+	Bind string `yaml:"bind"`
+	// 添加的静态class
+	Class []string `yaml:"class"`
+	// 添加的静态attr
+	Attrs map[string]string `yaml:"attrs"`
+	// 在go中使用时可以用方法修改节点, 在Bind/Class/Attrs之后调用.
+	// e是复制的节点, 可以直接修改其中的字段, 但修改slice与map之前需要先复制.
+	Func func(e *VueElement, d Directive) `yaml:"-"`
+}
+
+// 处理节点上的编译时指令, 返回复制的节点, 不会修改节点本身
+func (c *Compiler) withPlugins(e *VueElement) *VueElement {
+	if len(c.Plugins) == 0 {
+		return e
+	}
+	var ds []Directive
+	var used []Directive
+	for _, d := range e.Directives {
+		if c.Plugins[d.Name] != nil {
+			used = append(used, d)
+		} else {
+			ds = append(ds, d)
+		}
+	}
+	if len(used) == 0 {
+		return e
+	}
+
+	n := *e
+	n.Directives = ds
+	for _, d := range used {
+		p := c.Plugins[d.Name]
+		if p.Bind != "" {
+			n.Props = append(append(Props{}, n.Props...), Prop{Key: p.Bind, Val: d.Value})
+		}
+		if len(p.Class) != 0 {
+			n.Class = append(append([]string{}, n.Class...), p.Class...)
+		}
+		if len(p.Attrs) != 0 {
+			keys := make([]string, 0, len(p.Attrs))
+			for k := range p.Attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			n.Attrs = append([]Attribute{}, n.Attrs...)
+			for _, k := range keys {
+				n.Attrs = append(n.Attrs, Attribute{Key: k, Val: p.Attrs[k]})
+			}
+		}
+		if p.Func != nil {
+			p.Func(&n, d)
+		}
+	}
+	return &n
+}
@@ -0,0 +1,88 @@
+// Code generated by ./generotor_builtin_source/main.go. DO NOT EDIT.
+
+package runtime
+
+// 生成的代码中使用的未导出的类型与方法.
+// 使用共享运行时的包中, builtin.go会声明它们的别名(如propsScope = runtime.PropsScope), 生成的组件代码和复制运行时的包一样.
+
+type (
+	Block         = block
+	Blocks        = blocks
+	ComponentMeta = componentMeta
+	Directive     = directive
+	Directives    = directives
+	OnceCached    = onceCached
+	ScopeTrace    = scopeTrace
+	ScriptSpan    = scriptSpan
+	StyleSpan     = styleSpan
+	TeleportSpan  = teleportSpan
+	Teleports     = teleports
+	UsedBlock     = usedBlock
+	VonDirective  = vonDirective
+	VonManifest   = vonManifest
+	VonSpan       = vonSpan
+	Warnings      = warnings
+)
+
+var (
+	BuiltinAsync          = _async
+	BuiltinComponent      = _component
+	BuiltinOnce           = _once
+	BuiltinScriptOutlet   = _scriptOutlet
+	BuiltinSlot           = _slot
+	BuiltinStyleOutlet    = _styleOutlet
+	BuiltinTag            = _tag
+	BuiltinTeleport       = _teleport
+	BuiltinTeleportTarget = _teleportTarget
+	BuiltinTemplate       = _template
+	BuiltinVonOutlet      = _vonOutlet
+	BuiltinArg            = builtinArg
+	BuiltinArgBool        = builtinArgBool
+	BuiltinDirectives     = builtinDirectives
+	ComponentScope        = componentScope
+	DefaultValue          = defaultValue
+	EmptyFunc             = emptyFunc
+	Escape                = escape
+	ExtendMap             = extendMap
+	ExtendScope           = extendScope
+	FloatToStr            = floatToStr
+	GenAttr               = genAttr
+	GenStyle              = genStyle
+	GetAttrFromProps      = getAttrFromProps
+	GetClassFromProps     = getClassFromProps
+	GetMapInterfaceKey    = getMapInterfaceKey
+	GetSortedKey          = getSortedKey
+	GetStyleFromProps     = getStyleFromProps
+	Inject                = inject
+	IntToStr              = intToStr
+	Interface2Slice       = interface2Slice
+	InterfaceAdd          = interfaceAdd
+	InterfaceGreater      = interfaceGreater
+	InterfaceLess         = interfaceLess
+	InterfaceToBool       = interfaceToBool
+	InterfaceToFloat      = interfaceToFloat
+	InterfaceToFunc       = interfaceToFunc
+	InterfaceToStr        = interfaceToStr
+	IsJsType              = isJsType
+	IsNumber              = isNumber
+	LookInterface         = lookInterface
+	LookInterfaceToSlice  = lookInterfaceToSlice
+	LooseEqual            = looseEqual
+	MixinAttr             = mixinAttr
+	MixinClass            = mixinClass
+	MixinStyle            = mixinStyle
+	NewBlocks             = newBlocks
+	NewRenderCreator      = newRenderCreator
+	OrderedProps          = orderedProps
+	PropsScope            = propsScope
+	ProvideOptions        = provideOptions
+	ShouldLookInterface   = shouldLookInterface
+	StyleToMap            = styleToMap
+	UseScript             = useScript
+	UseStyle              = useStyle
+	VModelChecked         = vModelChecked
+	VModelContains        = vModelContains
+	VModelEqual           = vModelEqual
+	VModelValue           = vModelValue
+	VonAttr               = vonAttr
+)
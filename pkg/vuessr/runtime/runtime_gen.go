@@ -0,0 +1,2153 @@
+// Code generated by ./generotor_builtin_source/main.go. DO NOT EDIT.
+
+package runtime
+
+// src: ./generotor_builtin_source/source.go
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/pkg/ssrtool/rinterface"
+	"html"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Render struct {
+	// 用在模板的全局变量, 可以理解为js中的windows, 每个组件中都可以直接读取到这个对象中的值.
+	// 其中可以存放常量 与 方法
+	Global *Scope
+
+	// 上下文, 你可以在上下文存储任何东西, 方便在多个方法或者指令之间(而不是模板中)共用变量
+	Store Store
+
+	// 注册的动态组件
+	components map[string]ComponentFunc
+	// 指令
+	directives    map[string]DirectivesFunc
+	writerCreator func() Writer
+
+	// 一个Render可能不只一个Write, 多个Write可能并行
+
+	// <teleport>收集的节点, 将在<teleport-target>中输出
+	teleports *teleports
+	// v-on收集的事件
+	von *vonManifest
+	// 本次渲染中用到的组件css, 将在<style-outlet>中输出
+	styles *blocks
+	// 本次渲染中用到的组件<script client>, 将在<script-outlet>中输出
+	scripts *blocks
+
+	// strict模式, 见RenderCreator.Strict
+	strict   bool
+	warnings *warnings
+}
+
+func (r Render) NewWriter() Writer {
+	return r.writerCreator()
+}
+
+// 渲染注册的组件
+func (r *Render) Render(name string, w Writer, options *Options) {
+	if c, ok := r.components[name]; ok {
+		c(r, w, options)
+		return
+	}
+	w.WriteString(fmt.Sprintf("<p>not register component: %s</p>", name))
+}
+
+// 获取本次渲染中所有v-on事件, 用于给前端绑定事件
+func (r *Render) VonManifest() []VonEvent {
+	return r.von.get()
+}
+
+// 获取本次渲染中的警告, 只在strict模式下收集, 如:
+//   - 模板中使用了未定义的变量
+//   - 缺少组件必须的prop, prop的类型不正确
+func (r *Render) Warnings() []Warning {
+	return r.warnings.get()
+}
+
+// 用来低成本生成一个Render
+// 注意: RenderCreator里所有变量在初始化之后都不应该被修改, 在Render中不应该有对其有副作用的操作.
+type RenderCreator struct {
+	Var *Scope // 存储静态变量与方法
+	// 注册的动态组件
+	Components map[string]ComponentFunc
+	// 指令
+	Directives map[string]DirectivesFunc
+	// 支持在指令里新生成一个Writer (用于异步渲染)
+	WriterCreator func() Writer
+	// strict模式, 用于开发与测试, 渲染时会检查并记录警告(见Render.Warnings):
+	//   - 模板中使用了未定义的变量 (Scope.Get找不到变量), 如拼写错误的{{tittle}}
+	//   - 组件声明的prop类型不正确或者缺少required的prop
+	// 由于会有额外的开销, 不建议在生产环境中开启.
+	Strict bool
+}
+
+func (c *RenderCreator) NewRender() *Render {
+	return &Render{
+		Global:        NewScope(c.Var),
+		Store:         map[string]interface{}{},
+		components:    c.Components,
+		directives:    c.Directives,
+		writerCreator: c.WriterCreator,
+		teleports:     &teleports{m: map[string][]Span{}},
+		von:           &vonManifest{},
+		styles:        newBlocks(),
+		scripts:       newBlocks(),
+		strict:        c.Strict,
+		warnings:      &warnings{},
+	}
+}
+
+// 注册指令
+func (c *RenderCreator) Directive(name string, f DirectivesFunc) {
+	c.Directives[name] = f
+}
+
+// 注册方法
+func (c *RenderCreator) Func(name string, f Function) {
+	c.Var.Set(name, f)
+}
+
+// 使用另一个包生成的组件库, 合并它的组件与指令, 之后在模板中就可以使用库中的组件.
+// 只有使用共享运行时(pkg/vuessr/runtime)生成的包才能互相使用, 它们的Render等类型是相同的.
+// 有重名的组件或者指令时返回错误, 并且不会修改c. 库中注册的全局变量与方法不会被合并.
+func (c *RenderCreator) Use(lib *RenderCreator) error {
+	var conflicts []string
+	for name := range lib.Components {
+		if _, ok := c.Components[name]; ok {
+			conflicts = append(conflicts, "component "+name)
+		}
+	}
+	builtin := builtinDirectives()
+	for name := range lib.Directives {
+		if _, ok := builtin[name]; ok {
+			continue
+		}
+		if _, ok := c.Directives[name]; ok {
+			conflicts = append(conflicts, "directive "+name)
+		}
+	}
+	if len(conflicts) != 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("conflict with registered: %s", strings.Join(conflicts, ", "))
+	}
+
+	if c.Components == nil {
+		c.Components = map[string]ComponentFunc{}
+	}
+	for name, f := range lib.Components {
+		c.Components[name] = f
+	}
+	if c.Directives == nil {
+		c.Directives = map[string]DirectivesFunc{}
+	}
+	for name, f := range lib.Directives {
+		if _, ok := builtin[name]; !ok {
+			c.Directives[name] = f
+		}
+	}
+	return nil
+}
+
+// newRenderCreator 由代码生成器调用, 用作初始化(减少代码生成)
+func newRenderCreator() *RenderCreator {
+	v := NewScope(nil)
+	v.Set("inject", Function(inject))
+
+	return &RenderCreator{
+		Var:        v,
+		Components: nil, // inject by generator
+		Directives: builtinDirectives(),
+		WriterCreator: func() Writer {
+			return NewBufferSpans()
+		},
+	}
+}
+
+// 运行时自带的指令
+func builtinDirectives() map[string]DirectivesFunc {
+	return map[string]DirectivesFunc{
+		// 收集组件实例的数据, 作为data参数传递给组件的<script client>, 见_scriptOutlet
+		// 参数是组件名, 由编译器生成
+		"v-client-data": func(r *Render, w Writer, binding DirectivesBinding, options *Options) {
+			r.scripts.add(binding.Arg, nil, binding.Value)
+		},
+		"v-show": func(r *Render, w Writer, binding DirectivesBinding, options *Options) {
+			if !rinterface.ToBool(binding.Value) {
+				if options.Style == nil {
+					options.Style = map[string]string{}
+				}
+				options.Style["display"] = "none"
+			}
+		},
+	}
+}
+
+type Store map[string]interface{}
+
+func (g Store) Get(key string) interface{} {
+	return g[key]
+}
+
+func (g Store) Set(key string, val interface{}) {
+	g[key] = val
+}
+
+type Global struct {
+	*Scope
+}
+
+func (p *Global) Func(name string, f Function) {
+	p.Scope.Set(name, f)
+}
+
+func (p *Global) Var(name string, v interface{}) {
+	p.Scope.Set(name, v)
+}
+
+// 实现在模板中调用函数语法: {{func(a)}}
+// options: 支持在options中获取变量(如inject的变量)
+// r: 从Render中获取全局变量(r.Global)
+// args: 从模板中传递的变量
+type Function func(r *Render, options *Options, args ...interface{}) interface{}
+
+type DirectivesBinding struct {
+	Value interface{}
+	Arg   string // v-tooltip:top, 动态参数v-tooltip:[placement]会计算为字符串
+	Name  string
+	// 修饰符, v-tooltip.lazy.once => {"lazy": true, "once": true}
+	Modifiers map[string]bool
+}
+
+type DirectivesFunc func(r *Render, w Writer, b DirectivesBinding, options *Options)
+
+func emptyFunc(r *Render, options *Options, args ...interface{}) interface{} {
+	if len(args) != 0 {
+		return args[0]
+	}
+	return nil
+}
+
+// js中的作用域
+type Scope struct {
+	p      *Scope
+	values map[string]interface{}
+	// strict模式下用于记录未定义的变量, 子作用域会继承
+	trace *scopeTrace
+}
+
+type scopeTrace struct {
+	r         *Render
+	component string
+}
+
+func (s *Scope) ParentScope() *Scope {
+	return s.p
+}
+
+// 设置暂时只支持在当前作用域设置变量
+// 避免对上层变量造成副作用
+func (s *Scope) Set(k string, v interface{}) {
+	s.values[k] = v
+}
+
+// 查找作用域中的变量, 返回变量所在的map
+func (s *Scope) Find(k string) map[string]interface{} {
+	curr := s
+	for curr != nil {
+		if _, ok := curr.values[k]; ok {
+			return curr.values
+		}
+
+		curr = curr.p
+	}
+
+	return nil
+}
+
+func NewScope(parent *Scope) *Scope {
+	return extendScope(parent, map[string]interface{}{})
+}
+
+func extendScope(parent *Scope, data map[string]interface{}) *Scope {
+	s := &Scope{
+		p:      parent,
+		values: data,
+	}
+	if parent != nil {
+		s.trace = parent.trace
+	}
+	return s
+}
+
+// 组件的作用域, 由没有<script>声明的组件调用
+func propsScope(r *Render, name string, options *Options) *Scope {
+	s := extendScope(r.Global, options.Props.data)
+	if r.strict {
+		s.trace = &scopeTrace{r: r, component: name}
+	}
+	return s
+}
+
+// 获取作用域中的变量
+// 会向上查找
+func (s *Scope) Get(k ...string) (v interface{}) {
+	var rootExist bool
+	var ok bool
+
+	curr := s
+	for curr != nil {
+		v, rootExist, ok = shouldLookInterface(curr.values, k...)
+		// 如果root存在, 则说明就应该读取当前作用域, 否则向上层作用域查找
+		if rootExist {
+			if !ok {
+				return nil
+			} else {
+				return
+			}
+		}
+
+		curr = curr.p
+	}
+
+	if s.trace != nil && len(k) != 0 {
+		s.trace.r.warnings.add(s.trace.component, fmt.Sprintf("undefined variable '%s': %s", k[0], strings.Join(k, ".")))
+	}
+	return
+}
+
+type Writer interface {
+	// 如果需要实现异步计算, 则需要将span存储, 在最后统一计算出string.
+	WriteSpan(Span)
+	// 如果是同步计算, 使用WriteString会将string结果直接存储或者拼接
+	WriteString(string)
+	Result() string
+}
+
+type Span interface {
+	Result() string
+}
+
+// 将多个Promise拼接为一个, 以减少内存与链的长度
+type BufferSpan struct {
+	s *strings.Builder
+}
+
+func (p *BufferSpan) Result() string {
+	return p.s.String()
+}
+
+func (p *BufferSpan) WriteString(s string) {
+	p.s.WriteString(s)
+}
+
+func NewBufferSpan(s string) Span {
+	var b strings.Builder
+	b.WriteString(s)
+	return &BufferSpan{
+		s: &b,
+	}
+}
+
+// buffer块, 同步计算
+// 写入的Span不会立即计算, 而是在Result时才计算, 这样Span就可以输出在它之后才渲染的内容(如teleport)
+type BufferWriter struct {
+	s     *strings.Builder
+	spans []Span // 在s之前写入的块
+}
+
+func (p *BufferWriter) WriteSpan(span Span) {
+	if p.s.Len() != 0 {
+		p.spans = append(p.spans, &BufferSpan{s: p.s})
+		p.s = &strings.Builder{}
+	}
+	p.spans = append(p.spans, span)
+}
+
+func (p *BufferWriter) WriteString(s string) {
+	p.s.WriteString(s)
+}
+
+func (p *BufferWriter) Result() string {
+	if len(p.spans) == 0 {
+		return p.s.String()
+	}
+
+	var b strings.Builder
+	for _, s := range p.spans {
+		b.WriteString(s.Result())
+	}
+	b.WriteString(p.s.String())
+	return b.String()
+}
+
+func NewBufferSpans() Writer {
+	var b strings.Builder
+	return &BufferWriter{
+		s: &b,
+	}
+}
+
+// ListSpans将存储Span链表, 在最后计算结果, 可以实现并行计算.
+type ListSpans struct {
+	Value Span
+	Next  *ListSpans
+	Last  *ListSpans // 用于在append时提升速度
+}
+
+func (p *ListSpans) WriteSpans(s Writer) {
+	switch t := s.(type) {
+	case *ListSpans:
+		if t == nil || t.Value == nil {
+			return
+		}
+
+		if p.Value == nil {
+			if t.Next != nil {
+				// 跳过s的第一个元素, 将值存储到自己
+				// 注意: 如果s只有一个元素, 由于s.last存储的是s自己, p.Last也赋值为s.last的话, 如果跳过s, 就导致了p.Last存储了一个被抛弃(跳过)的元素, 当下次赋值p.Last.Next就会出错
+				p.Value = t.Value
+				p.Last = t.Last
+				p.Next = t.Next
+			} else {
+				// 如果s只有一个元素, 则抛弃s, 由p自己存储此元素
+				p.WriteSpan(t.Value)
+			}
+			return
+		}
+
+		if p.Last == nil || t.Last == nil {
+			panic("last不能为空")
+		}
+
+		// TODO 如果Last和t第一个元素可以合并, 则再合并一次
+		p.Last.Next = t
+		p.Last = t.Last
+	default:
+		panic("listSpan support Append listSpan only")
+	}
+}
+
+func (l *ListSpans) WriteString(s string) {
+	l.WriteSpan(NewBufferSpan(s))
+}
+
+func (p *ListSpans) WriteSpan(s Span) {
+	if p.Value == nil {
+		p.Value = s
+		p.Last = p
+		return
+	}
+
+	// 如果s是StringSpan并且p.Last也是StringSpan的话, 就将s的值附加到Last上
+	// 以减少链的长度
+	if ss, ok := s.(*BufferSpan); ok {
+		if ls, ok := p.Last.Value.(*BufferSpan); ok {
+			ls.WriteString(ss.Result())
+			return
+		}
+	}
+
+	last := &ListSpans{
+		Value: s,
+	}
+
+	p.Last.Next = last
+	p.Last = last
+}
+
+func (l *ListSpans) Result() string {
+	if l == nil || l.Value == nil {
+		return ""
+	}
+
+	b := strings.Builder{}
+
+	for cur := l; cur != nil; cur = cur.Next {
+		b.WriteString(cur.Value.Result())
+	}
+
+	return b.String()
+}
+
+func (l *ListSpans) Length() int {
+	if l == nil || l.Value == nil {
+		return 0
+	}
+
+	i := 0
+	for cur := l; cur != nil; cur = cur.Next {
+		i++
+	}
+
+	return i
+}
+
+func NewListSpans() Writer {
+	return &ListSpans{}
+}
+
+type ChanSpan struct {
+	c       chan string
+	getOnce sync.Once
+	setOnce sync.Once
+	r       string
+}
+
+func (p *ChanSpan) Result() string {
+	p.getOnce.Do(func() {
+		p.r = <-p.c
+	})
+	return p.r
+}
+
+func (p *ChanSpan) Done(s string) {
+	p.setOnce.Do(func() {
+		p.c <- s
+	})
+}
+
+func NewChanSpan() *ChanSpan {
+	return &ChanSpan{
+		c: make(chan string, 1),
+	}
+}
+
+// 自带的组件
+func _component(r *Render, w Writer, options *Options) {
+	val, ok := options.Props.Get("is")
+	if !ok {
+		return
+	}
+	is, ok := val.(string)
+	if !ok {
+		return
+	}
+
+	if c, ok := r.components[is]; ok {
+		// is只用于选择组件, 不会传递给组件, 也不会出现在$attrs中
+		o := *options
+		o.Props = options.Props.omit("is")
+		c(r, w, &o)
+		return
+	}
+	w.WriteString(fmt.Sprintf("<p>not register com: %s</p>", is))
+}
+
+func _template(r *Render, w Writer, options *Options) {
+	// exec directive
+	options.Directives.Exec(r, w, options)
+
+	options.Slots.Exec(w, "default", Props{})
+}
+
+// v-once渲染的html, 进程级别的缓存, key是包的import path, 组件名与节点的序号
+var onceCache sync.Map
+
+// v-once, 第一次渲染后缓存html
+// tip: 缓存中的html是同步计算的, 所以v-once中不应该有<teleport-target>等延迟计算的组件
+// 缓存中还会记录渲染时用到的组件css/js, v-client-data与v-on事件, 在之后的渲染中重新注册.
+// v-on事件的id在每次渲染中是唯一的, 重新注册时会使用新的id, 并替换html中的data-von-id.
+func _once(r *Render, w Writer, key string, f func(w Writer)) {
+	if c, ok := onceCache.Load(key); ok {
+		c := c.(onceCached)
+		for _, u := range c.styles {
+			r.styles.add(u.ID, u.block, u.data...)
+		}
+		for _, u := range c.scripts {
+			r.scripts.add(u.ID, u.block, u.data...)
+		}
+		html := c.html
+		if len(c.events) != 0 {
+			html = r.von.replay(c.events).Replace(html)
+		}
+		w.WriteString(html)
+		return
+	}
+
+	styles := r.styles.snapshot()
+	scripts := r.scripts.snapshot()
+	events := r.von.snapshot()
+	ow := r.NewWriter()
+	f(ow)
+	c := onceCached{
+		html:    ow.Result(),
+		styles:  r.styles.since(styles),
+		scripts: r.scripts.since(scripts),
+		events:  r.von.since(events),
+	}
+	onceCache.Store(key, c)
+	w.WriteString(c.html)
+}
+
+type onceCached struct {
+	html    string
+	styles  []usedBlock
+	scripts []usedBlock
+	events  []VonEvent
+}
+
+// 内置组件Slot, 将渲染父级传递的slot.
+func _slot(r *Render, w Writer, options *Options) {
+	attr, _ := options.Attrs.Get("name")
+	name := attr.Val
+	if name == "" {
+		name = "default"
+	}
+	props := options.Props
+	injectSlotFunc, ok := options.P.Slots[name]
+
+	// 如果没有传递slot 则使用自身默认的slot
+	if !ok {
+		injectSlotFunc = options.Slots["default"]
+	}
+
+	injectSlotFunc.Exec(w, props)
+}
+
+func _async(r *Render, w Writer, options *Options) {
+	s := NewChanSpan()
+	// 异步子节点计算
+	go func() {
+		w := r.NewWriter()
+		options.Slots.Exec(w, "default", Props{})
+		s.Done(w.Result())
+	}()
+
+	w.WriteSpan(s)
+
+	return
+}
+
+// 内置组件teleport, 将子节点渲染到同名的<teleport-target>处, 而不是当前位置.
+// <teleport to="body-end">...</teleport>
+// 当disabled为true时则在当前位置渲染.
+func _teleport(r *Render, w Writer, options *Options) {
+	if builtinArgBool(options, "disabled") {
+		options.Slots.Exec(w, "default", Props{})
+		return
+	}
+
+	tw := r.NewWriter()
+	options.Slots.Exec(tw, "default", Props{})
+	r.teleports.add(builtinArg(options, "to"), tw)
+}
+
+// 内置组件teleport-target, 输出所有to为name的teleport内容.
+// <teleport-target name="body-end"></teleport-target>
+// 由于输出的是延迟计算的Span, 所以target可以写在teleport之前.
+// 注意: 在<async>中的target会在异步渲染结束时就计算结果, 只能输出在这之前收集到的内容.
+func _teleportTarget(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&teleportSpan{
+		t:    r.teleports,
+		name: builtinArg(options, "name"),
+	})
+}
+
+type teleports struct {
+	l sync.Mutex
+	m map[string][]Span
+}
+
+func (t *teleports) add(name string, s Span) {
+	t.l.Lock()
+	t.m[name] = append(t.m[name], s)
+	t.l.Unlock()
+}
+
+func (t *teleports) get(name string) []Span {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.m[name]
+}
+
+type teleportSpan struct {
+	t    *teleports
+	name string
+}
+
+func (p *teleportSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.t.get(p.name) {
+		b.WriteString(s.Result())
+	}
+	return b.String()
+}
+
+// 内置组件von-outlet, 输出本次渲染中所有v-on事件的json, 供前端的事件分发脚本使用.
+// 和teleport-target一样是延迟计算的, 可以写在任意位置.
+func _vonOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&vonSpan{m: r.von})
+}
+
+// 组件<style>中的css或者<script client>中的js, 由代码生成器生成, id是组件名
+type block struct {
+	ID   string
+	Code string
+}
+
+// 组件渲染时注册自己的css
+func useStyle(r *Render, b *block) {
+	r.styles.add(b.ID, b)
+}
+
+// 组件渲染时注册自己的<script client>
+func useScript(r *Render, b *block) {
+	r.scripts.add(b.ID, b)
+}
+
+// 本次渲染中用到的块, 每个块只记录一次
+type blocks struct {
+	l sync.Mutex
+	m map[string]*usedBlock
+}
+
+type usedBlock struct {
+	*block
+	// v-client-data收集的组件实例数据, 按照渲染顺序排列
+	data []interface{}
+}
+
+func newBlocks() *blocks {
+	return &blocks{m: map[string]*usedBlock{}}
+}
+
+// 注册块与数据, b为nil时只记录数据
+func (s *blocks) add(id string, b *block, data ...interface{}) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	u, ok := s.m[id]
+	if !ok {
+		u = &usedBlock{}
+		s.m[id] = u
+	}
+	if b != nil {
+		u.block = b
+	}
+	u.data = append(u.data, data...)
+}
+
+// 按照id排序, 保证每次渲染的顺序一致, 没有注册块(只有数据)的不会返回
+func (s *blocks) get() []usedBlock {
+	s.l.Lock()
+	defer s.l.Unlock()
+	bs := make([]usedBlock, 0, len(s.m))
+	for _, u := range s.m {
+		if u.block != nil {
+			bs = append(bs, usedBlock{block: u.block, data: append([]interface{}{}, u.data...)})
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool {
+		return bs[i].ID < bs[j].ID
+	})
+	return bs
+}
+
+// 记录当前每个块的数据长度, 配合since获取之后新注册的块与数据
+func (s *blocks) snapshot() map[string]int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	m := make(map[string]int, len(s.m))
+	for id, u := range s.m {
+		if u.block != nil {
+			m[id] = len(u.data)
+		}
+	}
+	return m
+}
+
+func (s *blocks) since(snapshot map[string]int) (bs []usedBlock) {
+	for _, u := range s.get() {
+		n, ok := snapshot[u.ID]
+		if !ok {
+			bs = append(bs, u)
+		} else if len(u.data) > n {
+			bs = append(bs, usedBlock{block: u.block, data: u.data[n:]})
+		}
+	}
+	return
+}
+
+// 获取本次渲染中用到的所有组件的css
+func (r *Render) Css() string {
+	var b strings.Builder
+	for _, s := range r.styles.get() {
+		b.WriteString(s.Code)
+	}
+	return b.String()
+}
+
+// 内置组件style-outlet, 输出本次渲染中用到的组件的css, 每个组件一个<style>.
+// 和teleport-target一样是延迟计算的, 可以写在<head>中.
+func _styleOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&styleSpan{s: r.styles})
+}
+
+type styleSpan struct {
+	s *blocks
+}
+
+func (p *styleSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.s.get() {
+		b.WriteString("<style data-style-id=\"" + s.ID + "\">" + s.Code + "</style>")
+	}
+	return b.String()
+}
+
+// 内置组件script-outlet, 输出本次渲染中用到的组件的<script client>, 每个组件一个<script>.
+// 组件的js会被包裹在方法中执行, v-client-data收集的所有实例数据将作为data参数传入:
+//   <script data-script-id="swiper">(function(data){...})([{"id":1}]);</script>
+func _scriptOutlet(r *Render, w Writer, options *Options) {
+	w.WriteSpan(&scriptSpan{s: r.scripts})
+}
+
+type scriptSpan struct {
+	s *blocks
+}
+
+func (p *scriptSpan) Result() string {
+	var b strings.Builder
+	for _, s := range p.s.get() {
+		data := s.data
+		if data == nil {
+			data = []interface{}{}
+		}
+		bs, _ := json.Marshal(data)
+		b.WriteString("<script data-script-id=\"" + s.ID + "\">(function(data){\n" + s.Code + "\n})(" + string(bs) + ");</script>")
+	}
+	return b.String()
+}
+
+// 获取内置组件的参数, 支持静态写法name="x"与动态写法:name="x"
+func builtinArg(options *Options, key string) string {
+	if v, ok := options.Props.Get(key); ok {
+		return interfaceToStr(v)
+	}
+	attr, _ := options.Attrs.Get(key)
+	return attr.Val
+}
+
+// 获取内置组件的bool参数, 静态写法只要存在这个attr就是true
+func builtinArgBool(options *Options, key string) bool {
+	if v, ok := options.Props.Get(key); ok {
+		return interfaceToBool(v)
+	}
+	_, ok := options.Attrs.Get(key)
+	return ok
+}
+
+// voidElements 没有子元素, 会渲染成 <br/> 这样的格式
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"keygen": true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// 动态tag
+// 何为动态tag:
+// - 每个组件的root层tag(attr受到上层传递的props影响)
+// - 有自己定义指令(自定义指令需要修改组件所有属性, 只能由动态tag实现)
+func _tag(r *Render, w Writer, tagName string, isRoot bool, options *Options) {
+	// exec directive
+	options.Directives.Exec(r, w, options)
+
+	var p *Options
+	if isRoot {
+		p = options.P
+	}
+
+	// v-bind="obj"展开的class/style在Props中, 需要和静态class/style合并
+	class, style, props := options.Class, options.Style, options.Props
+	c, hasClass := props.Get("class")
+	if hasClass {
+		class = append(getClassFromProps(c), class...)
+	}
+	s, hasStyle := props.Get("style")
+	if hasStyle {
+		st := getStyleFromProps(styleToMap(s))
+		for k, v := range style {
+			st[k] = v
+		}
+		style = st
+	}
+	if hasClass || hasStyle {
+		props = props.omit("class", "style")
+	}
+
+	// attr
+	attr := mixinClass(p, class, options.PropsClass) +
+		mixinStyle(p, style, options.PropsStyle) +
+		mixinAttr(p, options.Attrs, props)
+	if len(options.VonDirectives) != 0 {
+		attr += vonAttr(r, options.VonDirectives)
+	}
+
+	if voidElements[tagName] {
+		w.WriteString(fmt.Sprintf("<%s%s/>", tagName, attr))
+	} else {
+		w.WriteString(fmt.Sprintf("<%s%s>", tagName, attr))
+		options.Slots.Exec(w, "default", Props{})
+		w.WriteString(fmt.Sprintf("</%s>", tagName))
+	}
+
+	return
+}
+
+type Attribute struct {
+	Key, Val string
+}
+
+type Attributes []Attribute
+
+func (p Attributes) Get(key string) (Attribute, bool) {
+	for _, i := range p {
+		if i.Key == key {
+			return i, true
+		}
+	}
+
+	return Attribute{}, false
+}
+
+func (p *Attributes) Append(key string, val string) {
+	*p = append(*p, Attribute{Key: key, Val: val})
+}
+
+// 渲染组件需要的结构
+// tip: 此结构应该尽量的简单, 减少渲染时处理才能性能更好.
+type Options struct {
+	Props      Props                  // 本节点的数据(不包含class和style)
+	PropsClass interface{}            // :class
+	PropsStyle map[string]interface{} // :style
+	Attrs      Attributes             // 本节点静态的attrs (除去class和style)
+	Class      []string               // 本节点静态class
+	Style      map[string]string      // 本节点静态style
+	Slots      Slots                  // 当前组件所有的插槽代码(v-slot指令和默认的子节点), 支持多个不同名字的插槽, 如果没有名字则是"default"
+	// 有两种情况
+	// -  如果渲染的是元素（div等html元素），那么P是它所属的组件数据 ①
+	// -  如果渲染的是组件，那么P是它的父级组件数据 ②
+	// 在以下场景会用到 (后面的数字指的是属于上方的哪一种情况)
+	// - 渲染插槽. (根据name取到所属组件的slot) ①
+	// - 读取上层传递的PropsClass, 在root tag会读取上层的class等作用在自己身上. ①
+	// - Inject ①
+	// - Provide ①/②
+	P             *Options
+	Directives    directives // 多个指令
+	VonDirectives []vonDirective
+	// 组件模板中能够访问的所有值, 由Prototype+Props组成, 在指令中可以修改这个值达到声明变量的目的
+	// tips: 由于渲染顺序, 修改只会影响到子节点
+	Scope   *Scope
+	Provide map[string]interface{}
+
+	// 组件在<script>中声明的信息, 在组件render方法中设置, 没有声明时为nil
+	meta *componentMeta
+}
+
+// 组件在<script>中声明的选项, 由代码生成器生成
+type componentMeta struct {
+	Props        map[string]bool // 声明的props, 为nil表示没有声明
+	InheritAttrs bool
+	// 模板中读取了$attrs, 只有这时才会生成$attrs
+	Attrs bool
+	// 没有声明props时也把所有props渲染为attr, 见fallthroughProps
+	AllAttrs bool
+	// <style module>中的class, 如{"$style": {"title": "title_5f2b1c3a"}}
+	Modules map[string]map[string]interface{}
+	// props的默认值, 上层没有传递这个prop时使用
+	Defaults map[string]interface{}
+
+	// 以下用于strict模式
+	Name string
+	// props声明的类型, 如{"size": {"Number", "String"}}
+	Types    map[string][]string
+	Required map[string]bool
+}
+
+// 生成组件的作用域, 由有<script>/<style module>或者使用了$attrs的组件调用
+// $attrs与静态传递的props(如<card title="hi">)存放在Props的上一层作用域中, 避免修改Props.
+func componentScope(r *Render, options *Options, meta *componentMeta) *Scope {
+	options.meta = meta
+	s := NewScope(r.Global)
+	if meta != nil && meta.Attrs {
+		s.Set("$attrs", options.attrs().Map())
+	}
+	if meta != nil {
+		for name, classes := range meta.Modules {
+			s.Set(name, classes)
+		}
+		if r.strict {
+			s.trace = &scopeTrace{r: r, component: meta.Name}
+			// 声明了但没有传递的prop是undefined, 而不是未定义的变量
+			for name := range meta.Props {
+				s.Set(name, nil)
+			}
+		}
+		for name, v := range meta.Defaults {
+			s.Set(name, v)
+		}
+	}
+	for _, i := range options.Attrs {
+		if options.declared(i.Key) {
+			s.Set(i.Key, i.Val)
+		}
+	}
+	if r.strict && meta != nil {
+		meta.validate(r, options)
+	}
+	return extendScope(s, options.Props.data)
+}
+
+// 检查上层传递的props是否符合声明
+func (m *componentMeta) validate(r *Render, options *Options) {
+	names := make([]string, 0, len(m.Props))
+	for name := range m.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := options.Props.Get(name)
+		if !ok {
+			var attr Attribute
+			attr, ok = options.Attrs.Get(name)
+			v = attr.Val
+		}
+		if !ok {
+			if m.Required[name] {
+				r.warnings.add(m.Name, fmt.Sprintf("missing required prop '%s'", name))
+			}
+			continue
+		}
+		if types := m.Types[name]; v != nil && len(types) != 0 && !isJsType(v, types) {
+			r.warnings.add(m.Name, fmt.Sprintf("invalid prop '%s': expected %s, got %T", name, strings.Join(types, "|"), v))
+		}
+	}
+}
+
+// 值是否是js中的某个类型, 未知的类型(如Date)认为都符合
+func isJsType(v interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "String":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "Boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "Number":
+			switch v.(type) {
+			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+				return true
+			}
+		case "Array":
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+				return true
+			}
+		case "Object":
+			if reflect.ValueOf(v).Kind() == reflect.Map {
+				return true
+			}
+		case "Function":
+			if _, ok := v.(Function); ok {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// strict模式下收集的警告
+type Warning struct {
+	Component string
+	Message   string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s, component: %s", w.Message, w.Component)
+}
+
+// 同一个警告只记录一次 (如v-for中每次循环都会读取一次未定义的变量)
+type warnings struct {
+	l    sync.Mutex
+	list []Warning
+	seen map[Warning]bool
+}
+
+func (s *warnings) add(component, message string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	w := Warning{Component: component, Message: message}
+	if s.seen[w] {
+		return
+	}
+	if s.seen == nil {
+		s.seen = map[Warning]bool{}
+	}
+	s.seen[w] = true
+	s.list = append(s.list, w)
+}
+
+func (s *warnings) get() []Warning {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]Warning(nil), s.list...)
+}
+
+// 是否是组件声明了的prop
+func (o *Options) declared(key string) bool {
+	return o.meta != nil && o.meta.Props[key]
+}
+
+// 上层传递了但组件没有声明的props与静态attr (不包括class/style)
+// 组件没有声明props时, 所有props都被认为是attr
+func (o *Options) attrs() Props {
+	a := Props{}
+	for _, i := range o.Attrs {
+		if o.declared(i.Key) {
+			continue
+		}
+		a.Set(i.Key, i.Val)
+	}
+	for _, k := range o.Props.orderKey {
+		if k == "class" || k == "style" {
+			continue
+		}
+		if o.declared(k) {
+			continue
+		}
+		a.Set(k, o.Props.data[k])
+	}
+	return a
+}
+
+// 渲染在组件root节点上的静态attr, 不包括组件声明了的prop
+func (o *Options) fallthroughAttrs() []Attribute {
+	if o.meta == nil || o.meta.Props == nil {
+		return o.Attrs
+	}
+	var as []Attribute
+	for _, i := range o.Attrs {
+		if !o.declared(i.Key) {
+			as = append(as, i)
+		}
+	}
+	return as
+}
+
+// 渲染在组件root节点上的props
+// - inheritAttrs: false 时不渲染
+// - 声明了props时渲染未声明的props
+// - 没有声明props时(兼容以前的写法)只渲染id/src/data-*, 使用了inheritAllAttrs配置时渲染所有props
+func (o *Options) fallthroughProps() Props {
+	if o.meta == nil || o.meta.Props == nil && !o.meta.AllAttrs {
+		return o.Props.CanBeAttr()
+	}
+	if !o.meta.InheritAttrs {
+		return Props{}
+	}
+	a := Props{}
+	for _, k := range o.Props.orderKey {
+		if k == "class" || k == "style" || o.declared(k) {
+			continue
+		}
+		a.Set(k, o.Props.data[k])
+	}
+	return a
+}
+
+func (o *Options) SetProvide(d map[string]interface{}) {
+	if o.Provide == nil {
+		o.Provide = d
+	} else {
+		o.Provide = map[string]interface{}{}
+		for k, v := range d {
+			o.Provide[k] = v
+		}
+	}
+	return
+}
+
+// GetProvide会循环向上层查找Provide
+func (o *Options) GetProvide(k string) (v interface{}) {
+	// 向上查找
+	curr := o
+	for curr != nil {
+		if curr.Provide != nil {
+			if v, ok := curr.Provide[k]; ok {
+				return v
+			}
+		}
+
+		curr = curr.P
+	}
+
+	return nil
+}
+
+// 生成一个带有Provide的Options, 用于元素上的v-provide指令.
+// 复制了所属组件的Options, 所以在子节点中读取options.P(如slot/class)的结果不变.
+func provideOptions(options *Options, provide map[string]interface{}) *Options {
+	o := *options
+	o.P = options
+	o.Provide = provide
+	return &o
+}
+
+// 模板中的inject('key')方法, 读取上层通过v-provide提供的值
+func inject(r *Render, options *Options, args ...interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return options.GetProvide(interfaceToStr(args[0]))
+}
+
+type directive struct {
+	Name      string
+	Value     interface{}
+	Arg       string
+	Modifiers map[string]bool
+}
+
+type vonDirective struct {
+	Event     string
+	Func      string
+	Args      []interface{}
+	Modifiers []string
+}
+
+// v-on事件, 会被序列化为json给前端使用
+type VonEvent struct {
+	Id        string        // 节点上data-von-id的值
+	Event     string        // click
+	Func      string        // 前端的方法名
+	Args      []interface{} // 在服务端计算好的参数
+	Modifiers []string      // @click.prevent.stop, 由前端处理
+}
+
+// 序列化为{id, event, func, args, modifiers}, 没有修饰符时不输出modifiers
+// tip: 此文件会被生成到反引号字符串中, 所以不能使用struct tag
+func (e VonEvent) MarshalJSON() ([]byte, error) {
+	args := e.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+	m := map[string]interface{}{
+		"id":    e.Id,
+		"event": e.Event,
+		"func":  e.Func,
+		"args":  args,
+	}
+	if len(e.Modifiers) != 0 {
+		m["modifiers"] = e.Modifiers
+	}
+	return json.Marshal(m)
+}
+
+type vonManifest struct {
+	l      sync.Mutex
+	events []VonEvent
+	id     int
+}
+
+func (m *vonManifest) add(vs []vonDirective) (id string) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.id++
+	id = "von-" + strconv.Itoa(m.id)
+	for _, v := range vs {
+		m.events = append(m.events, VonEvent{
+			Id:        id,
+			Event:     v.Event,
+			Func:      v.Func,
+			Args:      v.Args,
+			Modifiers: v.Modifiers,
+		})
+	}
+	return
+}
+
+// 已经注册的事件数量, 用于since
+func (m *vonManifest) snapshot() int {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return len(m.events)
+}
+
+// snapshot之后注册的事件
+func (m *vonManifest) since(n int) []VonEvent {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]VonEvent(nil), m.events[n:]...)
+}
+
+// 使用新的id重新注册v-once缓存中的事件, 返回将html中的旧id替换为新id的Replacer
+func (m *vonManifest) replay(es []VonEvent) *strings.Replacer {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	ids := map[string]string{}
+	var oldnew []string
+	for _, e := range es {
+		id, ok := ids[e.Id]
+		if !ok {
+			m.id++
+			id = "von-" + strconv.Itoa(m.id)
+			ids[e.Id] = id
+			oldnew = append(oldnew, "data-von-id=\""+e.Id+"\"", "data-von-id=\""+id+"\"")
+		}
+		e.Id = id
+		m.events = append(m.events, e)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func (m *vonManifest) get() []VonEvent {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return m.events
+}
+
+// 注册节点上的v-on事件, 返回需要添加到节点上的eventId属性
+func vonAttr(r *Render, vs []vonDirective) string {
+	return " data-von-id=\"" + r.von.add(vs) + "\""
+}
+
+type vonSpan struct {
+	m *vonManifest
+}
+
+func (p *vonSpan) Result() string {
+	bs, _ := json.Marshal(p.m.get())
+	return "<script type=\"application/json\" id=\"von-manifest\">" + string(bs) + "</script>"
+}
+
+type directives []directive
+
+func (ds directives) Exec(r *Render, w Writer, options *Options) {
+	for _, d := range ds {
+		if f, ok := r.directives[d.Name]; ok {
+			f(r, w, DirectivesBinding{
+				Value:     d.Value,
+				Arg:       d.Arg,
+				Name:      d.Name,
+				Modifiers: d.Modifiers,
+			}, options)
+		}
+	}
+}
+
+type Props struct {
+	orderKey []string               // 在生成attr时会用到顺序
+	data     map[string]interface{} // 存储map有利于快速存取
+}
+
+// 生成的代码中使用, 按照orderKey的顺序生成attr
+func orderedProps(orderKey []string, data map[string]interface{}) Props {
+	return Props{orderKey: orderKey, data: data}
+}
+
+func (p *Props) Del(key string, value interface{}) {
+	for index, k := range p.orderKey {
+		if k == key {
+			p.orderKey = append(p.orderKey[:index], p.orderKey[index+1:]...)
+			break
+		}
+
+	}
+	delete(p.data, key)
+}
+
+// 展开对象中的值, 用于v-bind="obj"
+// 为了生成的attr顺序固定, map会按照key排序
+func (p *Props) Spread(obj interface{}) {
+	switch t := obj.(type) {
+	case Props:
+		for _, k := range t.orderKey {
+			p.Set(k, t.data[k])
+		}
+	case map[string]interface{}:
+		for _, k := range getMapInterfaceKey(t) {
+			p.Set(k, t[k])
+		}
+	case map[string]string:
+		for _, k := range getSortedKey(t) {
+			p.Set(k, t[k])
+		}
+	}
+}
+
+func (p *Props) Set(key string, value interface{}) {
+	if p.data == nil {
+		p.data = map[string]interface{}{}
+	}
+
+	if _, ok := p.data[key]; ok {
+		p.data[key] = value
+	} else {
+		p.orderKey = append(p.orderKey, key)
+		p.data[key] = value
+	}
+}
+
+func (p Props) Get(key string) (val interface{}, exist bool) {
+	if p.data == nil {
+		return
+	}
+
+	val, exist = p.data[key]
+	return
+}
+
+// Props可以转换为map, 方便在作用域中使用
+func (p Props) Map() map[string]interface{} {
+	return p.data
+}
+
+func NewProps(data map[string]interface{}) Props {
+	return Props{
+		orderKey: getMapInterfaceKey(data),
+		data:     data,
+	}
+}
+
+// 去掉一些key, 返回新的Props
+func (p Props) omit(keys ...string) Props {
+	a := Props{}
+	for _, k := range p.orderKey {
+		skip := false
+		for _, o := range keys {
+			if k == o {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			a.Set(k, p.data[k])
+		}
+	}
+	return a
+}
+
+// 能够被当成attr渲染出来的Props
+// 只在没有声明props的自定义组件的rootTag上使用
+func (p Props) CanBeAttr() Props {
+	htmlAttr := map[string]struct{}{
+		"id":  {},
+		"src": {},
+	}
+
+	a := Props{}
+	for _, k := range p.orderKey {
+		v := p.data[k]
+		if _, ok := htmlAttr[k]; ok {
+			a.Set(k, v)
+			continue
+		}
+
+		if strings.HasPrefix(k, "data-") {
+			a.Set(k, v)
+			continue
+		}
+	}
+	return a
+}
+
+type Slots map[string]NamedSlotFunc
+
+func (s Slots) Exec(w Writer, name string, slotProps Props) {
+	if s == nil {
+		return
+	}
+	if f, ok := s[name]; ok {
+		f(w, slotProps)
+		return
+	}
+
+	return
+}
+
+// 组件的render函数
+type ComponentFunc func(r *Render, w Writer, options *Options)
+
+// 用来生成slot的方法
+// 由于slot具有自己的作用域, 所以只能使用闭包实现(而不是字符串).
+type NamedSlotFunc func(w Writer, slotProps Props)
+
+func (f NamedSlotFunc) Exec(w Writer, slotProps Props) {
+	if f == nil {
+		return
+	}
+
+	f(w, slotProps)
+}
+
+// 混合动态和静态的标签, 主要是style/class需要混合
+// todo) 如果style/class没有冲突, 则还可以优化
+// tip: 纯静态的class应该在编译时期就生成字符串, 而不应调用这个
+// classProps: 支持 obj, array, string
+// options: 上层组件的options
+func mixinClass(options *Options, staticClass []string, classProps interface{}) (str string) {
+	var class []string
+	// 静态
+	for _, c := range staticClass {
+		if c != "" {
+			class = append(class, c)
+		}
+	}
+
+	// 本身的props
+	for _, c := range getClassFromProps(classProps) {
+		if c != "" {
+			class = append(class, c)
+		}
+	}
+
+	if options != nil {
+		// 上层通过v-bind="obj"传递的class
+		if c, ok := options.Props.Get("class"); ok {
+			class = append(class, getClassFromProps(c)...)
+		}
+
+		// 上层传递的props
+		if options.PropsClass != nil {
+			for _, c := range getClassFromProps(options.PropsClass) {
+				if c != "" {
+					class = append(class, c)
+				}
+			}
+		}
+
+		// 上层传递的静态class
+		if len(options.Class) != 0 {
+			for _, c := range options.Class {
+				if c != "" {
+					class = append(class, c)
+				}
+			}
+		}
+	}
+
+	if len(class) != 0 {
+		str = " class=\"" + strings.Join(class, " ") + "\""
+	}
+
+	return
+}
+
+// 构建style, 生成如style="color: red"的代码, 如果style代码为空 则只会返回空字符串
+func mixinStyle(options *Options, staticStyle map[string]string, styleProps map[string]interface{}) (str string) {
+	style := map[string]string{}
+
+	// 静态
+	for k, v := range staticStyle {
+		style[k] = v
+	}
+
+	// 当前props
+	ps := getStyleFromProps(styleProps)
+	for k, v := range ps {
+		style[k] = v
+	}
+
+	if options != nil {
+		// 上层通过v-bind="obj"传递的style
+		if s, ok := options.Props.Get("style"); ok {
+			for k, v := range getStyleFromProps(styleToMap(s)) {
+				style[k] = v
+			}
+		}
+
+		// 上层传递的props
+		if options.PropsStyle != nil {
+			ps := getStyleFromProps(options.PropsStyle)
+			for k, v := range ps {
+				style[k] = v
+			}
+		}
+
+		// 上层传递的静态style
+		for k, v := range options.Style {
+			style[k] = v
+		}
+	}
+
+	styleCode := genStyle(style)
+	if styleCode != "" {
+		str = " style=\"" + styleCode + "\""
+	}
+
+	return
+}
+
+// 生成除了style和class的attr
+func mixinAttr(options *Options, staticAttr []Attribute, propsAttr Props) string {
+	var attrs []Attribute
+
+	// 静态
+	attrs = append(attrs, staticAttr...)
+
+	// 当前props中的attr
+	attrs = append(attrs, getAttrFromProps(propsAttr)...)
+
+	if options != nil && (options.meta == nil || options.meta.InheritAttrs) {
+		// 上层传递的静态attr
+		attrs = append(attrs, options.fallthroughAttrs()...)
+
+		// 上层传递的props
+		if options.Props.data != nil {
+			attrs = append(attrs, getAttrFromProps(options.fallthroughProps())...)
+		}
+	}
+
+	c := genAttr(attrs)
+	if c == "" {
+		return ""
+	}
+
+	return " " + c
+}
+
+func getSortedKey(m map[string]string) (keys []string) {
+	keys = make([]string, len(m))
+	index := 0
+	for k := range m {
+		keys[index] = k
+		index++
+	}
+	if len(m) < 2 {
+		return keys
+	}
+
+	sort.Strings(keys)
+
+	return
+}
+
+func getMapInterfaceKey(m map[string]interface{}) (keys []string) {
+	keys = make([]string, len(m))
+	index := 0
+	for k := range m {
+		keys[index] = k
+		index++
+	}
+	if len(m) < 2 {
+		return keys
+	}
+
+	sort.Strings(keys)
+
+	return
+}
+
+func genStyle(style map[string]string) string {
+	sortedKeys := getSortedKey(style)
+
+	var st strings.Builder
+	for _, k := range sortedKeys {
+		v := style[k]
+		if st.Len() != 0 {
+			st.WriteByte(' ')
+		}
+		st.WriteString(k + ": " + v + ";")
+	}
+
+	return st.String()
+}
+
+func genAttr(attr []Attribute) string {
+	var st strings.Builder
+	for _, k := range attr {
+		if st.Len() != 0 {
+			st.WriteByte(' ')
+		}
+		if k.Val != "" {
+			// 模板中的静态属性值没有转义, 其中的"会破坏属性
+			st.WriteString(k.Key + "=" + "\"" + strings.ReplaceAll(k.Val, "\"", "&#34;") + "\"")
+		} else {
+			st.WriteString(k.Key)
+		}
+	}
+
+	return st.String()
+}
+
+func getStyleFromProps(styleProps map[string]interface{}) map[string]string {
+	st := map[string]string{}
+	for k, v := range styleProps {
+		switch v := v.(type) {
+		case nil:
+			break
+		case string:
+			st[k] = escape(v)
+		default:
+			bs, _ := json.Marshal(v)
+			st[k] = escape(string(bs))
+		}
+	}
+	return st
+}
+
+// 将style的值转为map, 支持map与字符串"color: red; top: 0"
+func styleToMap(style interface{}) map[string]interface{} {
+	switch t := style.(type) {
+	case map[string]interface{}:
+		return t
+	case string:
+		m := map[string]interface{}{}
+		for _, item := range strings.Split(t, ";") {
+			kv := strings.SplitN(item, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			m[strings.Trim(kv[0], " ")] = strings.Trim(kv[1], " ")
+		}
+		return m
+	}
+	return nil
+}
+
+// bool属性, 如果是 则当值不是true时不会渲染出此属性
+var boolAttr = map[string]bool{
+	"autofocus": true,
+	"autoplay":  true,
+	"async":     true,
+	"checked":   true,
+	"controls":  true,
+	"defer":     true,
+	"disabled":  true,
+	"hidden":    true,
+	"loop":      true,
+	"multiple":  true,
+	"muted":     true,
+	"open":      true,
+	"readonly":  true,
+	"required":  true,
+	"scoped":    true,
+	"selected":  true,
+}
+
+// 从props生成attr, 如果props值为空(空字符串), 则不生成此attr
+// 少数bool attr当value是空值时不生成attr
+func getAttrFromProps(attrProps Props) []Attribute {
+	var st []Attribute
+	for _, key := range attrProps.orderKey {
+		value := attrProps.data[key]
+
+		isBoolAttr := boolAttr[key]
+
+		switch v := value.(type) {
+		case nil:
+			if isBoolAttr {
+				continue
+			}
+			st = append(st, Attribute{
+				Key: key,
+				Val: "",
+			})
+		case string:
+			if v == "" && isBoolAttr {
+				continue
+			}
+			st = append(st, Attribute{
+				Key: key,
+				Val: escape(v),
+			})
+		case bool:
+			if !v && isBoolAttr {
+				continue
+			}
+			bs, _ := json.Marshal(v)
+			st = append(st, Attribute{
+				Key: key,
+				Val: string(bs),
+			})
+		default:
+			bs, _ := json.Marshal(v)
+			st = append(st, Attribute{
+				Key: key,
+				Val: escape(string(bs)),
+			})
+		}
+	}
+	return st
+}
+
+// classProps: 支持 obj, array, string
+func getClassFromProps(classProps interface{}) []string {
+	if classProps == nil {
+		return nil
+	}
+	var cs []string
+	switch t := classProps.(type) {
+	case []string:
+		cs = t
+	case string:
+		cs = []string{t}
+	case map[string]interface{}:
+		var c []string
+		for k, v := range t {
+			if interfaceToBool(v) {
+				c = append(c, k)
+			}
+		}
+		sort.Strings(c)
+		cs = c
+	case []interface{}:
+		var c []string
+		for _, v := range t {
+			cc := getClassFromProps(v)
+			c = append(c, cc...)
+		}
+
+		cs = c
+	}
+
+	for i := range cs {
+		cs[i] = escape(cs[i])
+	}
+
+	return cs
+}
+
+// v-model在input/textarea上渲染的值
+// trim/number: v-model.trim / v-model.number
+func vModelValue(v interface{}, trim, number bool) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if trim {
+		s = strings.TrimSpace(s)
+		v = s
+	}
+	if number {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			v = f
+		}
+	}
+	return v
+}
+
+// v-model在checkbox上是否选中: 数组model包含value, 否则model为真值
+func vModelChecked(model interface{}, value interface{}) bool {
+	if ms := interface2Slice(model); ms != nil {
+		return vModelContains(ms, value)
+	}
+	return interfaceToBool(model)
+}
+
+// v-model在radio/option上是否选中: model和value相等, 数组model(select multiple)包含value
+func vModelEqual(model interface{}, value interface{}) bool {
+	if ms := interface2Slice(model); ms != nil {
+		return vModelContains(ms, value)
+	}
+	return looseEqual(model, value)
+}
+
+func vModelContains(ms []interface{}, value interface{}) bool {
+	for _, m := range ms {
+		if looseEqual(m, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// 和vue一样, 比较字符串形式, 如1与"1"相等
+func looseEqual(a, b interface{}) bool {
+	return interfaceToStr(a) == interfaceToStr(b)
+}
+
+func lookInterface(data interface{}, keys ...string) (desc interface{}) {
+	m, _, ok := shouldLookInterface(data, keys...)
+	if !ok {
+		return nil
+	}
+
+	return m
+}
+
+// 用于解构的默认值: {a = 1}
+func defaultValue(v interface{}, d interface{}) interface{} {
+	if v == nil {
+		return d
+	}
+	return v
+}
+
+func lookInterfaceToSlice(data interface{}, key string) (desc []interface{}) {
+	m, _, ok := shouldLookInterface(data, key)
+	if !ok {
+		return nil
+	}
+
+	return interface2Slice(m)
+}
+
+// 扩展map, 实现作用域
+func extendMap(src map[string]interface{}, ext ...map[string]interface{}) (desc map[string]interface{}) {
+	desc = make(map[string]interface{}, len(src))
+	for k, v := range src {
+		desc[k] = v
+	}
+	for _, m := range ext {
+		for k, v := range m {
+			desc[k] = v
+		}
+	}
+	return desc
+}
+
+func interfaceToStr(s interface{}, escaped ...bool) (d string) {
+	switch a := s.(type) {
+	case nil:
+		return ""
+	case int, string, float64:
+		d = fmt.Sprintf("%v", a)
+	default:
+		bs, _ := json.Marshal(a)
+		d = string(bs)
+	}
+
+	if len(escaped) == 1 && escaped[0] {
+		d = escape(d)
+	}
+	return
+}
+
+// 有类型的值转为字符串, 用于声明了类型的props, 结果和interfaceToStr一样
+func intToStr(i int) string {
+	return strconv.Itoa(i)
+}
+
+func floatToStr(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// 字符串false,0 会被认定为false
+func interfaceToBool(s interface{}) (d bool) {
+	if s == nil {
+		return false
+	}
+	switch a := s.(type) {
+	case bool:
+		return a
+	case int, float64, float32, int8, int64, int32, int16:
+		return a != 0
+	case string:
+		return a != "" && a != "false" && a != "0"
+	default:
+		return true
+	}
+}
+
+func interfaceToFloat(s interface{}) (d float64) {
+	if s == nil {
+		return 0
+	}
+	switch a := s.(type) {
+	case int:
+		return float64(a)
+	case int32:
+		return float64(a)
+	case int64:
+		return float64(a)
+	case float64:
+		return a
+	case float32:
+		return float64(a)
+	default:
+		return 0
+	}
+}
+
+// 用来模拟js两个变量相加
+// 如果两个变量都是number, 则相加后也是number
+// 只有有一个不是number, 则都按字符串处理相加
+func interfaceAdd(a, b interface{}) interface{} {
+	an, ok := isNumber(a)
+	if !ok {
+		return interfaceToStr(a) + interfaceToStr(b)
+	}
+	bn, ok := isNumber(b)
+	if !ok {
+		return interfaceToStr(a) + interfaceToStr(b)
+	}
+
+	return an + bn
+}
+
+func interfaceLess(a, b interface{}) interface{} {
+	an, ok := isNumber(a)
+	if !ok {
+		return interfaceToStr(a) < interfaceToStr(b)
+	}
+	bn, ok := isNumber(b)
+	if !ok {
+		return interfaceToStr(a) < interfaceToStr(b)
+	}
+
+	return an < bn
+}
+
+func interfaceGreater(a, b interface{}) interface{} {
+	an, ok := isNumber(a)
+	if !ok {
+		return interfaceToStr(a) > interfaceToStr(b)
+	}
+	bn, ok := isNumber(b)
+	if !ok {
+		return interfaceToStr(a) > interfaceToStr(b)
+	}
+
+	return an > bn
+}
+
+func isNumber(s interface{}) (d float64, is bool) {
+	if s == nil {
+		return 0, false
+	}
+	switch a := s.(type) {
+	case int:
+		return float64(a), true
+	case int32:
+		return float64(a), true
+	case int64:
+		return float64(a), true
+	case float64:
+		return a, true
+	case float32:
+		return float64(a), true
+	default:
+		return 0, false
+	}
+}
+
+// 用于{{func(a)}}语法
+func interfaceToFunc(s interface{}) (d Function) {
+	if s == nil {
+		return emptyFunc
+	}
+
+	switch a := s.(type) {
+	case func(r *Render, options *Options, args ...interface{}) interface{}:
+		return a
+	case Function:
+		return a
+	default:
+		panic(a)
+	}
+}
+
+func interface2Slice(s interface{}) (d []interface{}) {
+	switch a := s.(type) {
+	case []interface{}:
+		return a
+	case []map[string]interface{}:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	case []int:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	case []int64:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	case []int32:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	case []string:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	case []float64:
+		d = make([]interface{}, len(a))
+		for i, v := range a {
+			d[i] = v
+		}
+	}
+	return
+}
+
+// shouldLookInterface会返回interface(map[string]interface{})中指定的keys路径的值
+func shouldLookInterface(data interface{}, keys ...string) (desc interface{}, rootExist bool, exist bool) {
+	if len(keys) == 0 {
+		return data, true, true
+	}
+
+	currKey := keys[0]
+
+	switch data := data.(type) {
+	case map[string]interface{}:
+		// 对象
+		c, ok := data[currKey]
+		if !ok {
+			return
+		}
+		rootExist = true
+		desc, _, exist = shouldLookInterface(c, keys[1:]...)
+		return
+
+	case []interface{}:
+		// 数组
+		switch currKey {
+		case "length":
+			// length
+			return len(data), true, true
+		default:
+			// index
+			index, ok := strconv.ParseInt(currKey, 10, 64)
+			if ok != nil {
+				return
+			}
+
+			if int(index) >= len(data) || index < 0 {
+				return
+			}
+			return shouldLookInterface(data[index], keys[1:]...)
+		}
+	case string:
+		switch currKey {
+		case "length":
+			// length
+			return len(data), true, true
+		default:
+		}
+	}
+
+	return
+}
+
+func escape(src string) string {
+	return html.EscapeString(src)
+}
@@ -0,0 +1,19 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/version"
+)
+
+// 运行时的版本, 与生成代码的go-vue-ssr版本相同
+const Version = version.Version
+
+// 检查生成代码时go-vue-ssr的版本, 不一致时返回错误.
+// 由生成的包中的CheckRuntimeVersion调用, 避免使用不兼容的运行时渲染出错误的结果.
+func CheckVersion(v string) error {
+	if v != Version {
+		return fmt.Errorf("code is generated by go-vue-ssr %s, but the runtime is %s, "+
+			"regenerate the code or use the same version of github.com/zbysir/go-vue-ssr", v, Version)
+	}
+	return nil
+}
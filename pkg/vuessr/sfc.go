@@ -0,0 +1,393 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"regexp"
+	"strings"
+)
+
+// 单文件组件(SFC), 由template与顶层的<script>/<style>块组成
+type SFC struct {
+	Template *VueElement
+	Blocks   []*SFCBlock
+}
+
+// 顶层块, 如<script>/<style scoped>
+type SFCBlock struct {
+	Tag     string            // script / style
+	Attrs   map[string]string // lang / scoped / module ...
+	Content string
+}
+
+func (b *SFCBlock) Has(attr string) bool {
+	_, ok := b.Attrs[attr]
+	return ok
+}
+
+// 获取所有tag的块
+func (s *SFC) GetBlocks(tag string) (bs []*SFCBlock) {
+	for _, b := range s.Blocks {
+		if b.Tag == tag {
+			bs = append(bs, b)
+		}
+	}
+	return
+}
+
+// 是否有<style scoped>
+func (s *SFC) Scoped() bool {
+	for _, b := range s.GetBlocks("style") {
+		if b.Has("scoped") {
+			return true
+		}
+	}
+	return false
+}
+
+// <style module>中的class, key是模块名字(默认是$style, 也可以使用<style module="classes">指定), value是class与重命名后的class
+func (s *SFC) CssModules(componentName string) map[string]map[string]string {
+	var ms map[string]map[string]string
+	for _, b := range s.GetBlocks("style") {
+		if !b.Has("module") {
+			continue
+		}
+		name := b.Attrs["module"]
+		if name == "" {
+			name = "$style"
+		}
+		if ms == nil {
+			ms = map[string]map[string]string{}
+		}
+		if ms[name] == nil {
+			ms[name] = map[string]string{}
+		}
+		_, classes := moduleCss(b.Content, componentName)
+		for _, c := range classes {
+			ms[name][c] = moduleClass(c, componentName)
+		}
+	}
+	return ms
+}
+
+// 组件所有<style>中的css, scoped的css会被添加组件的scopeId
+func (s *SFC) Css(componentName string) string {
+	var css []string
+	for _, b := range s.GetBlocks("style") {
+		c := strings.TrimSpace(b.Content)
+		if c == "" {
+			continue
+		}
+		if b.Has("module") {
+			c, _ = moduleCss(c, componentName)
+		}
+		if b.Has("scoped") {
+			c = scopeCss(c, scopeId(componentName))
+		}
+		css = append(css, c)
+	}
+	return strings.Join(css, "\n")
+}
+
+// 组件所有<script client>中的js, 会在<script-outlet>中输出
+func (s *SFC) ClientScript() string {
+	var js []string
+	for _, b := range s.GetBlocks("script") {
+		if !b.Has("client") {
+			continue
+		}
+		c := strings.TrimSpace(b.Content)
+		if c == "" {
+			continue
+		}
+		js = append(js, c)
+	}
+	return strings.Join(js, "\n")
+}
+
+// 组件在<script>中声明的选项, 写法和vue一样:
+//   <script>
+//   import ShopButton from './shop/button.vue'
+//   export default {
+//     components: {ShopButton: ShopButton},
+//     props: ['title', 'size'],
+//     inheritAttrs: false,
+//   }
+//   </script>
+type ComponentOptions struct {
+	// 声明的props, 为nil表示没有声明
+	// 声明了props的组件, 未声明的props会作为attr渲染在root节点上, 并且可以在$attrs中读取.
+	Props []PropDecl
+	// 为false时上层传递的attr都不会渲染在root节点上, 可以使用v-bind="$attrs"渲染在其他节点上
+	InheritAttrs bool
+	// 局部注册的组件, 名字 => .vue文件的路径(相对于当前文件), 只在这个组件中可以使用, 会覆盖同名的全局组件
+	Components map[string]string
+}
+
+// import ShopButton from './shop/button.vue'
+var importReg = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+([\w$]+)[ \t]+from[ \t]+['"]([^'"]+)['"][ \t]*;?[ \t]*$`)
+
+// 声明的prop, 写法和vue一样:
+//   props: {
+//     title: {type: String, required: true},
+//     size: {type: Number, default: 1, goType: 'int'},
+//     value: [String, Number],
+//   }
+type PropDecl struct {
+	Name string
+	// js中的类型: String / Number / Boolean / Array / Object / Function, 为空表示任意类型
+	Types    []string
+	Required bool
+	// 默认值, js代码, 为空表示没有默认值
+	Default string
+	// 生成的XxxProps结构体中的go类型, 默认根据Types推断
+	GoType string
+}
+
+// js类型对应的go类型
+var propGoTypes = map[string]string{
+	"String":   "string",
+	"Number":   "float64",
+	"Boolean":  "bool",
+	"Array":    "[]interface{}",
+	"Object":   "map[string]interface{}",
+	"Function": "Function",
+}
+
+// 在XxxProps结构体中的类型
+func (p PropDecl) FieldType() string {
+	if p.GoType != "" {
+		return p.GoType
+	}
+	if len(p.Types) == 1 {
+		if t, ok := propGoTypes[p.Types[0]]; ok {
+			return t
+		}
+	}
+	return "interface{}"
+}
+
+// 是否接受js类型t, 没有声明类型时接受任意类型
+func (p PropDecl) Accept(t string) bool {
+	if len(p.Types) == 0 {
+		return true
+	}
+	for _, i := range p.Types {
+		if i == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *ComponentOptions) PropNames() []string {
+	if o.Props == nil {
+		return nil
+	}
+	names := make([]string, len(o.Props))
+	for i, p := range o.Props {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// 解析<script>中的组件选项, 如果没有<script>块则返回nil
+func (s *SFC) ComponentOptions() (o *ComponentOptions, err error) {
+	var script *SFCBlock
+	for _, b := range s.GetBlocks("script") {
+		if b.Has("client") {
+			continue
+		}
+		if b.Attrs["lang"] == "" || b.Attrs["lang"] == "js" {
+			script = b
+			break
+		}
+	}
+	if script == nil {
+		return
+	}
+
+	// 取出import声明
+	imports := map[string]string{}
+	for _, m := range importReg.FindAllStringSubmatch(script.Content, -1) {
+		imports[m[1]] = m[2]
+	}
+	code := importReg.ReplaceAllString(script.Content, "")
+
+	code = strings.Trim(code, " \n\t\r;")
+	code = strings.TrimPrefix(code, "export default")
+	code = strings.Trim(code, " \n\t\r;")
+	if code == "" {
+		return
+	}
+
+	v, err := ast.ParseJsValue(code)
+	if err != nil {
+		return
+	}
+	if v.Kind != "object" {
+		err = fmt.Errorf("<script> should export an object, but: %s", v.Source)
+		return
+	}
+
+	o = &ComponentOptions{
+		InheritAttrs: true,
+	}
+
+	// props: ['a', 'b'] / props: {a: String, b: {type: Number}}
+	if props := v.Get("props"); props != nil {
+		o.Props = []PropDecl{}
+		switch props.Kind {
+		case "array":
+			for _, p := range props.Array {
+				name, ok := p.Value.(string)
+				if !ok {
+					err = fmt.Errorf("props should be string array, but: %s", props.Source)
+					return
+				}
+				o.Props = append(o.Props, PropDecl{Name: name})
+			}
+		case "object":
+			for _, k := range props.Keys {
+				var p PropDecl
+				p, err = parsePropDecl(k, props.Get(k))
+				if err != nil {
+					return
+				}
+				o.Props = append(o.Props, p)
+			}
+		default:
+			err = fmt.Errorf("props should be array or object, but: %s", props.Source)
+			return
+		}
+	}
+
+	// components: {ShopButton: ShopButton, 'x-button': './button.vue'}
+	if cs := v.Get("components"); cs != nil {
+		if cs.Kind != "object" {
+			err = fmt.Errorf("components should be object, but: %s", cs.Source)
+			return
+		}
+		o.Components = map[string]string{}
+		for _, k := range cs.Keys {
+			c := cs.Get(k)
+			switch c.Kind {
+			case "identifier":
+				path, ok := imports[c.Name]
+				if !ok {
+					err = fmt.Errorf("component '%s' is not imported", c.Name)
+					return
+				}
+				o.Components[k] = path
+			case "string":
+				o.Components[k] = c.Value.(string)
+			default:
+				err = fmt.Errorf("component '%s' should be an imported name or a path, but: %s", k, c.Source)
+				return
+			}
+		}
+	}
+
+	if ia := v.Get("inheritAttrs"); ia != nil {
+		b, ok := ia.Value.(bool)
+		if !ok {
+			err = fmt.Errorf("inheritAttrs should be bool, but: %s", ia.Source)
+			return
+		}
+		o.InheritAttrs = b
+	}
+
+	return
+}
+
+// title: String / title: [String, Number] / title: {type: String, default: '', required: true, goType: 'string'}
+func parsePropDecl(name string, v *ast.JsValue) (p PropDecl, err error) {
+	p.Name = name
+	typ := v
+	if v.Kind == "object" {
+		typ = v.Get("type")
+		if d := v.Get("default"); d != nil {
+			p.Default = d.Source
+		}
+		if r := v.Get("required"); r != nil {
+			b, ok := r.Value.(bool)
+			if !ok {
+				err = fmt.Errorf("required of prop '%s' should be bool, but: %s", name, r.Source)
+				return
+			}
+			p.Required = b
+		}
+		if g := v.Get("goType"); g != nil {
+			s, ok := g.Value.(string)
+			if !ok {
+				err = fmt.Errorf("goType of prop '%s' should be string, but: %s", name, g.Source)
+				return
+			}
+			p.GoType = s
+		}
+	}
+	if typ == nil || typ.Kind == "null" {
+		return
+	}
+
+	var types []*ast.JsValue
+	switch typ.Kind {
+	case "identifier":
+		types = []*ast.JsValue{typ}
+	case "array":
+		types = typ.Array
+	default:
+		err = fmt.Errorf("type of prop '%s' should be a constructor like String, but: %s", name, typ.Source)
+		return
+	}
+	for _, t := range types {
+		if t.Kind != "identifier" {
+			err = fmt.Errorf("type of prop '%s' should be a constructor like String, but: %s", name, t.Source)
+			return
+		}
+		p.Types = append(p.Types, t.Name)
+	}
+	return
+}
+
+func ParseSFC(filename string) (s *SFC, err error) {
+	return parseSFC(filename, parser.GoHtml{})
+}
+
+// 使用指定的空白与注释选项解析.vue文件
+func parseSFC(filename string, htmlParser parser.GoHtml) (s *SFC, err error) {
+	es, err := htmlParser.Parse(filename)
+	if err != nil {
+		return
+	}
+
+	s = &SFC{}
+
+	// 取出顶层的<script>/<style>块
+	var template []*parser.Element
+	for _, e := range es {
+		// 块之间的空白与注释
+		if e.NodeType == parser.CommentNode || e.NodeType == parser.TextNode && strings.TrimSpace(e.Text) == "" {
+			continue
+		}
+		if e.NodeType == parser.ElementNode && (e.TagName == "script" || e.TagName == "style") {
+			b := &SFCBlock{
+				Tag:   e.TagName,
+				Attrs: map[string]string{},
+			}
+			for _, a := range e.Attrs {
+				b.Attrs[a.Key] = a.Val
+			}
+			for _, c := range e.Children {
+				b.Content += c.Text
+			}
+			s.Blocks = append(s.Blocks, b)
+			continue
+		}
+		template = append(template, e)
+	}
+
+	s.Template, err = parseTemplate(template)
+	return
+}
@@ -0,0 +1,206 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/internal/version"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 共享运行时的包, 见Package.Runtime
+const runtimePackage = "github.com/zbysir/go-vue-ssr/pkg/vuessr/runtime"
+
+// 生成的包中的一个类型错误
+type typeError struct {
+	// 文件名, 如card.vue.go
+	File    string
+	Message string
+}
+
+// 使用go/types检查提交之后生成目录中的包: 生成目录中原有的.go文件, 加上这次写入的文件, 减去将被删除的文件.
+// go/format只能发现语法错误, 使用了不存在的变量或者类型错误的代码在go build时才会发现.
+// 无法导入依赖的包时(如生成目录不在go module中)返回err, 此时没有检查.
+// runtimeVersion是导入的共享运行时的版本, 没有使用共享运行时为空.
+func (s *staging) typeCheck() (errs []typeError, runtimeVersion string, err error) {
+	removed := map[string]bool{}
+	for _, path := range s.removes {
+		removed[filepath.Base(path)] = true
+	}
+	staged := map[string]bool{}
+	for _, name := range s.files {
+		staged[name] = true
+	}
+
+	var paths []string
+	for _, name := range s.files {
+		if strings.HasSuffix(name, ".go") {
+			paths = append(paths, filepath.Join(s.dir, name))
+		}
+	}
+	old, err := filepath.Glob(filepath.Join(s.desc, "*.go"))
+	if err != nil {
+		return
+	}
+	for _, path := range old {
+		name := filepath.Base(path)
+		if staged[name] || removed[name] || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		// 忽略build tags不满足的文件
+		if ok, _ := build.Default.MatchFile(s.desc, name); !ok {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			// 语法错误已经由go/format检查过, 这里只可能是用户自己的文件
+			errs = append(errs, typeError{File: filepath.Base(path), Message: err.Error()})
+			continue
+		}
+		files = append(files, f)
+	}
+
+	im := &checkImporter{dir: s.desc, fset: fset, pkgs: map[string]*types.Package{}}
+	conf := types.Config{
+		Importer: im,
+		Error: func(err error) {
+			e := err.(types.Error)
+			pos := e.Fset.Position(e.Pos)
+			name := filepath.Base(pos.Filename)
+			errs = append(errs, typeError{File: name, Message: fmt.Sprintf("%s:%d:%d: %s", name, pos.Line, pos.Column, e.Msg)})
+		},
+	}
+	if len(files) != 0 {
+		conf.Check(files[0].Name.Name, fset, files, nil)
+	}
+	if im.err != nil {
+		return nil, "", im.err
+	}
+	if p, ok := im.pkgs[runtimePackage]; ok {
+		if v, ok := p.Scope().Lookup("Version").(*types.Const); ok && v.Val().Kind() == constant.String {
+			runtimeVersion = constant.StringVal(v.Val())
+		}
+	}
+	return
+}
+
+// 检查生成的包, 类型错误作为编译错误报告: 生成的组件代码中的错误属于组件, 用户自己的文件中的错误只是警告.
+// vs是这次编译的所有组件.
+func (c *Compiler) typeCheck(s *staging, vs []VueFile) {
+	errs, runtimeVersion, err := s.typeCheck()
+	if err != nil {
+		c.Diagnostics = append(c.Diagnostics, Diagnostic{Level: DiagnosticWarning, File: s.desc, Message: fmt.Sprintf("type check skipped: %v", err)})
+		return
+	}
+	// 共享运行时的版本与go-vue-ssr不一致时生成的代码可能无法正确渲染, 这时的类型错误也没有意义, 只报告版本错误
+	if runtimeVersion != "" && runtimeVersion != version.Version {
+		c.Diagnostics = append(c.Diagnostics, Diagnostic{Level: DiagnosticError, File: filepath.Join(s.desc, "builtin.go"), Message: fmt.Sprintf(
+			"the shared runtime %s is %s, but go-vue-ssr is %s, use the same version of github.com/zbysir/go-vue-ssr in go.mod or regenerate the code with go-vue-ssr %s",
+			runtimePackage, runtimeVersion, version.Version, runtimeVersion)})
+		return
+	}
+
+	components := map[string]VueFile{}
+	for _, v := range vs {
+		components[v.ComponentName+".vue.go"] = v
+	}
+	staged := map[string]bool{}
+	for _, name := range s.files {
+		staged[name] = true
+	}
+	for _, e := range errs {
+		d := Diagnostic{Level: DiagnosticError, File: filepath.Join(s.desc, e.File), Message: "generated code is invalid: " + e.Message}
+		if v, ok := components[e.File]; ok {
+			d.File = v.Path
+			d.Component = v.ComponentName
+		} else if !staged[e.File] {
+			d.Level = DiagnosticWarning
+			d.Message = e.Message
+		}
+		c.Diagnostics = append(c.Diagnostics, d)
+	}
+}
+
+// 标准库不会改变, 所有检查共用一个从源码导入的importer
+var (
+	stdImporter   types.ImporterFrom
+	stdImporterMu sync.Mutex
+)
+
+// 标准库的包名的第一段没有"."
+func isStdPackage(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// 导入生成的包的依赖, 记录第一个无法导入的包.
+// 标准库使用共享的importer, 其他包(如共享运行时, 导入的组件库)在watch模式下可能改变, 每次检查都从源码重新检查.
+type checkImporter struct {
+	// 生成的文件在staging中, 从生成目录查找依赖
+	dir  string
+	fset *token.FileSet
+	pkgs map[string]*types.Package
+	err  error
+}
+
+func (i *checkImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, i.dir, 0)
+}
+
+func (i *checkImporter) ImportFrom(path, dir string, _ types.ImportMode) (p *types.Package, err error) {
+	defer func() {
+		if err != nil && i.err == nil {
+			i.err = err
+		}
+	}()
+	if dir == "" || strings.HasPrefix(filepath.Base(dir), stagingPrefix) {
+		dir = i.dir
+	}
+
+	if isStdPackage(path) {
+		stdImporterMu.Lock()
+		defer stdImporterMu.Unlock()
+		if stdImporter == nil {
+			stdImporter = importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+		}
+		return stdImporter.ImportFrom(path, dir, 0)
+	}
+
+	if p, ok := i.pkgs[path]; ok {
+		return p, nil
+	}
+	// 在生成目录所在的module中查找依赖, 而不是当前目录
+	ctxt := build.Default
+	ctxt.Dir = i.dir
+	bp, err := ctxt.Import(path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(i.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: i}
+	p, err = conf.Check(bp.ImportPath, i.fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+	i.pkgs[path] = p
+	return p, nil
+}
@@ -0,0 +1,149 @@
+package vuessr
+
+import (
+	"fmt"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/ast"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 可以转为有类型变量的go类型与转换代码
+var typedVarConverters = map[string]string{
+	"string":  "interfaceToStr(%s)",
+	"bool":    "interfaceToBool(%s)",
+	"float64": "interfaceToFloat(%s)",
+	"int":     "int(interfaceToFloat(%s))",
+}
+
+var identReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 有类型变量在生成代码中的前缀, 如xp_title
+const typedVarPrefix = "xp_"
+
+// 生成代码中的有类型变量
+var typedVarReg = regexp.MustCompile(`\b` + typedVarPrefix + `[A-Za-z0-9_]+\b`)
+
+// 组件中有类型的变量: 声明了类型, 并且是required或者有默认值(一定有值)的prop.
+// 没有值的prop在模板中是undefined, 转为有类型的变量后会变为零值(如0), 所以不处理.
+func typedVars(o *ComponentOptions) map[string]ast.TypedVar {
+	if o == nil {
+		return nil
+	}
+	vars := map[string]ast.TypedVar{}
+	for _, p := range o.Props {
+		if !p.Required && p.Default == "" {
+			continue
+		}
+		typ := p.FieldType()
+		if _, ok := typedVarConverters[typ]; !ok || !identReg.MatchString(p.Name) {
+			continue
+		}
+		vars[p.Name] = ast.TypedVar{Code: typedVarPrefix + p.Name, Type: typ}
+	}
+	return vars
+}
+
+// 生成代码中使用到的有类型变量的声明, 在组件开始时从scope中读取:
+//   xp_title := interfaceToStr(scope.Get("title"))
+func typedVarsCode(vars map[string]ast.TypedVar, code string) string {
+	used := map[string]bool{}
+	for _, v := range typedVarReg.FindAllString(code, -1) {
+		used[v] = true
+	}
+	var names []string
+	for name, v := range vars {
+		if used[v.Code] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		v := vars[name]
+		get := fmt.Sprintf(`%s.Get(%q)`, ScopeKey, name)
+		b.WriteString(fmt.Sprintf("%s := %s\n_ = %s\n", v.Code, fmt.Sprintf(typedVarConverters[v.Type], get), v.Code))
+	}
+	return b.String()
+}
+
+// 翻译js表达式, 没有被覆盖的有类型变量会直接使用, 语法错误与类型错误会记录在Diagnostics中
+func (c *Compiler) js2Go(js string) (code string, typ string) {
+	ctx := &ast.Context{ScopeKey: ScopeKey, Vars: c.visibleVars()}
+	code, typ, err := ast.Js2GoTyped(js, ctx)
+	if err != nil {
+		c.errorf("invalid expression %q: %v", js, err)
+		return "nil", ""
+	}
+	for _, e := range ctx.Errors {
+		c.errorf("%s", e)
+	}
+	return
+}
+
+func (c *Compiler) visibleVars() map[string]ast.TypedVar {
+	if len(c.shadowed) == 0 {
+		return c.vars
+	}
+	vars := map[string]ast.TypedVar{}
+	for name, v := range c.vars {
+		if c.shadowed[name] == 0 {
+			vars[name] = v
+		}
+	}
+	return vars
+}
+
+// 进入(delta=1)或离开(delta=-1)声明了变量的节点
+func (c *Compiler) shadow(names []string, delta int) {
+	if len(names) == 0 {
+		return
+	}
+	if c.shadowed == nil {
+		c.shadowed = map[string]int{}
+	}
+	for _, n := range names {
+		c.shadowed[n] += delta
+		if c.shadowed[n] <= 0 {
+			delete(c.shadowed, n)
+		}
+	}
+}
+
+// 节点通过v-for/v-let/v-slot声明的变量
+func declaredNames(e *VueElement) (names []string) {
+	if e.VFor != nil {
+		names = append(names, e.VFor.ItemKey, e.VFor.IndexKey)
+	}
+	for _, l := range e.VLet {
+		if l.Name != "" {
+			names = append(names, l.Name)
+		}
+		for _, f := range l.Fields {
+			names = append(names, f.Name)
+		}
+	}
+	if e.VSlot != nil {
+		if e.VSlot.PropsKey != "" {
+			names = append(names, e.VSlot.PropsKey)
+		}
+		for _, f := range e.VSlot.Fields {
+			names = append(names, f.Name)
+		}
+	}
+	return
+}
+
+// js类型对应的go类型, 用于检查传递给组件的prop
+func jsTypeOfGo(typ string) string {
+	switch {
+	case typ == "string":
+		return "String"
+	case typ == "bool":
+		return "Boolean"
+	case ast.IsNumeric(typ):
+		return "Number"
+	}
+	return ""
+}
@@ -1,7 +1,11 @@
 package vuessr
 
 import (
+	"fmt"
 	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"html"
+	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -35,6 +39,99 @@ type VueElement struct {
 	VHtml string
 	VText string
 	VOn   []VOnDirective // v-on与普通自定义指令不同，其中表达式不会去调用方法，而是存储调用的方法和args然后生成js代码
+	// v-provide:key="value", 提供给所有子孙节点, 在模板中使用inject('key')读取
+	Provide Props
+	// v-let:name="value" / v-let="{a, b} = value", 为节点与子节点声明变量
+	VLet []VLet
+	// v-pre节点原样输出的html, 不会处理其中的指令与{{}}
+	VPre string
+	// 节点在.vue文件中的行号, 用于在编译错误中显示位置
+	Line int
+	// v-once, 只渲染一次, 之后使用缓存的html
+	VOnce bool
+	// v-model="form.email", 服务端渲染表单的值
+	VModel *VModel
+	// <select v-model>下的<option>, 将会根据select的v-model生成selected
+	VModelSelect *VModel
+}
+
+// v-model.trim.number="value"
+type VModel struct {
+	Value     string // js表达式
+	Modifiers []string
+}
+
+func (v *VModel) HasModifier(m string) bool {
+	for _, i := range v.Modifiers {
+		if i == m {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(e *parser.Element, key string) bool {
+	for _, a := range e.Attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成v-pre节点的html, 子孙节点的指令与{{}}都会原样输出
+func renderVerbatim(e *parser.Element, rawText bool) string {
+	switch e.NodeType {
+	case parser.TextNode:
+		// script/style中的文本不需要转义
+		if rawText {
+			return e.Text
+		}
+		return html.EscapeString(e.Text)
+	case parser.ElementNode:
+	default:
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + e.TagName)
+	for _, a := range e.Attrs {
+		if a.Key == "v-pre" {
+			continue
+		}
+		key := a.Key
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + a.Key
+		}
+		b.WriteString(" " + key)
+		if a.Val != "" {
+			b.WriteString(`="` + html.EscapeString(a.Val) + `"`)
+		}
+	}
+	if voidElements[e.TagName] {
+		b.WriteString("/>")
+		return b.String()
+	}
+	b.WriteString(">")
+	for _, c := range e.Children {
+		b.WriteString(renderVerbatim(c, e.TagName == "script" || e.TagName == "style"))
+	}
+	b.WriteString("</" + e.TagName + ">")
+	return b.String()
+}
+
+// 标记select下所有的option (包括optgroup下的)
+func markVModelOption(es []*VueElement, m *VModel) {
+	for _, e := range es {
+		if e.NodeType != parser.ElementNode {
+			continue
+		}
+		if e.TagName == "option" {
+			e.VModelSelect = m
+			continue
+		}
+		markVModelOption(e.Children, m)
+	}
 }
 
 type Attribute struct {
@@ -42,9 +139,11 @@ type Attribute struct {
 }
 
 type Directive struct {
-	Name  string // v-animate
-	Value string // {'a': 1}
-	Arg   string // v-set:arg
+	Name       string   // v-animate
+	Value      string   // {'a': 1}
+	Arg        string   // v-set:arg, 动态参数时是js表达式
+	DynamicArg bool     // v-set:[arg]
+	Modifiers  []string // v-set:arg.lazy
 }
 
 // v-on:click="buttonClick(args1, args2)" // 方法（参数） 支持：在这种类型上，所有的参数都是读取props值。
@@ -52,10 +151,91 @@ type Directive struct {
 //  如a+1中我们无法得知a到底是读取props(翻译成go代码)还是使用全局的js变量（不翻译）。
 // v-on:click="a=a+1" // 表达式 不支持：同上
 type VOnDirective struct {
-	Func  string // buttonClick
-	Args  string // args1, args2, 将被翻译成go。
-	Exp   string // 原始表达式: buttonClick(args1, args2)
-	Event string // click
+	Func         string   // buttonClick
+	Args         string   // args1, args2, 将被翻译成go。
+	Exp          string   // 原始表达式: buttonClick(args1, args2)
+	Event        string   // click, 动态事件名时是js表达式
+	DynamicEvent bool     // @[event]
+	Modifiers    []string // @click.prevent.stop
+}
+
+// 指令attr的语法: v-name:arg.modifier1.modifier2 / v-name:[dynamicArg].modifier
+// 以及缩写 :arg / @arg / #arg
+type AttrKey struct {
+	Name       string   // 指令名字, 如v-bind/v-on/v-slot/v-if; 不是指令时为空
+	Arg        string   // 参数, 动态参数时是js表达式
+	DynamicArg bool     // v-bind:[key]
+	Modifiers  []string // .camel.prop
+}
+
+func (a AttrKey) HasModifier(m string) bool {
+	for _, i := range a.Modifiers {
+		if i == m {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析attr的key
+func parseAttrKey(key string) (a AttrKey) {
+	var rest string
+	hasArg := false
+	switch {
+	case strings.HasPrefix(key, ":"):
+		a.Name = "v-bind"
+		rest = key[1:]
+		hasArg = true
+	case strings.HasPrefix(key, "@"):
+		a.Name = "v-on"
+		rest = key[1:]
+		hasArg = true
+	case strings.HasPrefix(key, "#"):
+		a.Name = "v-slot"
+		rest = key[1:]
+		hasArg = true
+	case strings.HasPrefix(key, "v-"):
+		i := strings.IndexAny(key, ":.")
+		if i == -1 {
+			a.Name = key
+			return
+		}
+		a.Name = key[:i]
+		if key[i] == ':' {
+			rest = key[i+1:]
+			hasArg = true
+		} else {
+			rest = key[i:]
+		}
+	default:
+		return
+	}
+
+	if hasArg {
+		if strings.HasPrefix(rest, "[") {
+			// 动态参数中可能有. 如:[item.key], 所以需要找到匹配的]
+			end := matchBracket(rest, 0)
+			if end == -1 {
+				panic(fmt.Sprintf("bad dynamic argument: %s", key))
+			}
+			a.Arg = strings.Trim(rest[1:end], " ")
+			a.DynamicArg = true
+			rest = rest[end+1:]
+		} else if i := strings.Index(rest, "."); i != -1 {
+			a.Arg = rest[:i]
+			rest = rest[i:]
+		} else {
+			a.Arg = rest
+			rest = ""
+		}
+	}
+
+	for _, m := range strings.Split(rest, ".") {
+		if m != "" {
+			a.Modifiers = append(a.Modifiers, m)
+		}
+	}
+	return
 }
 
 type ElseIf struct {
@@ -79,9 +259,198 @@ type VFor struct {
 	IndexKey string
 }
 
+// v-let声明的变量
+// v-let:name="value" 声明一个变量name
+// v-let="{a, b: c, d = 1} = value" 使用解构写法声明多个变量
+type VLet struct {
+	Name   string             // 变量名, 解构写法时为空
+	Fields []DestructureField // 解构的变量
+	Value  string             // js表达式
+}
+
+// 解构写法中的一个变量
+// 如{a, b: c, d = 1}中的b: c, Key是b, Name是c
+type DestructureField struct {
+	Key     string // 读取的key, 数组解构时是下标
+	Name    string // 声明的变量名
+	Default string // 默认值的js表达式, 当值为nil时使用
+}
+
+// 解析v-let="{a, b} = value"
+func parseVLet(val string) (l VLet, err error) {
+	val = strings.Trim(val, " ")
+	if val == "" || (val[0] != '{' && val[0] != '[') {
+		err = fmt.Errorf("v-let value should be like '{a, b} = value', but: %s", val)
+		return
+	}
+	end := matchBracket(val, 0)
+	if end == -1 {
+		err = fmt.Errorf("unclosed bracket in v-let: %s", val)
+		return
+	}
+	right := strings.Trim(val[end+1:], " ")
+	if !strings.HasPrefix(right, "=") {
+		err = fmt.Errorf("v-let value should be like '{a, b} = value', but: %s", val)
+		return
+	}
+
+	fields, err := parseDestructure(val[:end+1])
+	if err != nil {
+		return
+	}
+
+	l = VLet{
+		Fields: fields,
+		Value:  strings.Trim(right[1:], " "),
+	}
+	return
+}
+
+// 解析解构写法, 支持对象{a, b: c, d = 1}与数组[a, b = 1]
+func parseDestructure(pattern string) (fields []DestructureField, err error) {
+	pattern = strings.Trim(pattern, " ")
+	if len(pattern) < 2 {
+		err = fmt.Errorf("bad destructuring pattern: %s", pattern)
+		return
+	}
+	isArray := pattern[0] == '['
+	if !(pattern[0] == '{' && pattern[len(pattern)-1] == '}') && !(isArray && pattern[len(pattern)-1] == ']') {
+		err = fmt.Errorf("bad destructuring pattern: %s", pattern)
+		return
+	}
+
+	for i, item := range splitTopLevel(pattern[1:len(pattern)-1], ',') {
+		item = strings.Trim(item, " \n\t")
+		if item == "" {
+			continue
+		}
+
+		var f DestructureField
+		// d = 1
+		if eq := strings.Index(item, "="); eq != -1 {
+			f.Default = strings.Trim(item[eq+1:], " ")
+			item = strings.Trim(item[:eq], " ")
+		}
+
+		if isArray {
+			f.Key = strconv.Itoa(i)
+			f.Name = item
+		} else if colon := strings.Index(item, ":"); colon != -1 {
+			// b: c
+			f.Key = strings.Trim(item[:colon], " '\"")
+			f.Name = strings.Trim(item[colon+1:], " ")
+		} else {
+			f.Key = item
+			f.Name = item
+		}
+
+		if f.Name == "" || strings.ContainsAny(f.Name, "{}[]()") {
+			err = fmt.Errorf("nested destructuring is not supported: %s", pattern)
+			return
+		}
+		fields = append(fields, f)
+	}
+
+	return
+}
+
+// 找到与start处的括号匹配的括号位置, 会跳过字符串中的括号
+func matchBracket(s string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// 使用sep分割字符串, 会跳过括号与字符串中的sep
+func splitTopLevel(s string, sep byte) (ss []string) {
+	depth := 0
+	var quote byte
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				ss = append(ss, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	ss = append(ss, s[last:])
+	return
+}
+
 type VSlot struct {
-	SlotName string
-	PropsKey string
+	SlotName string             // 插槽名字, 如果是动态插槽名则是js表达式
+	Dynamic  bool               // 动态插槽名: #[name]
+	PropsKey string             // v-slot:name="slotProps"
+	Fields   []DestructureField // v-slot:name="{ item, index }"
+}
+
+// 解析v-slot, name为空则是默认插槽
+func parseVSlot(name string, val string) *VSlot {
+	s := &VSlot{
+		SlotName: name,
+	}
+	if name == "" {
+		s.SlotName = "default"
+	} else if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		s.Dynamic = true
+		s.SlotName = name[1 : len(name)-1]
+	}
+
+	val = strings.Trim(val, " ")
+	if strings.HasPrefix(val, "{") || strings.HasPrefix(val, "[") {
+		fields, err := parseDestructure(val)
+		if err != nil {
+			panic(err)
+		}
+		s.Fields = fields
+	} else {
+		// 不应该为空, 否则可能会导致生成的go代码有误
+		if val == "" {
+			val = "slotProps"
+		}
+		s.PropsKey = val
+	}
+
+	return s
 }
 
 func (p Props) Omit(key ...string) Props {
@@ -100,15 +469,27 @@ func (p Props) Omit(key ...string) Props {
 	return a
 }
 
+// 解析.vue文件中的template
 func ParseVue(filename string) (v *VueElement, err error) {
-	htmlParser := parser.GoHtml{}
-
-	es, err := htmlParser.Parse(filename)
+	s, err := ParseSFC(filename)
 	if err != nil {
 		return
 	}
+	return s.Template, nil
+}
+
+// 解析模板, 模板中的错误(如v-else之前没有v-if)会作为带行号的err返回
+func parseTemplate(es []*parser.Element) (v *VueElement, err error) {
+	p := &VueElementParser{}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			err = &templateError{Line: p.line, Message: fmt.Sprint(r)}
+		}
+	}()
 
-	p := VueElementParser{}
 	if len(es) == 1 {
 		v = p.Parse(es[0])
 
@@ -132,21 +513,47 @@ func ParseVue(filename string) (v *VueElement, err error) {
 	return
 }
 
+// 模板中的错误, 如v-else之前没有v-if
+type templateError struct {
+	Line    int
+	Message string
+}
+
+func (e *templateError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// 模板中的错误会panic, 由parseTemplate转为templateError
 type VueElementParser struct {
+	// 正在解析的节点的行号
+	line int
 }
 
-func (p VueElementParser) Parse(e *parser.Element) *VueElement {
+func (p *VueElementParser) Parse(e *parser.Element) *VueElement {
 	vs := p.parseList([]*parser.Element{e})
 	return vs[0]
 }
 
 // 递归处理同级节点
 // 使用数组有一个好处就是方便的处理串联的v-if
-func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
+func (p *VueElementParser) parseList(es []*parser.Element) []*VueElement {
 	vs := make([]*VueElement, len(es))
 
 	var ifVueEle *VueElement
 	for i, e := range es {
+		p.line = e.Line
+		// v-pre: 节点与子孙节点都不会被编译
+		if e.NodeType == parser.ElementNode && hasAttr(e, "v-pre") {
+			vs[i] = &VueElement{
+				NodeType: e.NodeType,
+				TagName:  e.TagName,
+				VPre:     renderVerbatim(e, false),
+				Line:     e.Line,
+			}
+			ifVueEle = nil
+			continue
+		}
+
 		var props []Prop
 		var ds []Directive
 		var vOn []VOnDirective
@@ -164,24 +571,49 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 
 		var vHtml string
 		var vText string
+		var provide Props
+		var vLet []VLet
+		var vModel *VModel
+		var vOnce bool
 
 		for _, attr := range e.Attrs {
-			oriKey := attr.Key
-			ss := strings.Split(oriKey, ":")
-			nameSpace := "-"
-			key := oriKey
-			if len(ss) == 2 {
-				key = ss[1]
-				nameSpace = ss[0]
-			}
+			k := parseAttrKey(attr.Key)
 
-			if nameSpace == "v-bind" || nameSpace == "" {
+			if k.Name == "v-bind" {
 				// v-bind & shorthands :
+				if k.Arg == "" && !k.DynamicArg {
+					// v-bind="obj", 展开对象
+					props = append(props, Prop{
+						Val:    strings.Trim(attr.Val, " "),
+						Spread: true,
+					})
+					continue
+				}
+
+				key := k.Arg
+				if k.HasModifier("camel") && !k.DynamicArg {
+					key = sheXing2TuoFeng(key)
+				}
+
+				// .prop: 绑定dom属性, 服务端渲染只支持innerHTML/textContent, 其他dom属性没有对应的html
+				// tip: html解析器会将attr转为小写
+				if k.HasModifier("prop") {
+					switch strings.ToLower(key) {
+					case "innerhtml":
+						vHtml = strings.Trim(attr.Val, " ")
+					case "textcontent", "innertext":
+						vText = strings.Trim(attr.Val, " ")
+					}
+					continue
+				}
+
 				props = append(props, Prop{
-					Key: key,
-					Val: attr.Val,
+					Key:     key,
+					Val:     attr.Val,
+					Dynamic: k.DynamicArg,
+					Attr:    k.HasModifier("attr"),
 				})
-			} else if strings.HasPrefix(oriKey, "@") || nameSpace == "v-on" {
+			} else if k.Name == "v-on" {
 				// v-on & shorthands @
 				// v-on和普通的指令不同, 它的值是一个方法, 并且是js方法, 所以在模板中无法计算或者存储该值, 只能换一个方法: 存储为对象{event, funcName}, 让js代码再去调用.
 				end := strings.LastIndex(attr.Val, ")")
@@ -191,33 +623,41 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 					args := attr.Val[start+1 : end]
 					fun := attr.Val[:start]
 
-					event := strings.TrimPrefix(key, "@")
-
 					vOn = append(vOn, VOnDirective{
-						Func:  fun,
-						Args:  args,
-						Event: event,
-						Exp:   attr.Val,
+						Func:         fun,
+						Args:         args,
+						Event:        k.Arg,
+						DynamicEvent: k.DynamicArg,
+						Modifiers:    k.Modifiers,
+						Exp:          attr.Val,
 					})
 				} else {
 					// func
-					event := strings.TrimPrefix(key, "@")
 					vOn = append(vOn, VOnDirective{
-						Func:  attr.Val,
-						Args:  "",
-						Event: event,
-						Exp:   attr.Val,
+						Func:         attr.Val,
+						Args:         "",
+						Event:        k.Arg,
+						DynamicEvent: k.DynamicArg,
+						Modifiers:    k.Modifiers,
+						Exp:          attr.Val,
 					})
 				}
-			} else if strings.HasPrefix(oriKey, "v-") {
+			} else if k.Name == "v-slot" {
+				// v-slot:name="slotProps" / #header / #[name]
+				// v-slot="{ item, index }" 默认插槽
+				slotName := k.Arg
+				if k.DynamicArg {
+					slotName = "[" + slotName + "]"
+				}
+				vSlot = parseVSlot(slotName, attr.Val)
+			} else if k.Name != "" {
 				// 指令
 				// v-if=""
-				// v-slot:name=""
 				// v-else-if=""
 				// v-else
 				// v-html
 				switch {
-				case key == "v-for":
+				case k.Name == "v-for":
 					val := attr.Val
 
 					ss := strings.Split(val, " in ")
@@ -244,50 +684,56 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 						ItemKey:  itemKey,
 						IndexKey: indexKey,
 					}
-				case key == "v-if":
+				case k.Name == "v-if":
 					vIf = &VIf{
 						Condition: strings.Trim(attr.Val, " "),
 						ElseIf:    nil,
 					}
-				case nameSpace == "v-slot":
-					slotName := key
-					propsKey := attr.Val
-					// 不应该为空, 否则可能会导致生成的go代码有误
-					if propsKey == "" {
-						propsKey = "slotProps"
-					}
-					vSlot = &VSlot{
-						SlotName: slotName,
-						PropsKey: propsKey,
-					}
-				case key == "v-else-if":
+				case k.Name == "v-else-if":
 					vElseIf = &ElseIf{
 						Types:     "elseif",
 						Condition: strings.Trim(attr.Val, " "),
 					}
-				case key == "v-else":
+				case k.Name == "v-else":
 					vElse = &ElseIf{
 						Types:     "else",
 						Condition: strings.Trim(attr.Val, " "),
 					}
-				case key == "v-html":
+				case k.Name == "v-provide" && k.Arg != "":
+					provide = append(provide, Prop{
+						Key: k.Arg,
+						Val: strings.Trim(attr.Val, " "),
+					})
+				case k.Name == "v-let" && k.Arg != "":
+					vLet = append(vLet, VLet{
+						Name:  k.Arg,
+						Value: strings.Trim(attr.Val, " "),
+					})
+				case k.Name == "v-let":
+					l, err := parseVLet(attr.Val)
+					if err != nil {
+						panic(err)
+					}
+					vLet = append(vLet, l)
+				case k.Name == "v-model":
+					vModel = &VModel{
+						Value:     strings.Trim(attr.Val, " "),
+						Modifiers: k.Modifiers,
+					}
+				case k.Name == "v-once":
+					vOnce = true
+				case k.Name == "v-html":
 					vHtml = strings.Trim(attr.Val, " ")
-				case key == "v-text":
+				case k.Name == "v-text":
 					vText = strings.Trim(attr.Val, " ")
 				default:
 					// 自定义指令
-					var name string
-					var arg string
-					if nameSpace != "-" {
-						name = nameSpace
-						arg = key
-					} else {
-						name = key
-					}
 					ds = append(ds, Directive{
-						Name:  name,
-						Value: strings.Trim(attr.Val, " "),
-						Arg:   arg,
+						Name:       k.Name,
+						Value:      strings.Trim(attr.Val, " "),
+						Arg:        k.Arg,
+						DynamicArg: k.DynamicArg,
+						Modifiers:  k.Modifiers,
 					})
 				}
 			} else if attr.Key == "class" {
@@ -323,9 +769,11 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 		}
 
 		ch := p.parseList(e.Children)
+		p.line = e.Line
 
 		v := &VueElement{
 			IsRoot:           false,
+			Line:             e.Line,
 			NodeType:         e.NodeType,
 			TagName:          e.TagName,
 			Text:             e.Text,
@@ -346,6 +794,14 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 			VHtml:            vHtml,
 			VText:            vText,
 			VOn:              vOn,
+			Provide:          provide,
+			VLet:             vLet,
+			VModel:           vModel,
+			VOnce:            vOnce,
+		}
+
+		if vModel != nil && e.TagName == "select" {
+			markVModelOption(ch, vModel)
 		}
 
 		// 记录vif, 接下来的elseif将与这个节点关联
@@ -353,7 +809,7 @@ func (p VueElementParser) parseList(es []*parser.Element) []*VueElement {
 			ifVueEle = v
 		} else {
 			// 如果有vif环境了, 但是中间跳过了, 则需要取消掉vif环境 (v-else 必须与v-if 相邻)
-			skipNode := e.NodeType == parser.CommentNode
+			skipNode := e.NodeType == parser.CommentNode || e.NodeType == parser.TextNode && strings.TrimSpace(e.Text) == ""
 			if !skipNode && vElse == nil && vElseIf == nil {
 				ifVueEle = nil
 			}
@@ -2,6 +2,9 @@ package vuessr
 
 import (
 	"encoding/json"
+	"github.com/zbysir/go-vue-ssr/internal/pkg/html"
+	"github.com/zbysir/go-vue-ssr/pkg/vuessr/parser"
+	"reflect"
 	"testing"
 )
 
@@ -14,3 +17,167 @@ func TestParseVue(t *testing.T) {
 	bs, _ := json.MarshalIndent(e, " ", " ")
 	t.Logf("%s", bs)
 }
+
+func TestParseVLet(t *testing.T) {
+	l, err := parseVLet(`{a, b: c, d = f(1, 2)} = user.info`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DestructureField{
+		{Key: "a", Name: "a"},
+		{Key: "b", Name: "c"},
+		{Key: "d", Name: "d", Default: "f(1, 2)"},
+	}
+	if l.Value != "user.info" || !reflect.DeepEqual(l.Fields, want) {
+		t.Fatalf("%+v", l)
+	}
+
+	fields, err := parseDestructure(`[first, second = 'none']`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []DestructureField{
+		{Key: "0", Name: "first"},
+		{Key: "1", Name: "second", Default: "'none'"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("%+v", fields)
+	}
+
+	if _, err := parseVLet(`a = 1`); err == nil {
+		t.Fatal("want err")
+	}
+}
+
+func TestParseVSlot(t *testing.T) {
+	cases := []struct {
+		name, val string
+		want      VSlot
+	}{
+		{"", "", VSlot{SlotName: "default", PropsKey: "slotProps"}},
+		{"header", "props", VSlot{SlotName: "header", PropsKey: "props"}},
+		{"default", "{ row, index: i }", VSlot{SlotName: "default", Fields: []DestructureField{{Key: "row", Name: "row"}, {Key: "index", Name: "i"}}}},
+		{"[name]", "", VSlot{SlotName: "name", Dynamic: true, PropsKey: "slotProps"}},
+	}
+
+	for _, c := range cases {
+		s := parseVSlot(c.name, c.val)
+		if !reflect.DeepEqual(*s, c.want) {
+			t.Fatalf("%s=%s: %+v", c.name, c.val, s)
+		}
+	}
+}
+
+func TestComponentOptions(t *testing.T) {
+	s := &SFC{Blocks: []*SFCBlock{{
+		Tag:     "script",
+		Attrs:   map[string]string{},
+		Content: "\nexport default {\n  props: {title: String, size: {type: Number}},\n  inheritAttrs: false,\n}\n",
+	}}}
+	o, err := s.ComponentOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.PropNames(), []string{"title", "size"}) || o.InheritAttrs {
+		t.Fatalf("%+v", o)
+	}
+
+	// 类型, 默认值与required
+	s = &SFC{Blocks: []*SFCBlock{{
+		Tag:     "script",
+		Attrs:   map[string]string{},
+		Content: "export default {props: {title: {type: String, required: true}, size: {type: Number, default: 1, goType: 'int'}, value: [String, Number], any: null}}",
+	}}}
+	o, err = s.ComponentOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PropDecl{
+		{Name: "title", Types: []string{"String"}, Required: true},
+		{Name: "size", Types: []string{"Number"}, Default: "1", GoType: "int"},
+		{Name: "value", Types: []string{"String", "Number"}},
+		{Name: "any"},
+	}
+	if !reflect.DeepEqual(o.Props, want) {
+		t.Fatalf("%+v", o.Props)
+	}
+	if o.Props[0].FieldType() != "string" || o.Props[1].FieldType() != "int" || o.Props[2].FieldType() != "interface{}" {
+		t.Fatalf("%+v", o.Props)
+	}
+
+	// 没有<script>
+	o, err = (&SFC{}).ComponentOptions()
+	if err != nil || o != nil {
+		t.Fatal(o, err)
+	}
+
+	// <script client>不是组件选项
+	s = &SFC{Blocks: []*SFCBlock{{
+		Tag:     "script",
+		Attrs:   map[string]string{"client": ""},
+		Content: "\nconsole.log(data)\n",
+	}}}
+	o, err = s.ComponentOptions()
+	if err != nil || o != nil {
+		t.Fatal(o, err)
+	}
+	if js := s.ClientScript(); js != "console.log(data)" {
+		t.Fatal(js)
+	}
+
+	// 局部注册的组件
+	s = &SFC{Blocks: []*SFCBlock{{
+		Tag:     "script",
+		Attrs:   map[string]string{},
+		Content: "\nimport ShopButton from './shop/button.vue';\nexport default {components: {ShopButton: ShopButton, 'x-btn': '../btn.vue'}}\n",
+	}}}
+	o, err = s.ComponentOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.Components, map[string]string{"ShopButton": "./shop/button.vue", "x-btn": "../btn.vue"}) {
+		t.Fatal(o.Components)
+	}
+	s.Blocks[0].Content = "export default {components: {ShopButton: ShopButton}}"
+	if _, err = s.ComponentOptions(); err == nil {
+		t.Fatal("should be not imported")
+	}
+}
+
+func TestParseAttrKey(t *testing.T) {
+	cases := []struct {
+		key  string
+		want AttrKey
+	}{
+		{"class", AttrKey{}},
+		{":title", AttrKey{Name: "v-bind", Arg: "title"}},
+		{":[attrname]", AttrKey{Name: "v-bind", Arg: "attrname", DynamicArg: true}},
+		{":view-box.camel", AttrKey{Name: "v-bind", Arg: "view-box", Modifiers: []string{"camel"}}},
+		{"v-bind", AttrKey{Name: "v-bind"}},
+		{"v-tooltip:[item.placement].lazy", AttrKey{Name: "v-tooltip", Arg: "item.placement", DynamicArg: true, Modifiers: []string{"lazy"}}},
+		{"@click.prevent.stop", AttrKey{Name: "v-on", Arg: "click", Modifiers: []string{"prevent", "stop"}}},
+		{"v-on:update:value", AttrKey{Name: "v-on", Arg: "update:value"}},
+		{"v-focus.once", AttrKey{Name: "v-focus", Modifiers: []string{"once"}}},
+		{"#[name]", AttrKey{Name: "v-slot", Arg: "name", DynamicArg: true}},
+	}
+
+	for _, c := range cases {
+		if k := parseAttrKey(c.key); !reflect.DeepEqual(k, c.want) {
+			t.Fatalf("%s want: %+v but: %+v", c.key, c.want, k)
+		}
+	}
+}
+
+func TestParseVPre(t *testing.T) {
+	e := &parser.Element{
+		NodeType: parser.ElementNode,
+		TagName:  "code",
+		Attrs:    []html.Attribute{{Key: "v-pre"}, {Key: ":id", Val: "x"}},
+		Children: []*parser.Element{{NodeType: parser.TextNode, Text: "{{ msg }} <b>"}},
+	}
+	v := (&VueElementParser{}).Parse(e)
+	want := `<code :id="x">{{ msg }} &lt;b&gt;</code>`
+	if v.VPre != want {
+		t.Fatalf("want:%s but:%s", want, v.VPre)
+	}
+}
@@ -0,0 +1,284 @@
+package vuessr
+
+import (
+	"context"
+	"fmt"
+	"github.com/radovskyb/watcher"
+	"github.com/zbysir/go-vue-ssr/internal/pkg/log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 监听模式的选项
+type WatchOptions struct {
+	// 编译成功后执行的命令, 如重启应用: "go build -o app && ./app".
+	// 上一次执行的命令还没有结束时会先结束它.
+	Exec string
+	// 在这段时间内的多次改变只会编译一次, 默认300ms
+	Debounce time.Duration
+	// 项目配置文件, 改变时重新读取配置并重新编译所有包, 为空时不监听
+	ConfigFile string
+	// 重新读取配置, 默认为LoadConfig(ConfigFile), 用于在读取之后应用命令行参数等
+	Reload func() (*Config, error)
+}
+
+// 监听src中的.vue文件, 改变时重新编译.
+// 编译失败时只会打印错误, 不会退出, 修复之后会再次编译.
+// 只有依赖改变了的组件会被重新编译, 删除或者重命名的组件会删除生成的代码, 见GenAllFileWithConfig.
+func GenAllFileWithWatch(ctx context.Context, src, desc string, pkg string) (err error) {
+	return GenAllFileWithWatchConfig(ctx, src, desc, pkg, nil, nil)
+}
+
+// 使用项目配置监听, config为nil时和GenAllFileWithWatch一样, 忽略config中的Packages
+func GenAllFileWithWatchConfig(ctx context.Context, src, desc string, pkg string, config *Config, options *WatchOptions) (err error) {
+	return GenPackagesWithWatch(ctx, config.withPackage(Package{Src: src, To: desc, Pkg: pkg}), options)
+}
+
+// 监听配置中所有包的.vue文件, 改变时重新编译所有包, 全部编译成功后才会执行Exec
+func GenPackagesWithWatch(ctx context.Context, config *Config, options *WatchOptions) (err error) {
+	if config == nil || len(config.Packages) == 0 {
+		return fmt.Errorf("no package to watch")
+	}
+	if options == nil {
+		options = &WatchOptions{}
+	}
+	debounce := options.Debounce
+	if debounce == 0 {
+		debounce = 300 * time.Millisecond
+	}
+
+	configFile := ""
+	if options.ConfigFile != "" {
+		configFile, err = filepath.Abs(options.ConfigFile)
+		if err != nil {
+			return
+		}
+	}
+	reload := options.Reload
+	if reload == nil {
+		reload = func() (*Config, error) {
+			return LoadConfig(configFile)
+		}
+	}
+
+	w := watcher.New()
+
+	// 只监听.vue文件与配置文件, 目录也需要监听, 新建的目录中的文件才能被发现
+	w.AddFilterHook(func(info os.FileInfo, fullPath string) error {
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".vue") || fullPath == configFile {
+			return nil
+		}
+		return watcher.ErrSkip
+	})
+
+	// 已经监听的src目录
+	srcs := map[string]bool{}
+	watchSrcs := func(config *Config) error {
+		next := map[string]bool{}
+		for _, p := range config.Packages {
+			next[filepath.Clean(p.Src)] = true
+		}
+		for src := range srcs {
+			if !next[src] {
+				log.Infof("stop watching dir: %s", src)
+				if err := w.RemoveRecursive(src); err != nil {
+					return err
+				}
+			}
+		}
+		for src := range next {
+			if !srcs[src] {
+				log.Infof("watching dir and subdirectories: %s", src)
+				if err := w.AddRecursive(src); err != nil {
+					return err
+				}
+			}
+		}
+		srcs = next
+		return nil
+	}
+	err = watchSrcs(config)
+	if err != nil {
+		return
+	}
+
+	// 配置文件不存在时不需要监听, 和LoadConfig一样忽略它
+	if configFile != "" {
+		if _, e := os.Stat(configFile); e == nil {
+			log.Infof("watching config file: %s", configFile)
+			err = w.Add(configFile)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	go w.Start(200 * time.Millisecond)
+	defer w.Close()
+
+	cmd := &command{line: options.Exec}
+	defer cmd.stop()
+
+	ps, err := config.packages()
+	if err != nil {
+		return
+	}
+
+	build := func() {
+		ok := true
+		for _, p := range ps {
+			err := genPackageRecover(p, config)
+			if err != nil {
+				log.Errorf("compile %s: %v", p.Src, err)
+				ok = false
+			}
+		}
+		if !ok {
+			return
+		}
+		log.Infof("compile success")
+		cmd.restart()
+	}
+	build()
+
+	// 合并一段时间内的多次改变
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-w.Error:
+			if err == watcher.ErrWatchedFileDeleted {
+				// 所有src目录都被删除时没有需要监听的文件了, 删除的是新建的子目录或者配置文件时继续监听
+				deleted := true
+				for src := range srcs {
+					if _, e := os.Stat(src); e == nil {
+						deleted = false
+					}
+				}
+				if deleted {
+					return
+				}
+				continue
+			}
+			log.Errorf("watch err: %v", err)
+		case e, ok := <-w.Event:
+			if !ok {
+				return
+			}
+			if e.IsDir() {
+				// 目录中文件的增删也会修改目录, 只关心目录本身的增删与移动
+				if e.Op == watcher.Write || e.Op == watcher.Chmod {
+					continue
+				}
+				if e.Op == watcher.Create {
+					err = w.AddRecursive(e.Path)
+					if err != nil {
+						log.Errorf("watch dir %s err: %v", e.Path, err)
+					}
+				}
+			}
+			log.Infof("file changed: %v", e)
+			if e.Path == configFile && e.Op != watcher.Remove {
+				// 重新读取配置, 配置改变之后manifest失效, 所有包都会重新编译
+				c, cps, err := reloadPackages(reload)
+				if err == nil {
+					err = watchSrcs(c)
+				}
+				if err != nil {
+					log.Errorf("reload config: %v", err)
+					continue
+				}
+				config, ps = c, cps
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			build()
+		}
+	}
+}
+
+// 读取配置并检查包之间的依赖
+func reloadPackages(reload func() (*Config, error)) (config *Config, ps []Package, err error) {
+	config, err = reload()
+	if err != nil {
+		return
+	}
+	if len(config.Packages) == 0 {
+		err = fmt.Errorf("no package to watch")
+		return
+	}
+	ps, err = config.packages()
+	return
+}
+
+// 模板中的错误作为Diagnostic报告, 编译中意外的panic在监听模式下转为错误, 避免退出
+func genPackageRecover(p Package, config *Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("compile failed: %v", r)
+		}
+	}()
+	return genPackage(p, config)
+}
+
+// 编译成功后执行的命令
+type command struct {
+	line string
+	cmd  *exec.Cmd
+	// 命令结束后关闭
+	done chan struct{}
+}
+
+// 结束上一次执行的命令, 再重新执行
+func (c *command) restart() {
+	if c.line == "" {
+		return
+	}
+	c.stop()
+
+	cmd := shellCommand(c.line)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		log.Errorf("exec '%s' err: %v", c.line, err)
+		return
+	}
+	log.Infof("exec: %s", c.line)
+
+	done := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Infof("exec '%s' exited: %v", c.line, err)
+		}
+		close(done)
+	}()
+	c.cmd = cmd
+	c.done = done
+}
+
+func (c *command) stop() {
+	if c.cmd == nil {
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		terminate(c.cmd)
+		select {
+		case <-c.done:
+		case <-time.After(5 * time.Second):
+			c.cmd.Process.Kill()
+			<-c.done
+		}
+	}
+	c.cmd = nil
+}
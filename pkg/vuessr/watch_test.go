@@ -0,0 +1,111 @@
+package vuessr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenPackageRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	desc := filepath.Join(dir, "out")
+	os.Mkdir(src, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "bad.vue"), []byte(`<template><div v-else-if="x"></div></template>`), 0666)
+
+	// 模板语法错误不会panic, 作为编译错误返回
+	err = genPackageRecover(Package{Src: src, To: desc, Pkg: "out"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "compile failed") {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(src, "bad.vue"), []byte(`<template><div></div></template>`), 0666)
+	err = genPackageRecover(Package{Src: src, To: desc, Pkg: "out"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(desc, "bad.vue.go")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 新建的目录中的组件会被编译, 配置文件改变时使用新的配置重新编译
+func TestGenPackagesWithWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	desc := filepath.Join(dir, "out")
+	configFile := filepath.Join(dir, ConfigFile)
+	os.Mkdir(src, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "page.vue"), []byte(`<template><div></div></template>`), 0666)
+	ioutil.WriteFile(configFile, []byte("packages:\n  - {src: ./src, to: ./out, pkg: out}\n"), 0666)
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- GenPackagesWithWatch(ctx, config, &WatchOptions{Debounce: 50 * time.Millisecond, ConfigFile: configFile})
+	}()
+
+	// 等待生成的文件满足条件
+	wait := func(file, contains string) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(50 * time.Millisecond) {
+			bs, err := ioutil.ReadFile(filepath.Join(desc, file))
+			if err == nil && strings.Contains(string(bs), contains) {
+				return
+			}
+		}
+		t.Fatalf("%s should contains %q", file, contains)
+	}
+	wait("page.vue.go", "package out")
+
+	os.Mkdir(filepath.Join(src, "card"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(src, "card", "card.vue"), []byte(`<template><p></p></template>`), 0666)
+	wait("card.vue.go", "package out")
+
+	ioutil.WriteFile(configFile, []byte("packages:\n  - {src: ./src, to: ./out, pkg: out2}\n"), 0666)
+	wait("page.vue.go", "package out2")
+	wait("card.vue.go", "package out2")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	c := &command{line: "sleep 10"}
+	c.restart()
+	done := c.done
+
+	start := time.Now()
+	c.restart()
+	select {
+	case <-done:
+	default:
+		t.Fatal("should stop the last command")
+	}
+	c.stop()
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("stop too slow")
+	}
+}